@@ -0,0 +1,215 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// battery backed RAM is saved in the raw format used by other emulators:
+// the RAM contents, followed for MBC3 cartridges with a clock by the RTC footer
+// made of the 5 clock registers, the 5 latched registers (4 bytes each) and a 64 bit unix timestamp
+// HuC3 and TAMA5 cartridges are followed by a 64 bit unix timestamp, and the minutes and days of the clock on 16 bits
+const (
+	rtcFooterSize = 48
+	// older emulators save the timestamp on 32 bits
+	rtcShortFooterSize = 44
+
+	huc3FooterSize = 12
+
+	// the battery save is written every 5 seconds if it changed
+	batteryFlushFrames = 5 * 60
+)
+
+// batteryMBC is implemented by the MBCs which can have battery backed RAM
+type batteryMBC interface {
+	batteryRAM() []byte // nil if the cartridge has no battery
+}
+
+func getBatteryRAM(mbc MBC) []byte {
+	if b, ok := mbc.(batteryMBC); ok {
+		return b.batteryRAM()
+	}
+	return nil
+}
+
+func hasBattery(mbc MBC) bool {
+	return getBatteryRAM(mbc) != nil
+}
+
+// BatterySavePath returns the path of the battery save of a rom, e.g. game.sav for game.gb
+func BatterySavePath(romPath string) string {
+	return strings.TrimSuffix(romPath, filepath.Ext(romPath)) + ".sav"
+}
+
+func encodeBatterySave(mbc MBC) []byte {
+	save := append([]byte{}, getBatteryRAM(mbc)...)
+
+	switch m := mbc.(type) {
+	case *MBC3:
+		if m.Rtc != nil {
+			save = append(save, encodeRTCFooter(m.Rtc)...)
+		}
+	case *HuC3:
+		save = append(save, encodeHuC3Footer(m.Clock)...)
+	case *TAMA5:
+		save = append(save, encodeHuC3Footer(m.Clock)...)
+	}
+
+	return save
+}
+
+// batterySaveContents returns the save with the timestamp of the clock footer cleared
+// the timestamp changes every time the save is encoded, it doesn't make the save dirty on its own
+func batterySaveContents(mbc MBC, save []byte) []byte {
+	contents := append([]byte{}, save...)
+	footer := contents[len(getBatteryRAM(mbc)):]
+
+	switch m := mbc.(type) {
+	case *MBC3:
+		if m.Rtc != nil {
+			copy(footer[40:], make([]byte, 8))
+		}
+	case *HuC3, *TAMA5:
+		copy(footer, make([]byte, 8))
+	}
+
+	return contents
+}
+
+func encodeRTCFooter(rtc *RTC) []byte {
+	rtc.save(timeNow())
+
+	footer := make([]byte, rtcFooterSize)
+	for i := 0; i < 5; i++ {
+		binary.LittleEndian.PutUint32(footer[4*i:], uint32(rtc.Registers[i]))
+		binary.LittleEndian.PutUint32(footer[20+4*i:], uint32(rtc.Latched[i]))
+	}
+	binary.LittleEndian.PutUint64(footer[40:], uint64(rtc.Timestamp))
+	return footer
+}
+
+func encodeHuC3Footer(clock *HuC3Clock) []byte {
+	clock.save(timeNow())
+
+	footer := make([]byte, huc3FooterSize)
+	binary.LittleEndian.PutUint64(footer, uint64(clock.Timestamp))
+	binary.LittleEndian.PutUint16(footer[8:], uint16(clock.Minutes))
+	binary.LittleEndian.PutUint16(footer[10:], uint16(clock.Days))
+	return footer
+}
+
+func decodeBatterySave(mbc MBC, save []byte) {
+	ram := getBatteryRAM(mbc)
+	n := copy(ram, save)
+	footer := save[n:]
+
+	switch m := mbc.(type) {
+	case *MBC3:
+		if m.Rtc != nil && (len(footer) == rtcFooterSize || len(footer) == rtcShortFooterSize) {
+			decodeRTCFooter(m.Rtc, footer)
+		}
+	case *HuC3:
+		if len(footer) == huc3FooterSize {
+			decodeHuC3Footer(m.Clock, footer)
+		}
+	case *TAMA5:
+		if len(footer) == huc3FooterSize {
+			decodeHuC3Footer(m.Clock, footer)
+		}
+	}
+}
+
+func decodeRTCFooter(rtc *RTC, footer []byte) {
+	for i := 0; i < 5; i++ {
+		rtc.Registers[i] = byte(binary.LittleEndian.Uint32(footer[4*i:])) & rtcMasks[i]
+		rtc.Latched[i] = byte(binary.LittleEndian.Uint32(footer[20+4*i:])) & rtcMasks[i]
+	}
+	if len(footer) == rtcFooterSize {
+		rtc.Timestamp = int64(binary.LittleEndian.Uint64(footer[40:]))
+	} else {
+		rtc.Timestamp = int64(binary.LittleEndian.Uint32(footer[40:]))
+	}
+
+	// the clock kept running while the emulator was closed
+	rtc.load(timeNow())
+}
+
+func decodeHuC3Footer(clock *HuC3Clock, footer []byte) {
+	clock.Timestamp = int64(binary.LittleEndian.Uint64(footer))
+	clock.Minutes = int(binary.LittleEndian.Uint16(footer[8:])) % minutesPerDay
+	clock.Days = int(binary.LittleEndian.Uint16(footer[10:])) & 0xFFF
+	clock.load(timeNow())
+}
+
+// loadBatterySave restores the battery backed RAM, it does nothing if there is no save yet
+func loadBatterySave(mbc MBC, path string) {
+	save, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	decodeBatterySave(mbc, save)
+}
+
+// writeBatterySave writes the save to a temporary file first so that it isn't lost if the emulator is killed
+func writeBatterySave(path string, save []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, save, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// WithBatterySave loads the battery backed RAM of the cartridge from the given file if it exists,
+// the RAM is then written back to it periodically and by FlushBatterySave
+func WithBatterySave(path string) func(*Emulator) {
+	return func(e *Emulator) {
+		e.batterySavePath = path
+	}
+}
+
+// SetBatterySave writes the battery backed RAM to the given file from now on, without loading it
+// e.g. after restoring a save state, which already contains the RAM
+func (e *Emulator) SetBatterySave(path string) {
+	e.batterySavePath = path
+	e.lastBatterySave = nil
+}
+
+// FlushBatterySave writes the battery backed RAM to the battery save if it changed since the last write
+// only the RAM and the clock registers are compared, not the timestamp of the clock
+func (e *Emulator) FlushBatterySave() error {
+	if e.batterySavePath == "" || !hasBattery(e.mbc) {
+		return nil
+	}
+
+	save := encodeBatterySave(e.mbc)
+	contents := batterySaveContents(e.mbc, save)
+	if bytes.Equal(contents, e.lastBatterySave) {
+		return nil
+	}
+
+	if err := writeBatterySave(e.batterySavePath, save); err != nil {
+		return err
+	}
+	e.lastBatterySave = contents
+	return nil
+}
+
+func (e *Emulator) flushBatterySavePeriodically() {
+	e.frames++
+	if e.frames%batteryFlushFrames != 0 {
+		return
+	}
+
+	if err := e.FlushBatterySave(); err != nil {
+		e.logger.Log("Can't write the battery save: " + err.Error() + "\n")
+	}
+}
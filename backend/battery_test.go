@@ -0,0 +1,149 @@
+package backend
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newBatteryEmulator(cartridgeType byte, path string) *Emulator {
+	return NewEmulator(withMBC(NewMBC(makeBankedRom(cartridgeType, 1, 1))), WithBatterySave(path), WithDisableApu())
+}
+
+func TestBatterySavePath(t *testing.T) {
+	assert.Equal(t, "roms/game.sav", BatterySavePath("roms/game.gb"))
+	assert.Equal(t, "game.sav", BatterySavePath("game.gbc"))
+}
+
+func TestBatterySave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.sav")
+
+	// MBC1 + RAM + Battery
+	emulator := newBatteryEmulator(0x03, path)
+	emulator.mbc.WriteMemory(0x0000, 0x0A)
+	emulator.mbc.WriteMemory(0xA000, 0x12)
+	emulator.mbc.WriteMemory(0xA7FF, 0x34)
+	assert.NoError(t, emulator.FlushBatterySave())
+
+	// the file is the raw RAM
+	save, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Len(t, save, 1<<11)
+	assert.Equal(t, byte(0x12), save[0])
+	assert.Equal(t, byte(0x34), save[0x7FF])
+
+	emulator = newBatteryEmulator(0x03, path)
+	emulator.mbc.WriteMemory(0x0000, 0x0A)
+	assert.Equal(t, byte(0x12), emulator.mbc.ReadMemory(0xA000))
+	assert.Equal(t, byte(0x34), emulator.mbc.ReadMemory(0xA7FF))
+}
+
+func TestBatterySaveFlushedPeriodically(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.sav")
+
+	emulator := newBatteryEmulator(0x1B, path)
+	emulator.mbc.WriteMemory(0x0000, 0x0A)
+	emulator.mbc.WriteMemory(0xA000, 0x56)
+
+	for i := 0; i < batteryFlushFrames-1; i++ {
+		emulator.RunForAFrame()
+	}
+	assert.NoFileExists(t, path)
+
+	emulator.RunForAFrame()
+	save, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x56), save[0])
+}
+
+func TestNoBatterySave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.sav")
+
+	// MBC1 + RAM
+	emulator := newBatteryEmulator(0x02, path)
+	emulator.mbc.WriteMemory(0x0000, 0x0A)
+	emulator.mbc.WriteMemory(0xA000, 0x12)
+	assert.NoError(t, emulator.FlushBatterySave())
+	assert.NoFileExists(t, path)
+}
+
+func TestNoBatterySaveWithoutRAM(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.sav")
+
+	// ROM + RAM + Battery, with no RAM in the header
+	emulator := NewEmulator(withMBC(NewMBC(makeBankedRom(0x09, 0, 0))), WithBatterySave(path), WithDisableApu())
+	assert.False(t, hasBattery(emulator.mbc))
+	assert.NoError(t, emulator.FlushBatterySave())
+	assert.NoFileExists(t, path)
+}
+
+func TestBatterySaveRTCFooter(t *testing.T) {
+	now := setTestTime(t)
+	path := filepath.Join(t.TempDir(), "game.sav")
+
+	// MBC3 + RAM + Timer + Battery
+	emulator := newBatteryEmulator(0x10, path)
+	mbc := emulator.mbc.(*MBC3)
+	mbc.WriteMemory(0x0000, 0x0A)
+	mbc.WriteMemory(0xA000, 0x12)
+	writeRTC(mbc, rtcHours, 5)
+	latchRTC(mbc)
+	assert.NoError(t, emulator.FlushBatterySave())
+
+	save, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Len(t, save, 1<<11+rtcFooterSize)
+	footer := save[1<<11:]
+	assert.Equal(t, uint32(5), binary.LittleEndian.Uint32(footer[4*rtcHours:]))
+	assert.Equal(t, uint32(5), binary.LittleEndian.Uint32(footer[20+4*rtcHours:]))
+	assert.Equal(t, uint64(now.Unix()), binary.LittleEndian.Uint64(footer[40:]))
+
+	// the time elapsed while the emulator was closed is applied
+	*now = now.Add(time.Hour)
+	emulator = newBatteryEmulator(0x10, path)
+	mbc = emulator.mbc.(*MBC3)
+	mbc.WriteMemory(0x0000, 0x0A)
+	assert.Equal(t, byte(0x12), mbc.ReadMemory(0xA000))
+	latchRTC(mbc)
+	assert.Equal(t, byte(6), readRTC(mbc, rtcHours))
+
+	// footer with a 32 bit timestamp
+	binary.LittleEndian.PutUint32(footer[40:], uint32(now.Unix()-60))
+	assert.NoError(t, os.WriteFile(path, save[:1<<11+rtcShortFooterSize], 0644))
+	emulator = newBatteryEmulator(0x10, path)
+	mbc = emulator.mbc.(*MBC3)
+	mbc.WriteMemory(0x0000, 0x0A)
+	latchRTC(mbc)
+	assert.Equal(t, byte(5), readRTC(mbc, rtcHours))
+	assert.Equal(t, byte(1), readRTC(mbc, rtcMinutes))
+}
+
+func TestBatterySaveIgnoresRTCTimestamp(t *testing.T) {
+	now := setTestTime(t)
+	path := filepath.Join(t.TempDir(), "game.sav")
+
+	// MBC3 + RAM + Timer + Battery
+	emulator := newBatteryEmulator(0x10, path)
+	mbc := emulator.mbc.(*MBC3)
+	mbc.WriteMemory(0x0000, 0x0A)
+	mbc.WriteMemory(0xA000, 0x12)
+	assert.NoError(t, emulator.FlushBatterySave())
+	assert.NoError(t, os.Remove(path))
+
+	// only the timestamp of the footer changed, the save isn't written again
+	*now = now.Add(10 * time.Second)
+	assert.NoError(t, emulator.FlushBatterySave())
+	assert.NoFileExists(t, path)
+
+	writeRTC(mbc, rtcMinutes, 5)
+	assert.NoError(t, emulator.FlushBatterySave())
+	save, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	footer := save[1<<11:]
+	assert.Equal(t, uint32(5), binary.LittleEndian.Uint32(footer[4*rtcMinutes:]))
+	assert.Equal(t, uint64(now.Unix()), binary.LittleEndian.Uint64(footer[40:]))
+}
@@ -0,0 +1,380 @@
+package backend
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	cameraWidth  = 128
+	cameraHeight = 112
+
+	cameraRAMSize = 16 * 0x2000
+
+	// RAM bank value mapping the sensor registers at 0xA000-0xA07F instead of the RAM
+	cameraRegistersBank = 0x10
+	cameraRegistersSize = 0x36
+
+	// the captured image is written as 16 x 14 tiles in RAM bank 0, from 0xA100
+	cameraImageAddress = 0x100
+
+	// sensor registers
+	cameraControl      = 0x00 // bit 0: start a capture, reads 1 until it is done
+	cameraGain         = 0x01 // bits 5-7: edge enhancement mode, bit 7: N, the other bits are the gain
+	cameraExposureHigh = 0x02
+	cameraExposureLow  = 0x03
+	cameraEdge         = 0x04 // bits 4-6: edge enhancement ratio, bit 3: invert the output
+	cameraDithering    = 0x06 // 4 x 4 matrix of 3 thresholds
+)
+
+// the 2D edge enhancement ratios selected by bits 4-6 of register 4
+var cameraEdgeRatios = [8]float64{0.5, 0.75, 1, 1.25, 2, 3, 4, 5}
+
+// CameraImageSource provides the images seen by the sensor of the Game Boy Camera
+type CameraImageSource interface {
+	// CaptureImage is called when the game takes a picture,
+	// the image is scaled to 128 x 112 pixels and converted to grayscale
+	CaptureImage() image.Image
+}
+
+// Camera is the Game Boy Camera (Pocket Camera) cartridge, with 128KB of RAM and an image sensor
+// the sensor image is processed like the hardware does: exposure, edge enhancement and dithering
+type Camera struct {
+	RamEnabled      bool
+	SelectedROMBank byte
+	SelectedRAMBank byte // set to 0x10 to access the sensor registers
+
+	Rom []byte
+	Ram []byte
+
+	NumRomBanks uint16
+
+	Registers [cameraRegistersSize]byte
+
+	// dots left until the capture is done, 0 when not capturing
+	CaptureDots int
+
+	source CameraImageSource
+}
+
+func NewCamera(rom []byte, header CartridgeHeader) *Camera {
+	m := new(Camera)
+
+	m.SelectedROMBank = 1
+
+	m.Rom = fitROM(rom, header)
+
+	m.NumRomBanks = uint16(len(m.Rom) / 0x4000)
+
+	// the header always says 128KB
+	m.Ram = make([]byte, cameraRAMSize)
+
+	return m
+}
+
+func (m *Camera) ReadMemory(address uint16) byte {
+
+	if address < 0x4000 {
+		return m.Rom[address]
+	}
+	if 0x4000 <= address && address < 0x8000 {
+
+		offset := uint32(address) - 0x4000
+		bankAddress := (uint32(m.SelectedROMBank) * 0x4000) + offset
+		return m.Rom[bankAddress]
+
+	} else if 0xA000 <= address && address < 0xC000 {
+
+		if m.SelectedRAMBank&cameraRegistersBank > 0 {
+			// only the capture flag can be read, the registers are mirrored every 0x80 bytes
+			if address&0x7F == cameraControl {
+				return m.Registers[cameraControl] & 0x7
+			}
+			return 0x00
+		}
+
+		// the RAM can be read even when it isn't enabled
+		offset := uint32(address) - 0xA000
+		bankAddress := (uint32(m.SelectedRAMBank) * 0x2000) + offset
+		return m.Ram[bankAddress%uint32(len(m.Ram))]
+	}
+
+	panic(fmt.Sprintf("Got unexpected read address not handled by MBC %d", address))
+}
+
+func (m *Camera) WriteMemory(address uint16, value byte) {
+
+	if address < 0x2000 {
+
+		m.RamEnabled = value&0xF == 0xA
+
+	} else if 0x2000 <= address && address < 0x4000 {
+
+		m.SelectedROMBank = byte(uint16(value&0x3F) % m.NumRomBanks)
+
+	} else if 0x4000 <= address && address < 0x6000 {
+
+		m.SelectedRAMBank = value & 0x1F
+		if m.SelectedRAMBank&cameraRegistersBank > 0 {
+			m.SelectedRAMBank = cameraRegistersBank
+		}
+
+	} else if 0x6000 <= address && address < 0x8000 {
+
+		// no registers there
+
+	} else if 0xA000 <= address && address < 0xC000 {
+
+		if m.SelectedRAMBank&cameraRegistersBank > 0 {
+			m.writeRegister(byte(address&0x7F), value)
+		} else if m.RamEnabled {
+			offset := uint32(address) - 0xA000
+			bankAddress := (uint32(m.SelectedRAMBank) * 0x2000) + offset
+			m.Ram[bankAddress%uint32(len(m.Ram))] = value
+		}
+
+	} else {
+		panic(fmt.Sprintf("Got unexpected write address not handled by MBC %d", address))
+	}
+}
+
+func (m *Camera) writeRegister(register byte, value byte) {
+	if int(register) >= cameraRegistersSize {
+		return
+	}
+
+	if register == cameraControl {
+		// a capture can be cancelled by clearing bit 0
+		if value&1 > 0 && m.CaptureDots == 0 {
+			m.CaptureDots = m.captureDots()
+		} else if value&1 == 0 {
+			m.CaptureDots = 0
+		}
+		value &= 0x7
+	}
+
+	m.Registers[register] = value
+}
+
+func (m *Camera) exposure() int {
+	return int(m.Registers[cameraExposureHigh])<<8 | int(m.Registers[cameraExposureLow])
+}
+
+// captureDots returns how long a capture takes, which depends on the exposure time
+func (m *Camera) captureDots() int {
+	cycles := 32446 + 16*m.exposure()
+	if m.Registers[cameraGain]&0x80 == 0 {
+		cycles += 512
+	}
+	return 4 * cycles
+}
+
+func (m *Camera) tick(dots int) {
+	if m.CaptureDots == 0 {
+		return
+	}
+
+	m.CaptureDots -= dots
+	if m.CaptureDots <= 0 {
+		m.CaptureDots = 0
+		m.capture()
+		m.Registers[cameraControl] &^= 1
+	}
+}
+
+// capture processes the sensor image and writes it to RAM as tiles
+func (m *Camera) capture() {
+	source := m.source
+	if source == nil {
+		source = TestPatternImageSource{}
+	}
+	sensor := scaleToSensor(source.CaptureImage())
+
+	exposure := float64(m.exposure()) / 0x1000
+	pixel := func(x, y int) float64 {
+		if x < 0 || x >= cameraWidth || y < 0 || y >= cameraHeight {
+			return 0
+		}
+		return float64(sensor.GrayAt(x, y).Y) * exposure
+	}
+
+	edgeEnhancement := m.Registers[cameraGain]&0xE0 == 0xE0
+	ratio := cameraEdgeRatios[m.Registers[cameraEdge]>>4&0x7]
+	invert := m.Registers[cameraEdge]&0x08 > 0
+
+	tiles := m.Ram[cameraImageAddress : cameraImageAddress+cameraWidth*cameraHeight/4]
+	for i := range tiles {
+		tiles[i] = 0
+	}
+
+	for y := 0; y < cameraHeight; y++ {
+		for x := 0; x < cameraWidth; x++ {
+			value := pixel(x, y)
+			if edgeEnhancement {
+				value += ratio * (4*value - pixel(x-1, y) - pixel(x+1, y) - pixel(x, y-1) - pixel(x, y+1))
+			}
+			if invert {
+				value = 255 - value
+			}
+
+			// each pixel of the 4 x 4 dithering matrix has 3 thresholds
+			thresholds := m.Registers[cameraDithering+3*((y&3)*4+x&3):]
+			shade := byte(0)
+			for _, threshold := range thresholds[:3] {
+				if value < float64(threshold) {
+					shade++
+				}
+			}
+
+			// 2 bits per pixel tiles, 16 tiles per row
+			offset := (y/8*16+x/8)*16 + (y%8)*2
+			bit := byte(0x80) >> (x % 8)
+			if shade&1 > 0 {
+				tiles[offset] |= bit
+			}
+			if shade&2 > 0 {
+				tiles[offset+1] |= bit
+			}
+		}
+	}
+}
+
+// scaleToSensor converts the image to the size of the sensor in grayscale, using nearest neighbour scaling
+func scaleToSensor(img image.Image) *image.Gray {
+	sensor := image.NewGray(image.Rect(0, 0, cameraWidth, cameraHeight))
+	bounds := img.Bounds()
+	for y := 0; y < cameraHeight; y++ {
+		for x := 0; x < cameraWidth; x++ {
+			sx := bounds.Min.X + x*bounds.Dx()/cameraWidth
+			sy := bounds.Min.Y + y*bounds.Dy()/cameraHeight
+			sensor.Set(x, y, color.GrayModel.Convert(img.At(sx, sy)))
+		}
+	}
+	return sensor
+}
+
+func (m *Camera) batteryRAM() []byte {
+	return m.Ram
+}
+
+func (m *Camera) setImageSource(source CameraImageSource) {
+	m.source = source
+}
+
+// WithCameraImageSource sets the images seen by the sensor of a Game Boy Camera cartridge,
+// the test pattern is used by default
+func WithCameraImageSource(source CameraImageSource) func(*Emulator) {
+	return func(e *Emulator) {
+		e.cameraImageSource = source
+	}
+}
+
+// SetCameraImageSource sets the images seen by the sensor of a Game Boy Camera cartridge, see WithCameraImageSource
+func (e *Emulator) SetCameraImageSource(source CameraImageSource) {
+	e.cameraImageSource = source
+	if m, ok := e.mbc.(*Camera); ok {
+		m.setImageSource(source)
+	}
+}
+
+// StaticImageSource always captures the same image
+type StaticImageSource struct {
+	Image image.Image
+}
+
+func (s StaticImageSource) CaptureImage() image.Image {
+	return s.Image
+}
+
+func loadPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return png.Decode(f)
+}
+
+// NewPNGImageSource captures the given PNG file
+func NewPNGImageSource(path string) (StaticImageSource, error) {
+	img, err := loadPNG(path)
+	return StaticImageSource{img}, err
+}
+
+// DirectoryImageSource captures the PNG files of a directory one after the other, in alphabetical order
+type DirectoryImageSource struct {
+	frames []image.Image
+	next   int
+}
+
+func NewDirectoryImageSource(dir string) (*DirectoryImageSource, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.png"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	s := new(DirectoryImageSource)
+	for _, path := range paths {
+		img, err := loadPNG(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		s.frames = append(s.frames, img)
+	}
+	if len(s.frames) == 0 {
+		return nil, fmt.Errorf("no PNG file in %s", dir)
+	}
+	return s, nil
+}
+
+func (s *DirectoryImageSource) CaptureImage() image.Image {
+	img := s.frames[s.next]
+	s.next = (s.next + 1) % len(s.frames)
+	return img
+}
+
+// TestPatternImageSource captures vertical bars going from white to black, over a horizontal gradient
+// it is used when no image source is set
+type TestPatternImageSource struct{}
+
+func (TestPatternImageSource) CaptureImage() image.Image {
+	img := image.NewGray(image.Rect(0, 0, cameraWidth, cameraHeight))
+	for y := 0; y < cameraHeight; y++ {
+		for x := 0; x < cameraWidth; x++ {
+			if y < cameraHeight/2 {
+				img.SetGray(x, y, color.Gray{255 - byte(x/32*85)})
+			} else {
+				img.SetGray(x, y, color.Gray{255 - byte(x*2)})
+			}
+		}
+	}
+	return img
+}
+
+// CameraImageSourceFromPath returns the image source described by a path: a PNG file or a directory of PNG files
+// an empty path selects the test pattern
+func CameraImageSourceFromPath(path string) (CameraImageSource, error) {
+	if path == "" {
+		return TestPatternImageSource{}, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return NewDirectoryImageSource(path)
+	}
+	if !strings.EqualFold(filepath.Ext(path), ".png") {
+		return nil, fmt.Errorf("%s is not a PNG file", path)
+	}
+	return NewPNGImageSource(path)
+}
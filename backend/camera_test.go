@@ -0,0 +1,228 @@
+package backend
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func uniformImage(gray byte) image.Image {
+	img := image.NewGray(image.Rect(0, 0, 16, 14))
+	for i := range img.Pix {
+		img.Pix[i] = gray
+	}
+	return img
+}
+
+// setupCamera selects the registers, with an exposure of 0x1000 and thresholds 0x40, 0x80 and 0xC0
+func setupCamera(m *Camera) {
+	m.WriteMemory(0x4000, cameraRegistersBank)
+	m.WriteMemory(0xA000+cameraExposureHigh, 0x10)
+	m.WriteMemory(0xA000+cameraExposureLow, 0x00)
+	for i := 0; i < 16; i++ {
+		m.WriteMemory(0xA000+cameraDithering+uint16(3*i), 0x40)
+		m.WriteMemory(0xA000+cameraDithering+uint16(3*i)+1, 0x80)
+		m.WriteMemory(0xA000+cameraDithering+uint16(3*i)+2, 0xC0)
+	}
+}
+
+// capturePhoto takes a picture and returns the shade of each pixel
+func capturePhoto(m *Camera) [cameraHeight][cameraWidth]byte {
+	m.WriteMemory(0x4000, cameraRegistersBank)
+	m.WriteMemory(0xA000, 1)
+	m.tick(m.CaptureDots)
+
+	var shades [cameraHeight][cameraWidth]byte
+	for y := 0; y < cameraHeight; y++ {
+		for x := 0; x < cameraWidth; x++ {
+			offset := cameraImageAddress + (y/8*16+x/8)*16 + (y%8)*2
+			low := m.Ram[offset] >> (7 - x%8) & 1
+			high := m.Ram[offset+1] >> (7 - x%8) & 1
+			shades[y][x] = high<<1 | low
+		}
+	}
+	return shades
+}
+
+func TestCameraBanking(t *testing.T) {
+	m := NewMBC(makeBankedRom(0xFC, 2, 4)).(*Camera)
+	assert.Equal(t, cameraRAMSize, len(m.Ram))
+
+	m.WriteMemory(0x2000, 5)
+	assert.Equal(t, byte(5), m.ReadMemory(0x4200))
+
+	// the RAM needs to be enabled for writes only
+	m.WriteMemory(0x4000, 3)
+	m.WriteMemory(0xA000, 0x12)
+	assert.Equal(t, byte(0), m.ReadMemory(0xA000))
+	m.WriteMemory(0x0000, 0x0A)
+	m.WriteMemory(0xA000, 0x12)
+	m.WriteMemory(0x0000, 0x00)
+	assert.Equal(t, byte(0x12), m.ReadMemory(0xA000))
+	assert.Equal(t, byte(0x12), m.Ram[3*0x2000])
+
+	// the registers are write only, except for the capture flag
+	m.WriteMemory(0x4000, cameraRegistersBank)
+	m.WriteMemory(0xA002, 0x34)
+	assert.Equal(t, byte(0x34), m.Registers[cameraExposureHigh])
+	assert.Equal(t, byte(0x00), m.ReadMemory(0xA002))
+	m.WriteMemory(0xA080, 0x05)
+	assert.Equal(t, byte(0x05), m.ReadMemory(0xA000))
+	assert.Equal(t, byte(0x12), m.Ram[3*0x2000])
+}
+
+func TestCameraCaptureTiming(t *testing.T) {
+	emulator := NewEmulator(withMBC(NewMBC(makeBankedRom(0xFC, 2, 4))), WithDisableApu(),
+		WithCameraImageSource(StaticImageSource{uniformImage(0)}))
+	m := emulator.mbc.(*Camera)
+	setupCamera(m)
+
+	// the first frame only ends the VBlank the emulator starts in
+	emulator.RunForAFrame()
+
+	// 4 * (32446 + 512 + 16 * 0x1000) dots, a bit less than 6 frames
+	m.WriteMemory(0xA000, 1)
+	assert.Equal(t, 4*(32446+512+16*0x1000), m.CaptureDots)
+	for i := 0; i < 5; i++ {
+		emulator.RunForAFrame()
+		assert.Equal(t, byte(1), m.ReadMemory(0xA000))
+	}
+	emulator.RunForAFrame()
+	assert.Equal(t, byte(0), m.ReadMemory(0xA000))
+	assert.Equal(t, byte(0xFF), m.Ram[cameraImageAddress])
+	assert.Equal(t, byte(0xFF), m.Ram[cameraImageAddress+cameraWidth*cameraHeight/4-1])
+
+	// N is set, the capture is shorter
+	m.WriteMemory(0xA001, 0x80)
+	m.WriteMemory(0xA000, 1)
+	assert.Equal(t, 4*(32446+16*0x1000), m.CaptureDots)
+
+	// the capture can be cancelled
+	m.WriteMemory(0xA000, 0)
+	assert.Equal(t, 0, m.CaptureDots)
+}
+
+func TestCameraImageProcessing(t *testing.T) {
+	rom := makeBankedRom(0xFC, 2, 4)
+	m := NewCamera(rom, ParseCartridgeHeader(rom))
+	setupCamera(m)
+
+	for gray, shade := range map[byte]byte{0x20: 3, 0x60: 2, 0xA0: 1, 0xE0: 0} {
+		m.setImageSource(StaticImageSource{uniformImage(gray)})
+		shades := capturePhoto(m)
+		assert.Equal(t, shade, shades[0][0])
+		assert.Equal(t, shade, shades[cameraHeight-1][cameraWidth-1])
+	}
+
+	// the exposure scales the sensor values
+	m.WriteMemory(0xA000+cameraExposureHigh, 0x08)
+	m.setImageSource(StaticImageSource{uniformImage(0xE0)})
+	assert.Equal(t, byte(2), capturePhoto(m)[50][50])
+	m.WriteMemory(0xA000+cameraExposureHigh, 0x10)
+
+	// invert
+	m.WriteMemory(0xA000+cameraEdge, 0x08)
+	assert.Equal(t, byte(3), capturePhoto(m)[50][50])
+	m.WriteMemory(0xA000+cameraEdge, 0x00)
+
+	// the dithering thresholds are taken from a 4 x 4 matrix
+	m.WriteMemory(0xA000+cameraDithering+3*5, 0xF0)
+	shades := capturePhoto(m)
+	assert.Equal(t, byte(1), shades[1][1])
+	assert.Equal(t, byte(1), shades[5][5])
+	assert.Equal(t, byte(0), shades[1][2])
+	m.WriteMemory(0xA000+cameraDithering+3*5, 0x40)
+
+	// edge enhancement darkens the dark side of the edges, and brightens their bright side
+	img := image.NewGray(image.Rect(0, 0, cameraWidth, cameraHeight))
+	for y := 0; y < cameraHeight; y++ {
+		for x := 0; x < cameraWidth; x++ {
+			if x >= cameraWidth/2 {
+				img.SetGray(x, y, color.Gray{0x90})
+			} else {
+				img.SetGray(x, y, color.Gray{0x70})
+			}
+		}
+	}
+	m.setImageSource(StaticImageSource{img})
+	shades = capturePhoto(m)
+	assert.Equal(t, byte(2), shades[50][cameraWidth/2-1])
+	assert.Equal(t, byte(1), shades[50][cameraWidth/2])
+
+	m.WriteMemory(0xA000+cameraGain, 0xE0)
+	m.WriteMemory(0xA000+cameraEdge, 0x40) // ratio 2
+	shades = capturePhoto(m)
+	assert.Equal(t, byte(2), shades[50][10])
+	assert.Equal(t, byte(3), shades[50][cameraWidth/2-1])
+	assert.Equal(t, byte(0), shades[50][cameraWidth/2])
+	assert.Equal(t, byte(1), shades[50][cameraWidth-10])
+}
+
+func TestCameraTestPattern(t *testing.T) {
+	rom := makeBankedRom(0xFC, 2, 4)
+	m := NewCamera(rom, ParseCartridgeHeader(rom))
+	setupCamera(m)
+
+	// no source set: white to black bars
+	shades := capturePhoto(m)
+	assert.Equal(t, byte(0), shades[10][0])
+	assert.Equal(t, byte(1), shades[10][40])
+	assert.Equal(t, byte(2), shades[10][70])
+	assert.Equal(t, byte(3), shades[10][100])
+}
+
+func writeTestPNG(t *testing.T, path string, gray byte) {
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	assert.NoError(t, png.Encode(f, uniformImage(gray)))
+}
+
+func TestCameraImageSourceFromPath(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPNG(t, filepath.Join(dir, "b.png"), 0xE0)
+	writeTestPNG(t, filepath.Join(dir, "a.png"), 0x20)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not an image"), 0644))
+
+	rom := makeBankedRom(0xFC, 2, 4)
+	m := NewCamera(rom, ParseCartridgeHeader(rom))
+	setupCamera(m)
+
+	source, err := CameraImageSourceFromPath(dir)
+	assert.NoError(t, err)
+	m.setImageSource(source)
+	assert.Equal(t, byte(3), capturePhoto(m)[0][0])
+	assert.Equal(t, byte(0), capturePhoto(m)[0][0])
+	assert.Equal(t, byte(3), capturePhoto(m)[0][0])
+
+	source, err = CameraImageSourceFromPath(filepath.Join(dir, "b.png"))
+	assert.NoError(t, err)
+	m.setImageSource(source)
+	assert.Equal(t, byte(0), capturePhoto(m)[0][0])
+
+	source, err = CameraImageSourceFromPath("")
+	assert.NoError(t, err)
+	assert.Equal(t, TestPatternImageSource{}, source)
+
+	_, err = CameraImageSourceFromPath(filepath.Join(dir, "notes.txt"))
+	assert.Error(t, err)
+	_, err = CameraImageSourceFromPath(t.TempDir())
+	assert.Error(t, err)
+	_, err = CameraImageSourceFromPath(filepath.Join(dir, "missing.png"))
+	assert.Error(t, err)
+}
+
+func TestMarshalCamera(t *testing.T) {
+	rom := makeBankedRom(0xFC, 2, 4)
+	m := NewCamera(rom, ParseCartridgeHeader(rom))
+	m.SelectedRAMBank = cameraRegistersBank
+	m.Registers[cameraExposureHigh] = 0x12
+	m.CaptureDots = 1000
+	m.Ram[0x100] = 0x34
+	runTest(t, m)
+}
@@ -13,80 +13,172 @@ type CPU struct {
 	// 2 -> IME == false; IE & IF == 0; stop executing until IE & IF > 0, then skip to next instruction
 	// 3 -> IME == false; IE & IF > 0; HALT BUG
 
-	cycleCounter uint64 // to count cycles
+	cycleCounter      uint64 // number of cycles since power on
+	instructionCycles int    // cycles elapsed so far in the current instruction
 
 	mmu *MMU
 	apu *APU
+	ppu *PPU
 
 	debugger *DebugHarness
 }
 
 // NewCPU creates a new cpu struct
-// also copies the bootrom into ram from 0x0000 to 0x00FF (256 bytes)
+// unless a boot rom is used, the registers are set to the values the boot rom leaves behind
 func NewCPU(debug bool, apu *APU, mmu *MMU) *CPU {
 	c := new(CPU)
 
 	c.apu = apu
 	c.mmu = mmu
 
-	c.writeMemory(0xFF40, 0x91)
-	c.writeMemory(0xFF47, 0xFC)
-	c.writeMemory(0xFF48, 0xFF)
-	c.writeMemory(0xFF49, 0xFF)
+	if debug {
+		c.debugger = NewDebugHarness()
+	}
+
+	if mmu.cgb {
+		// no VRAM DMA in progress
+		mmu.ram[HDMA5] = 0xFF
+	}
+
+	// when running a boot rom, start from a zeroed state and let the boot rom initialise the hardware
+	if mmu.bootRom != nil {
+		return c
+	}
+
+	state := getPowerUpState(mmu.model, mmu.cgb, mmu.mbc.ReadMemory(0x14D))
+
+	mmu.writeMemory(0xFF40, 0x91)
+	mmu.writeMemory(0xFF47, 0xFC)
+	mmu.writeMemory(0xFF48, 0xFF)
+	mmu.writeMemory(0xFF49, 0xFF)
+
+	mmu.writeMemory(0xFF00, 0x00) // P1, both button groups selected
+	mmu.writeMemory(0xFF02, state.SC)
+	mmu.writeMemory(0xFF07, 0xF8) // TAC
+	mmu.writeMemory(0xFF0F, 0xE1) // IF, VBlank is already requested
+
+	// written directly to avoid triggering a DMA
+	mmu.ram[DMA] = state.DMA
+
+	for address, value := range powerUpAudioRegisters {
+		mmu.ram[address] = value
+	}
+	mmu.ram[NR52] = state.NR52
+
+	mmu.timer.setCounter(state.Div)
 
 	c.PC = 0x100
 	c.SP = 0xFFFE
 
-	c.Writedouble(A, F, 0x01B0)
-	c.Writedouble(B, C, 0x0013)
-	c.Writedouble(D, E, 0x00D8)
-	c.Writedouble(H, L, 0x014D)
+	c.Writedouble(A, F, state.AF)
+	c.Writedouble(B, C, state.BC)
+	c.Writedouble(D, E, state.DE)
+	c.Writedouble(H, L, state.HL)
 
 	c.haltMode = 0
 
-	if debug {
-		c.debugger = NewDebugHarness()
-	}
-
 	return c
 }
 
+// readMemory reads memory as part of an instruction, the rest of the system is advanced by one M-cycle first
 func (c *CPU) readMemory(address uint16) byte {
-	return c.mmu.readMemory(address)
+	c.tick()
+	c.mmu.oamBug(address, oamBugRead)
+	return c.mmu.cpuReadMemory(address)
+}
+
+// readMemoryIncDec is a read where the address register is incremented or decremented in the same M-cycle
+func (c *CPU) readMemoryIncDec(address uint16) byte {
+	c.tick()
+	c.mmu.oamBug(address, oamBugReadIncDec)
+	return c.mmu.cpuReadMemory(address)
 }
 
+// writeMemory writes memory as part of an instruction, the rest of the system is advanced by one M-cycle first
 func (c *CPU) writeMemory(address uint16, value byte) {
-	c.mmu.writeMemory(address, value)
+	c.tick()
+	c.mmu.oamBug(address, oamBugWrite)
+	c.mmu.cpuWriteMemory(address, value)
+}
+
+// incDec is an internal M-cycle where a 16 bit register is incremented or decremented, e.g. INC rr
+// the register is put on the address bus, which matters for the OAM corruption bug
+func (c *CPU) incDec(address uint16) {
+	c.tick()
+	c.mmu.oamBug(address, oamBugWrite)
 }
 
-func (c *CPU) RunSync(allowance int) {
-	var increment uint64
-	for cycle := 0; cycle+int(increment) < allowance; cycle += int(increment) {
-		if c.debugger != nil && c.haltMode == 0 {
-			c.debugger.PrintDebug(c)
-		}
+// tick advances the OAM DMA, timer, serial port, cartridge clock and camera, APU and PPU by one M-cycle
+// in CGB double speed mode, the APU and PPU only advance by half as much, the timer is not affected
+func (c *CPU) tick() {
+	c.instructionCycles += 4
 
-		c.CheckAndHandleInterrupts()
+	c.mmu.stepOAMDMA()
 
-		if c.haltMode == 0 {
-			pcIncrement, cycleIncrement := c.DecodeAndExecuteNext()
-			c.PC += uint16(pcIncrement)
-			increment = uint64(cycleIncrement)
-		} else {
-			increment = 4
-		}
+	c.cycleCounter += 4
+	c.mmu.timer.Tick()
+	c.mmu.serial.Tick(c.mmu.timer.counter)
 
-		for i := 0; i < int(increment); i++ {
-			c.apu.StepAPU()
-		}
+	dots := 4
+	if c.mmu.isDoubleSpeed() {
+		dots = 2
+	}
+
+	if c.mmu.clock != nil {
+		c.mmu.clock.tick(dots)
+	}
+	if c.mmu.camera != nil {
+		c.mmu.camera.tick(dots)
+	}
+
+	for i := 0; i < dots; i++ {
+		c.apu.StepAPU()
+	}
+	c.ppu.Step(dots)
+}
+
+// Step runs a single instruction
+// while halted or stopped by a CGB VRAM DMA, only a single M-cycle passes
+func (c *CPU) Step() {
+	if c.mmu.stallCycles > 0 {
+		c.mmu.stallCycles -= 4
+		c.tick()
+		return
+	}
+
+	if c.debugger != nil && c.haltMode == 0 {
+		c.debugger.PrintDebug(c)
+	}
 
-		for inc := 0; inc < int(increment); inc += 4 {
-			c.cycleCounter += 4
-			c.checkForTimerIncrementAndInterrupt()
-		}
+	c.CheckAndHandleInterrupts()
+
+	if c.haltMode != 0 {
+		c.tick()
+		return
+	}
+
+	c.instructionCycles = 0
+	pcIncrement, cycleIncrement := c.DecodeAndExecuteNext()
+	c.PC += uint16(pcIncrement)
+
+	// internal cycles which do not access memory, e.g. at the end of a jump
+	for c.instructionCycles < cycleIncrement {
+		c.tick()
 	}
 }
 
+// fetchOperands reads the immediate operands of the instruction at PC, one M-cycle per byte
+func (c *CPU) fetchOperands(op byte) (byte, byte) {
+	var second, third byte
+	if instructionLengths[op] > 1 {
+		second = c.readMemory(c.PC + 1)
+	}
+	if instructionLengths[op] > 2 {
+		third = c.readMemory(c.PC + 2)
+	}
+	return second, third
+}
+
 // DecodeAndExecuteNext fetches next instruction from memory stored at PC
 func (c *CPU) DecodeAndExecuteNext() (pcIncrement, cycleIncrement int) {
 	op := c.readMemory(c.PC)
@@ -94,8 +186,7 @@ func (c *CPU) DecodeAndExecuteNext() (pcIncrement, cycleIncrement int) {
 
 	switch {
 	case oprow <= 3:
-		second := c.readMemory(c.PC + 1)
-		third := c.readMemory(c.PC + 2)
+		second, third := c.fetchOperands(op)
 		// various instructions
 		return c.DecodeVariousUpper(op, second, third)
 	case oprow <= 7:
@@ -105,9 +196,17 @@ func (c *CPU) DecodeAndExecuteNext() (pcIncrement, cycleIncrement int) {
 		// various ALU inctructions
 		return 1, c.DecodeArith(op)
 	default:
-		second := c.readMemory(c.PC + 1)
-		third := c.readMemory(c.PC + 2)
+		second, third := c.fetchOperands(op)
 		// various instructions
 		return c.DecodeVariousLower(op, second, third)
 	}
 }
+
+// stop implements the STOP instruction
+// on CGB, this is used to switch between normal and double speed mode
+func (c *CPU) stop() {
+	c.mmu.timer.ResetDIV()
+	if c.mmu.isSpeedSwitchArmed() {
+		c.mmu.switchSpeed()
+	}
+}
@@ -208,11 +208,12 @@ func (c *CPU) Inc(r Register) {
 // IncHL implements 8-bit increment on (HL)
 func (c *CPU) IncHL() {
 	HL := c.ReadHL()
-	res := c.readMemory(HL) + 1
+	value := c.readMemory(HL)
+	res := value + 1
 
 	c.MaybeFlagSetter(res == 0, ZFlag)
 	c.ResetFlag(NFlag)
-	c.MaybeFlagSetter(c.readMemory(HL)&0xF > res&0xF, HFlag)
+	c.MaybeFlagSetter(value&0xF > res&0xF, HFlag)
 	// C not affected
 
 	c.writeMemory(HL, res)
@@ -235,11 +236,12 @@ func (c *CPU) Dec(r Register) {
 func (c *CPU) DecHL() {
 
 	HL := c.ReadHL()
-	res := c.readMemory(HL) - 1
+	value := c.readMemory(HL)
+	res := value - 1
 
 	c.MaybeFlagSetter(res == 0, ZFlag)
 	c.SetFlag(NFlag)
-	c.MaybeFlagSetter(c.readMemory(HL)&0xF < res&0xF, HFlag)
+	c.MaybeFlagSetter(value&0xF < res&0xF, HFlag)
 	// C not affected
 
 	c.writeMemory(HL, res)
@@ -13,6 +13,9 @@ func NewTestCPU() *CPU {
 	// reset all flags
 	cpu.reg[F] = 0
 
+	// no pending interrupts
+	cpu.writeMemory(0xFF0F, 0)
+
 	return cpu
 }
 
@@ -1,15 +1,20 @@
 package backend
 
 import (
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 const (
-	blargg = "../rom/cpu_instrs.gb"
-	timing = "../rom/instr_timing.gb"
-	wario  = "../rom/wario_walking_demo.gb"
+	blargg     = "../rom/cpu_instrs.gb"
+	timing     = "../rom/instr_timing.gb"
+	memTiming  = "../rom/mem_timing.gb"
+	memTiming2 = "../rom/mem_timing-2.gb"
+	oamBug     = "../rom/oam_bug.gb"
+	wario      = "../rom/wario_walking_demo.gb"
 )
 
 func AssertNoAllocations(t *testing.T, f func()) {
@@ -43,7 +48,7 @@ func TestRunBlarggTests(t *testing.T) {
 
 	// emulator state should be always exactly the same after the test passes
 	assert.Equal(t, uint16(0x06F1), cpu.PC)
-	assert.Equal(t, uint64(0xe023860), cpu.cycleCounter)
+	assert.Equal(t, uint64(0xe0375d4), cpu.cycleCounter)
 
 	assert.Equal(t, EXPECTED_SUCCESS_LOG, logger.contents)
 
@@ -68,7 +73,42 @@ func TestRunInstrTimingTest(t *testing.T) {
 
 	// emulator state should be always exactly the same after the test passes
 	assert.Equal(t, uint16(0xc8b0), cpu.PC)
-	assert.Equal(t, uint64(0x2b8178), cpu.cycleCounter)
+	assert.Equal(t, uint64(0x2be5b0), cpu.cycleCounter)
+}
+
+const MEM_TIMING_SUCCESS_LOG = "mem_timing\n\n01:ok  02:ok  03:ok  \n\nPassed all tests\n"
+
+// runBlarggLogTest runs the rom until it reports its result on the serial port
+// the mem_timing and oam_bug roms are not checked in, the tests are skipped if they are missing
+func runBlarggLogTest(t *testing.T, path, expectedLog string) {
+	if _, err := os.Stat(path); err != nil {
+		t.Skipf("%s not available", path)
+	}
+
+	emulator, logger := Init(path)
+
+	cpu := emulator.cpu
+
+	for !strings.Contains(logger.contents, "Passed") && !strings.Contains(logger.contents, "Failed") &&
+		cpu.cycleCounter < 500000000 {
+		emulator.RunForAFrame()
+	}
+
+	assert.Equal(t, expectedLog, logger.contents)
+}
+
+func TestRunMemTimingTest(t *testing.T) {
+	runBlarggLogTest(t, memTiming, MEM_TIMING_SUCCESS_LOG)
+}
+
+func TestRunMemTiming2Test(t *testing.T) {
+	runBlarggLogTest(t, memTiming2, MEM_TIMING_SUCCESS_LOG)
+}
+
+const OAM_BUG_SUCCESS_LOG = "oam_bug\n\n01:ok  02:ok  03:ok  04:ok  05:ok  06:ok  07:ok  08:ok  \n\nPassed all tests\n"
+
+func TestRunOAMBugTest(t *testing.T) {
+	runBlarggLogTest(t, oamBug, OAM_BUG_SUCCESS_LOG)
 }
 
 func BenchmarkRunEmulatorForAFrame(b *testing.B) {
@@ -6,6 +6,28 @@ package backend
 // opcode explanations
 // http://www.chrisantonellis.com/files/gameboy/gb-instructions.txt
 
+// instructionLengths contains the length in bytes of each instruction, including the opcode
+// the byte following the CB prefix is counted as an operand
+// STOP is counted as a single byte since its second byte is skipped without being read
+var instructionLengths = [256]byte{
+	1, 3, 1, 1, 1, 1, 2, 1, 3, 1, 1, 1, 1, 1, 2, 1, // 0_
+	1, 3, 1, 1, 1, 1, 2, 1, 2, 1, 1, 1, 1, 1, 2, 1, // 1_
+	2, 3, 1, 1, 1, 1, 2, 1, 2, 1, 1, 1, 1, 1, 2, 1, // 2_
+	2, 3, 1, 1, 1, 1, 2, 1, 2, 1, 1, 1, 1, 1, 2, 1, // 3_
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, // 4_
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, // 5_
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, // 6_
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, // 7_
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, // 8_
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, // 9_
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, // A_
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, // B_
+	1, 1, 3, 3, 3, 1, 2, 1, 1, 1, 3, 2, 3, 3, 2, 1, // C_
+	1, 1, 3, 1, 3, 1, 2, 1, 1, 1, 3, 1, 3, 1, 2, 1, // D_
+	2, 1, 1, 1, 1, 1, 2, 1, 2, 1, 3, 1, 1, 1, 2, 1, // E_
+	2, 1, 1, 1, 1, 1, 2, 1, 2, 1, 3, 1, 1, 1, 2, 1, // F_
+}
+
 //////////////////
 // VariousUpper //
 //////////////////
@@ -23,7 +45,7 @@ func (c *CPU) DecodeVariousUpper(first, second, third byte) (pcIncrement, cycleI
 			// panic("No Op - Unimplemented")
 			return 1, 4
 		case 1: // STOP
-			// fmt.Println("Warning: Got STOP instruction, this is probably a bug")
+			c.stop()
 			return 2, 4
 		case 2: // JR NZ,r8
 			return c.JumpRelativeNZ(second)
@@ -60,12 +82,16 @@ func (c *CPU) DecodeVariousUpper(first, second, third byte) (pcIncrement, cycleI
 	case 3:
 		switch oprow {
 		case 0: // INC BC
+			c.incDec(c.ReadBC())
 			c.IncRegs(B, C)
 		case 1: // INC DE
+			c.incDec(c.ReadDE())
 			c.IncRegs(D, E)
 		case 2: // INC HL
+			c.incDec(c.ReadHL())
 			c.IncRegs(H, L)
 		case 3: // INC SP
+			c.incDec(c.SP)
 			c.IncSP()
 		}
 		return 1, 8
@@ -163,22 +189,26 @@ func (c *CPU) DecodeVariousUpper(first, second, third byte) (pcIncrement, cycleI
 		case 1: // LD A, (DE)
 			c.Load(A, c.readMemory(c.ReadDE()))
 		case 2: // LD A, (HL+)
-			c.Load(A, c.readMemory(c.ReadHL()))
+			c.Load(A, c.readMemoryIncDec(c.ReadHL()))
 			c.IncRegs(H, L)
 		case 3: // LD A, (HL-)
-			c.Load(A, c.readMemory(c.ReadHL()))
+			c.Load(A, c.readMemoryIncDec(c.ReadHL()))
 			c.DecRegs(H, L)
 		}
 		return 1, 8
 	case 11:
 		switch oprow {
 		case 0: // DEC BC
+			c.incDec(c.ReadBC())
 			c.DecRegs(B, C)
 		case 1: // DEC DE
+			c.incDec(c.ReadDE())
 			c.DecRegs(D, E)
 		case 2: // DEC HL
+			c.incDec(c.ReadHL())
 			c.DecRegs(H, L)
 		case 3: // DEC SP
+			c.incDec(c.SP)
 			c.DecSP()
 		}
 		return 1, 8
@@ -10,8 +10,9 @@ var (
 // Bit 3: Serial   Interrupt Request (INT 58h)  (1=Request)
 // Bit 4: Joypad   Interrupt Request (INT 60h)  (1=Request)
 
+// only the lower 5 bits of IF and IE are used
 func (c *CPU) getInterruptRegisters() (byte, byte) {
-	return c.readMemory(0xFF0F), c.readMemory(0xFFFF)
+	return c.mmu.readMemory(0xFF0F) & 0x1F, c.mmu.readMemory(0xFFFF) & 0x1F
 }
 
 func (c *CPU) CheckAndHandleInterrupts() {
@@ -32,13 +33,16 @@ func (c *CPU) CheckAndHandleInterrupts() {
 		if IF&IE&mask > 0 {
 			c.IME = false
 
-			c.writeMemory(0xFF0F, c.readMemory(0xFF0F)&^mask)
+			c.mmu.writeMemory(0xFF0F, c.mmu.readMemory(0xFF0F)&^mask)
 
 			// we are either not halted
 			// or halted but will handle interrupt (i.e. mode 1)
 			// either way PC points to next instruction
+			// dispatching takes 5 M-cycles: 2 internal cycles (one in push2), 2 writes and setting PC
+			c.tick()
 			c.pushPC()
 			c.PC = handlerAddresses[n]
+			c.tick()
 
 			// remove halted status
 			c.haltMode = 0
@@ -48,49 +52,6 @@ func (c *CPU) CheckAndHandleInterrupts() {
 	}
 }
 
-func tacToPeriod(tac byte) uint64 {
-	switch tac & 0x3 {
-	case 0:
-		return 1024
-	case 1:
-		return 16
-	case 2:
-		return 64
-	case 3:
-		return 256
-	default:
-		panic("Unreachable")
-	}
-}
-
-func (c *CPU) checkForTimerIncrementAndInterrupt() {
-
-	c.writeMemory(0xFF04, byte(c.cycleCounter>>8))
-
-	tac := c.readMemory(0xFF07)
-
-	if tac&0x4 == 0 {
-		return
-	}
-
-	timerPeriod := tacToPeriod(tac)
-	modulo := c.cycleCounter & (timerPeriod - 1)
-	if modulo > 0 {
-		return
-	}
-
-	if c.readMemory(0xFF05) == 0xFF {
-
-		// write TMA into TIMA
-		c.writeMemory(0xFF05, c.readMemory(0xFF06))
-
-		// write to IF to signal interrupt
-		c.writeMemory(0xFF0F, c.readMemory(0xFF0F)|0x4)
-	} else {
-		c.writeMemory(0xFF05, c.readMemory(0xFF05)+1)
-	}
-}
-
 func (c *CPU) halt() {
 	if c.IME {
 		c.haltMode = 1
@@ -41,8 +41,8 @@ func TestLoadHigh(t *testing.T) {
 	assert.Equal(t, c.reg[A], byte(10))
 
 	c.reg[A] = 100
-	c.StoreHigh(0x50)
-	assert.Equal(t, c.readMemory(0xFF50), byte(100))
+	c.StoreHigh(0x80)
+	assert.Equal(t, c.readMemory(0xFF80), byte(100))
 }
 
 func TestPushPC(t *testing.T) {
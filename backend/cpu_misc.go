@@ -2,7 +2,9 @@ package backend
 
 ///// PUSH & POP /////
 
+// push2 takes 3 M-cycles, SP is decremented in an internal cycle before the writes
 func (c *CPU) push2(h, l byte) {
+	c.incDec(c.SP)
 	c.SP--
 	c.writeMemory(c.SP, h)
 	c.SP--
@@ -10,9 +12,9 @@ func (c *CPU) push2(h, l byte) {
 }
 
 func (c *CPU) pop2() (byte, byte) {
-	l := c.readMemory(c.SP)
+	l := c.readMemoryIncDec(c.SP)
 	c.SP++
-	h := c.readMemory(c.SP)
+	h := c.readMemoryIncDec(c.SP)
 	c.SP++
 	return h, l
 }
@@ -142,6 +144,7 @@ func (c *CPU) Ret() {
 
 // RetNZ return if not zero
 func (c *CPU) RetNZ() (pcInc, cycleInc int) {
+	c.tick() // checking the condition takes an M-cycle
 	if !c.IsFlagSet(ZFlag) {
 		c.Ret()
 		return 0, 20
@@ -153,6 +156,7 @@ func (c *CPU) RetNZ() (pcInc, cycleInc int) {
 
 // RetZ return if zero
 func (c *CPU) RetZ() (pcInc, cycleInc int) {
+	c.tick() // checking the condition takes an M-cycle
 	if c.IsFlagSet(ZFlag) {
 		c.Ret()
 		return 0, 20
@@ -163,6 +167,7 @@ func (c *CPU) RetZ() (pcInc, cycleInc int) {
 
 // RetNC return if not carry
 func (c *CPU) RetNC() (pcInc, cycleInc int) {
+	c.tick() // checking the condition takes an M-cycle
 	if !c.IsFlagSet(CFlag) {
 		c.Ret()
 		return 0, 20
@@ -173,6 +178,7 @@ func (c *CPU) RetNC() (pcInc, cycleInc int) {
 
 // RetC return if carry
 func (c *CPU) RetC() (pcInc, cycleInc int) {
+	c.tick() // checking the condition takes an M-cycle
 	if c.IsFlagSet(CFlag) {
 		c.Ret()
 		return 0, 20
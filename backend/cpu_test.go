@@ -0,0 +1,106 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// NewTimingTestCPU returns a cpu with the timer incrementing every 16 M-cycles
+// with TIMA incrementing on the given M-cycle of the next instruction
+func NewTimingTestCPU(program []byte, incrementOnCycle int) *CPU {
+	c := NewTestCPU()
+
+	c.PC = 0xC000
+	for i, b := range program {
+		c.mmu.writeMemory(0xC000+uint16(i), b)
+	}
+
+	c.mmu.writeMemory(0xFF07, 0b110) // TAC
+	c.mmu.writeMemory(0xFF05, 0)     // TIMA
+	c.mmu.timer.counter = uint16(64 - 4*incrementOnCycle)
+
+	return c
+}
+
+func TestReadHappensOnLastMCycle(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		program []byte
+		cycles  int
+	}{
+		{"LD A,(HL)", []byte{0x7E}, 2},
+		{"LDH A,(a8)", []byte{0xF0, 0x05}, 3},
+		{"LD A,(a16)", []byte{0xFA, 0x05, 0xFF}, 4},
+	} {
+		// TIMA increments just before the read
+		c := NewTimingTestCPU(test.program, test.cycles)
+		c.Writedouble(H, L, 0xFF05)
+		c.Step()
+		assert.Equal(t, byte(1), c.reg[A], test.name)
+
+		// TIMA increments just after the read
+		c = NewTimingTestCPU(test.program, test.cycles+1)
+		c.Writedouble(H, L, 0xFF05)
+		c.Step()
+		assert.Equal(t, byte(0), c.reg[A], test.name)
+		assert.Equal(t, uint16(0xC000+len(test.program)), c.PC, test.name)
+	}
+}
+
+func TestReadModifyWriteTiming(t *testing.T) {
+	// INC (HL): read on M-cycle 2, write on M-cycle 3
+	c := NewTimingTestCPU([]byte{0x34}, 2)
+	c.Writedouble(H, L, 0xFF05)
+	c.Step()
+	assert.Equal(t, byte(2), c.mmu.readMemory(0xFF05))
+
+	// the timer increment on M-cycle 3 is overwritten by the write
+	c = NewTimingTestCPU([]byte{0x34}, 3)
+	c.Writedouble(H, L, 0xFF05)
+	c.Step()
+	assert.Equal(t, byte(1), c.mmu.readMemory(0xFF05))
+}
+
+func TestInstructionsTakeTheirCycleCount(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		program []byte
+		cycles  uint64
+	}{
+		{"NOP", []byte{0x00}, 4},
+		{"JP a16", []byte{0xC3, 0x00, 0xC0}, 16},
+		{"PUSH BC", []byte{0xC5}, 16},
+		{"CALL a16", []byte{0xCD, 0x00, 0xC0}, 24},
+		{"RET NZ (taken)", []byte{0xC0}, 20},
+		{"RET Z (not taken)", []byte{0xC8}, 8},
+		{"INC (HL)", []byte{0x34}, 12},
+		{"LD (a16),SP", []byte{0x08, 0x00, 0xC1}, 20},
+		{"SET 0,(HL)", []byte{0xCB, 0xC6}, 16},
+		{"BIT 0,(HL)", []byte{0xCB, 0x46}, 12},
+	} {
+		c := NewTimingTestCPU(test.program, 0)
+		c.Writedouble(H, L, 0xC100)
+		c.SP = 0xD000
+		c.cycleCounter = 0
+		c.Step()
+		assert.Equal(t, test.cycles, c.cycleCounter, test.name)
+	}
+}
+
+func TestInterruptDispatchTakesFiveMCycles(t *testing.T) {
+	c := NewTestCPU()
+	c.PC = 0xC000
+	c.SP = 0xD000
+	c.IME = true
+	c.mmu.writeMemory(0xFFFF, 0x1)
+	c.mmu.writeMemory(0xFF0F, 0x1)
+
+	c.cycleCounter = 0
+	c.Step()
+
+	// dispatch, then the NOP at the handler address
+	assert.Equal(t, uint64(20+4), c.cycleCounter)
+	assert.Equal(t, uint16(0x41), c.PC)
+	assert.Equal(t, uint16(0xC000), PackBytes(c.mmu.readMemory(0xCFFF), c.mmu.readMemory(0xCFFE)))
+}
@@ -70,19 +70,19 @@ func NewDebugHarness() *DebugHarness {
 
 func (d *DebugHarness) PrintDebug(c *CPU) {
 	var op Opcode
-	if c.readMemory(c.PC) == 0xCB {
-		op = d.Cbprefixed[c.readMemory(c.PC+1)]
+	if c.mmu.readMemory(c.PC) == 0xCB {
+		op = d.Cbprefixed[c.mmu.readMemory(c.PC+1)]
 	} else {
-		op = d.Unprefixed[c.readMemory(c.PC)]
+		op = d.Unprefixed[c.mmu.readMemory(c.PC)]
 	}
 
 	opStr := op.String()
 
-	opStr = strings.Replace(opStr, "d8", fmt.Sprintf("0x%0.2X", c.readMemory(c.PC+1)), -1)
-	opStr = strings.Replace(opStr, "a8", fmt.Sprintf("0x%0.2X", c.readMemory(c.PC+1)), -1)
-	opStr = strings.Replace(opStr, "r8", fmt.Sprintf("0x%0.2X", c.readMemory(c.PC+1)), -1)
-	opStr = strings.Replace(opStr, "d16", fmt.Sprintf("0x%0.2X%0.2X", c.readMemory(c.PC+2), c.readMemory(c.PC+1)), -1)
-	opStr = strings.Replace(opStr, "a16", fmt.Sprintf("0x%0.2X%0.2X", c.readMemory(c.PC+2), c.readMemory(c.PC+1)), -1)
+	opStr = strings.Replace(opStr, "d8", fmt.Sprintf("0x%0.2X", c.mmu.readMemory(c.PC+1)), -1)
+	opStr = strings.Replace(opStr, "a8", fmt.Sprintf("0x%0.2X", c.mmu.readMemory(c.PC+1)), -1)
+	opStr = strings.Replace(opStr, "r8", fmt.Sprintf("0x%0.2X", c.mmu.readMemory(c.PC+1)), -1)
+	opStr = strings.Replace(opStr, "d16", fmt.Sprintf("0x%0.2X%0.2X", c.mmu.readMemory(c.PC+2), c.mmu.readMemory(c.PC+1)), -1)
+	opStr = strings.Replace(opStr, "a16", fmt.Sprintf("0x%0.2X%0.2X", c.mmu.readMemory(c.PC+2), c.mmu.readMemory(c.PC+1)), -1)
 	opStr = strings.Replace(opStr, "(HL", fmt.Sprintf("(0x%0.4X", c.ReadHL()), -1)
 
 	fmt.Printf("%20s | AF: 0x%0.4X | BC: 0x%0.4X | DE: 0x%0.4X | HL: 0x%0.4X | PC: 0x%0.4X\n",
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"fmt"
 	"image"
 	"image/png"
 	"io"
@@ -18,6 +19,20 @@ type Emulator struct {
 	enableApu bool
 	logger    Logger
 	debug     bool
+	bootRom   []byte
+	model     Model
+
+	serialPeer     SerialPeer
+	hostClock      bool
+	rumbleCallback func(on bool)
+	infraredPeer   InfraredPeer
+
+	cameraImageSource CameraImageSource
+
+	// empty if the battery backed RAM isn't saved
+	batterySavePath string
+	lastBatterySave []byte
+	frames          int
 }
 
 func (e *Emulator) SetKeyIsPressed(key string, isPressed bool) {
@@ -26,6 +41,7 @@ func (e *Emulator) SetKeyIsPressed(key string, isPressed bool) {
 
 func (e *Emulator) RunForAFrame() {
 	e.ppu.RunEmulatorForAFrame()
+	e.flushBatterySavePeriodically()
 }
 
 func (e *Emulator) GetAudioStream() io.ReadCloser {
@@ -64,6 +80,94 @@ func WithRom(path string) func(*Emulator) {
 	}
 }
 
+// WithBootRom runs the given DMG (256 bytes) or CGB (2304 bytes) boot rom before the game
+func WithBootRom(path string) func(*Emulator) {
+	return func(e *Emulator) {
+		bootRom, err := os.ReadFile(path)
+		if err != nil {
+			panic(err)
+		}
+		if len(bootRom) != DMG_BOOT_ROM_SIZE && len(bootRom) != CGB_BOOT_ROM_SIZE {
+			panic(fmt.Sprintf("Got boot rom of size %d, expected %d (DMG) or %d (CGB)",
+				len(bootRom), DMG_BOOT_ROM_SIZE, CGB_BOOT_ROM_SIZE))
+		}
+		e.bootRom = bootRom
+	}
+}
+
+// WithModel selects the hardware model to emulate, see Model
+func WithModel(model Model) func(*Emulator) {
+	return func(e *Emulator) {
+		e.model = model
+	}
+}
+
+// GetModel returns the hardware model being emulated
+func (e *Emulator) GetModel() Model {
+	return e.model
+}
+
+// WithSerialPeer connects the given device to the link port
+// by default, the bytes sent over the link port are written to the logger
+func WithSerialPeer(peer SerialPeer) func(*Emulator) {
+	return func(e *Emulator) {
+		e.serialPeer = peer
+	}
+}
+
+// Link connects the link ports of two emulators, e.g. for two player games
+// both emulators have to be run from the same goroutine
+func (e *Emulator) Link(other *Emulator) {
+	e.SetSerialPeer(other.mmu.serial)
+	other.SetSerialPeer(e.mmu.serial)
+}
+
+// SetSerialPeer connects the given device to the link port, see WithSerialPeer
+func (e *Emulator) SetSerialPeer(peer SerialPeer) {
+	e.serialPeer = peer
+	e.mmu.serial.setPeer(peer)
+}
+
+// WithHostClock makes the cartridge clock follow the host clock instead of counting emulated cycles
+// so that it keeps the right time even when the emulator doesn't run at full speed
+func WithHostClock(hostClock bool) func(*Emulator) {
+	return func(e *Emulator) {
+		e.hostClock = hostClock
+	}
+}
+
+// WithRumbleCallback calls the given function every time the rumble motor of the cartridge is turned on or off
+// games control the strength of the rumble by switching the motor many times per frame
+func WithRumbleCallback(callback func(on bool)) func(*Emulator) {
+	return func(e *Emulator) {
+		e.rumbleCallback = callback
+	}
+}
+
+// SetRumbleCallback replaces the rumble callback, see WithRumbleCallback
+func (e *Emulator) SetRumbleCallback(callback func(on bool)) {
+	e.rumbleCallback = callback
+	if r, ok := e.mbc.(rumbleMBC); ok {
+		r.setRumbleCallback(callback)
+	}
+}
+
+// IsRumbling returns whether the rumble motor of the cartridge is on
+func (e *Emulator) IsRumbling() bool {
+	if r, ok := e.mbc.(rumbleMBC); ok {
+		return r.rumbling()
+	}
+	return false
+}
+
+// SetTilt sets how much the cartridge is tilted for games with an accelerometer, in g
+// x and y are the tilt along the horizontal and vertical axes of the screen, 0 when the cartridge lies flat
+func (e *Emulator) SetTilt(x, y float64) {
+	if m, ok := e.mbc.(*MBC7); ok {
+		m.setTilt(x, y)
+	}
+}
+
 func WithAudio(audio bool) func(*Emulator) {
 	return func(e *Emulator) {
 		e.enableApu = audio
@@ -71,7 +175,8 @@ func WithAudio(audio bool) func(*Emulator) {
 }
 
 func NewTestMBC() MBC {
-	return NewMBC0(make([]byte, 1<<15))
+	rom := make([]byte, 1<<15)
+	return NewMBC0(rom, ParseCartridgeHeader(rom))
 }
 
 func WithNoRom() func(*Emulator) {
@@ -99,10 +204,39 @@ func NewEmulator(options ...func(*Emulator)) *Emulator {
 		apu.Disable()
 	}
 
-	mmu := NewMMU(ram, emu.mbc, emu.logger, apu.AudioRegisterWriteCallback)
+	model, cgb := resolveModel(emu.model, emu.mbc, emu.bootRom)
+	emu.model = model
+
+	mmu := NewMMU(ram, model, cgb, emu.mbc, emu.logger, apu.AudioRegisterWriteCallback)
+	mmu.bootRom = emu.bootRom
+	if emu.serialPeer != nil {
+		mmu.serial.setPeer(emu.serialPeer)
+	}
+	if mmu.clock != nil {
+		mmu.clock.setHostClock(emu.hostClock)
+	}
+	if r, ok := emu.mbc.(rumbleMBC); ok {
+		r.setRumbleCallback(emu.rumbleCallback)
+	}
+	if m, ok := emu.mbc.(infraredMBC); ok {
+		m.setInfraredPeer(emu.infraredPeer)
+	}
+	if m, ok := emu.mbc.(*Camera); ok {
+		m.setImageSource(emu.cameraImageSource)
+	}
+	if emu.batterySavePath != "" && hasBattery(emu.mbc) {
+		loadBatterySave(emu.mbc, emu.batterySavePath)
+	}
 
 	cpu := NewCPU(emu.debug, apu, mmu)
-	ppu := NewPPU(ram, cpu.RunSync)
+	ppu := NewPPU(mmu, cpu.Step)
+	cpu.ppu = ppu
+
+	// when running a boot rom, the PPU starts with the LCD off
+	if mmu.bootRom == nil {
+		state := getPowerUpState(model, cgb, emu.mbc.ReadMemory(0x14D))
+		ppu.setPowerUpPosition(state.Line, state.Dot)
+	}
 
 	emu.ppu = ppu
 	emu.cpu = cpu
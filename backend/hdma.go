@@ -0,0 +1,80 @@
+package backend
+
+// CGB VRAM DMA
+// the transfer state is kept in the registers themselves:
+// HDMA1-4 are used as the source/destination counters (they read back as 0xFF)
+// HDMA5 holds the number of remaining blocks minus one, bit 7 is cleared while a HBlank transfer is active
+const (
+	HDMA1 = 0xFF51 // source, high
+	HDMA2 = 0xFF52 // source, low (lower 4 bits ignored)
+	HDMA3 = 0xFF53 // destination in VRAM, high (upper 3 bits ignored)
+	HDMA4 = 0xFF54 // destination in VRAM, low (lower 4 bits ignored)
+	HDMA5 = 0xFF55 // length/mode/start
+
+	hdmaBlockSize = 0x10
+
+	// the CPU is stopped for 8 M-cycles (in normal speed mode) for each block
+	hdmaBlockCycles = 32
+)
+
+func (m *MMU) isHBlankDMAActive() bool {
+	return m.cgb && m.ram[HDMA5]&0x80 == 0
+}
+
+func (m *MMU) writeHDMA5(value byte) {
+	if value&0x80 > 0 {
+		// HBlank DMA: transfer a block at the start of every HBlank
+		m.ram[HDMA5] = value & 0x7F
+
+		// if the LCD is off, the first block is transferred immediately
+		if m.ram[LCDC]&0x80 == 0 {
+			m.transferHDMABlock()
+		}
+		return
+	}
+
+	if m.isHBlankDMAActive() {
+		// writing 0 to bit 7 during a HBlank transfer cancels it
+		// the remaining length can still be read back
+		m.ram[HDMA5] |= 0x80
+		return
+	}
+
+	// general purpose DMA: transfer everything at once
+	m.ram[HDMA5] = value & 0x7F
+	for m.ram[HDMA5]&0x80 == 0 {
+		m.transferHDMABlock()
+	}
+}
+
+// transferHDMABlock copies 16 bytes to the current VRAM bank and advances the transfer
+func (m *MMU) transferHDMABlock() {
+	source := PackBytes(m.ram[HDMA1], m.ram[HDMA2]&0xF0)
+	destination := PackBytes(m.ram[HDMA3]&0x1F, m.ram[HDMA4]&0xF0)
+
+	vram := m.vram[m.vramBank()]
+	for i := uint16(0); i < hdmaBlockSize; i++ {
+		vram[(destination+i)&0x1FFF] = m.readMemory(source + i)
+	}
+
+	source += hdmaBlockSize
+	destination += hdmaBlockSize
+	m.ram[HDMA1], m.ram[HDMA2] = byte(source>>8), byte(source)
+	m.ram[HDMA3], m.ram[HDMA4] = byte(destination>>8), byte(destination)
+
+	// once the last block is transferred, this wraps around to 0xFF
+	m.ram[HDMA5]--
+
+	if m.isDoubleSpeed() {
+		m.stallCycles += 2 * hdmaBlockCycles
+	} else {
+		m.stallCycles += hdmaBlockCycles
+	}
+}
+
+// HBlank is called by the PPU when entering HBlank on a visible line
+func (m *MMU) HBlank() {
+	if m.isHBlankDMAActive() {
+		m.transferHDMABlock()
+	}
+}
@@ -0,0 +1,111 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupHDMA(c *CPU, source, destination uint16, blocks int) {
+	for i := 0; i < blocks*hdmaBlockSize; i++ {
+		c.writeMemory(source+uint16(i), byte(i+1))
+	}
+
+	c.writeMemory(HDMA1, byte(source>>8))
+	c.writeMemory(HDMA2, byte(source))
+	c.writeMemory(HDMA3, byte(destination>>8))
+	c.writeMemory(HDMA4, byte(destination))
+}
+
+func TestGeneralPurposeDMA(t *testing.T) {
+	c := NewTestCGBCPU()
+	c.writeMemory(VBK, 1)
+
+	setupHDMA(c, 0xC100, 0x8800, 3)
+	assert.Equal(t, byte(0xFF), c.readMemory(HDMA1))
+
+	c.writeMemory(HDMA5, 2)
+
+	for i := 0; i < 3*hdmaBlockSize; i++ {
+		assert.Equal(t, byte(i+1), c.mmu.readMemory(0x8800+uint16(i)))
+	}
+	assert.Equal(t, byte(0), c.mmu.ram[0x8800])
+
+	assert.Equal(t, byte(0xFF), c.readMemory(HDMA5))
+	assert.Equal(t, 3*hdmaBlockCycles, c.mmu.stallCycles)
+}
+
+func TestGeneralPurposeDMAStopsTheCPU(t *testing.T) {
+	c := NewTestCGBCPU()
+	c.PC = 0xC000
+
+	setupHDMA(c, 0xC100, 0x8000, 1)
+	c.writeMemory(HDMA5, 0)
+
+	// no instruction is executed during the 8 M-cycles of the transfer
+	for i := 0; i < hdmaBlockCycles/4; i++ {
+		c.Step()
+	}
+	assert.Equal(t, uint16(0xC000), c.PC)
+	assert.Equal(t, 0, c.mmu.stallCycles)
+
+	c.Step()
+	assert.Equal(t, uint16(0xC001), c.PC)
+
+	// takes twice as many cpu cycles in double speed mode
+	c.writeMemory(KEY1, 1)
+	c.stop()
+	c.writeMemory(HDMA5, 0)
+	assert.Equal(t, 2*hdmaBlockCycles, c.mmu.stallCycles)
+}
+
+func TestHBlankDMA(t *testing.T) {
+	c := NewTestCGBCPU()
+
+	setupHDMA(c, 0xC100, 0x9000, 2)
+	c.writeMemory(HDMA5, 0x80|1)
+	assert.Equal(t, byte(0x01), c.readMemory(HDMA5))
+	assert.Equal(t, byte(0), c.mmu.readMemory(0x9000))
+
+	c.mmu.HBlank()
+	assert.Equal(t, byte(0x00), c.readMemory(HDMA5))
+	assert.Equal(t, byte(1), c.mmu.readMemory(0x9000))
+	assert.Equal(t, byte(0), c.mmu.readMemory(0x9010))
+
+	c.mmu.HBlank()
+	assert.Equal(t, byte(0xFF), c.readMemory(HDMA5))
+	assert.Equal(t, byte(hdmaBlockSize+1), c.mmu.readMemory(0x9010))
+
+	// nothing left to transfer
+	c.mmu.HBlank()
+	assert.Equal(t, byte(0), c.mmu.readMemory(0x9020))
+}
+
+func TestHBlankDMACancel(t *testing.T) {
+	c := NewTestCGBCPU()
+
+	setupHDMA(c, 0xC100, 0x9000, 4)
+	c.writeMemory(HDMA5, 0x80|3)
+	c.mmu.HBlank()
+
+	c.writeMemory(HDMA5, 0)
+	assert.Equal(t, byte(0x82), c.readMemory(HDMA5))
+
+	c.mmu.HBlank()
+	assert.Equal(t, byte(0), c.mmu.readMemory(0x9010))
+}
+
+func TestHBlankDMADrivenByPPU(t *testing.T) {
+	emulator := NewEmulator(withCGBTestRom(), WithDisableApu())
+	c := emulator.cpu
+
+	setupHDMA(c, 0xC100, 0x8000, 8)
+	c.writeMemory(HDMA5, 0x80|7)
+
+	emulator.RunForAFrame()
+
+	assert.Equal(t, byte(0xFF), c.readMemory(HDMA5))
+	for i := 0; i < 8*hdmaBlockSize; i++ {
+		assert.Equal(t, byte(i+1), c.mmu.readMemory(0x8000+uint16(i)))
+	}
+}
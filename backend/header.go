@@ -0,0 +1,282 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	headerEnd = 0x150
+
+	// old licensee code meaning the new licensee code is used instead
+	useNewLicenseeCode = 0x33
+)
+
+// CartridgeHeader is the header found at 0x100-0x14F of every rom
+type CartridgeHeader struct {
+	Logo  [48]byte
+	Title string
+	// 4 characters at the end of the title area, only in some CGB era games
+	ManufacturerCode string
+
+	CGBFlag byte // 0x80: supports CGB functions, 0xC0: CGB only
+	SGBFlag byte // 0x03: supports SGB functions
+
+	NewLicenseeCode string // 2 characters, only used if OldLicenseeCode is 0x33
+	OldLicenseeCode byte
+
+	CartridgeType   byte
+	ROMSizeCode     byte
+	RAMSizeCode     byte
+	DestinationCode byte // 0x00: Japan, 0x01: elsewhere
+	Version         byte
+
+	HeaderChecksum byte
+	GlobalChecksum uint16
+
+	// checksums and size computed from the rom, compared to the ones in the header
+	ActualHeaderChecksum byte
+	ActualGlobalChecksum uint16
+	ActualROMSize        int
+}
+
+// ParseCartridgeHeader reads the header of a rom, a rom too short to have a header is considered padded with 0xFF
+func ParseCartridgeHeader(rom []byte) CartridgeHeader {
+	return parseCartridgeHeaderAt(rom, 0)
+}
+
+// parseCartridgeHeaderAt reads the header of the 32KB rom area starting at offset,
+// the global checksum and the size are still the ones of the whole rom
+func parseCartridgeHeaderAt(rom []byte, offset int) CartridgeHeader {
+	var h CartridgeHeader
+	h.ActualROMSize = len(rom)
+	for i, b := range rom {
+		if i != offset+0x14E && i != offset+0x14F {
+			h.ActualGlobalChecksum += uint16(b)
+		}
+	}
+
+	rom = rom[offset:]
+	if len(rom) < headerEnd {
+		rom = append(append([]byte{}, rom...), padding(headerEnd-len(rom))...)
+	}
+
+	copy(h.Logo[:], rom[0x104:0x134])
+
+	h.CGBFlag = rom[0x143]
+	h.NewLicenseeCode = string(rom[0x144:0x146])
+	h.SGBFlag = rom[0x146]
+	h.CartridgeType = rom[0x147]
+	h.ROMSizeCode = rom[0x148]
+	h.RAMSizeCode = rom[0x149]
+	h.DestinationCode = rom[0x14A]
+	h.OldLicenseeCode = rom[0x14B]
+	h.Version = rom[0x14C]
+	h.HeaderChecksum = rom[0x14D]
+	h.GlobalChecksum = uint16(rom[0x14E])<<8 | uint16(rom[0x14F])
+
+	// the title takes the whole area in older games, CGB games use the last byte as the CGB flag
+	// and can use the 4 bytes before it as the manufacturer code
+	title := rom[0x134:0x144]
+	if h.CGBFlag&0x80 > 0 {
+		title = title[:15]
+		if code := string(rom[0x13F:0x143]); isManufacturerCode(code) && rom[0x13E] == 0 {
+			h.ManufacturerCode = code
+			title = title[:11]
+		}
+	}
+	if i := strings.IndexByte(string(title), 0); i >= 0 {
+		title = title[:i]
+	}
+	h.Title = strings.TrimRight(string(title), " ")
+
+	for _, b := range rom[0x134:0x14D] {
+		h.ActualHeaderChecksum = h.ActualHeaderChecksum - b - 1
+	}
+
+	return h
+}
+
+func isManufacturerCode(code string) bool {
+	if len(code) != 4 {
+		return false
+	}
+	for _, c := range code {
+		if !('A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func padding(n int) []byte {
+	p := make([]byte, n)
+	for i := range p {
+		p[i] = 0xFF
+	}
+	return p
+}
+
+// ValidLogo checks the logo, the boot rom doesn't start the game if it is wrong
+func (h CartridgeHeader) ValidLogo() bool {
+	return h.Logo == nintendoLogo
+}
+
+// ValidTitle checks that the title is printable ASCII
+func (h CartridgeHeader) ValidTitle() bool {
+	for _, c := range []byte(h.Title) {
+		if c < 0x20 || c > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
+func (h CartridgeHeader) ValidManufacturerCode() bool {
+	return h.ManufacturerCode == "" || isManufacturerCode(h.ManufacturerCode)
+}
+
+// ValidCGBFlag accepts the CGB flags and the title characters of older games
+func (h CartridgeHeader) ValidCGBFlag() bool {
+	return h.CGBFlag < 0x80 || h.CGBFlag == 0x80 || h.CGBFlag == 0xC0
+}
+
+func (h CartridgeHeader) ValidSGBFlag() bool {
+	return h.SGBFlag == 0x00 || h.SGBFlag == 0x03
+}
+
+// ValidLicenseeCode checks the new licensee code when it is used, any old licensee code is accepted
+func (h CartridgeHeader) ValidLicenseeCode() bool {
+	if h.OldLicenseeCode != useNewLicenseeCode {
+		return true
+	}
+	for _, c := range h.NewLicenseeCode {
+		if !('A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// LicenseeCode returns the licensee code in use, as two hexadecimal digits for old licensee codes
+func (h CartridgeHeader) LicenseeCode() string {
+	if h.OldLicenseeCode == useNewLicenseeCode {
+		return h.NewLicenseeCode
+	}
+	return fmt.Sprintf("%02X", h.OldLicenseeCode)
+}
+
+// ValidCartridgeType checks that the cartridge type is a documented one, even if it isn't emulated
+func (h CartridgeHeader) ValidCartridgeType() bool {
+	switch h.CartridgeType {
+	case 0x00, 0x01, 0x02, 0x03, 0x05, 0x06, 0x08, 0x09, 0x0B, 0x0C, 0x0D,
+		0x0F, 0x10, 0x11, 0x12, 0x13, 0x19, 0x1A, 0x1B, 0x1C, 0x1D, 0x1E,
+		0x20, 0x22, 0xFC, 0xFD, 0xFE, 0xFF:
+		return true
+	}
+	return false
+}
+
+func (h CartridgeHeader) ValidROMSize() bool {
+	return h.ROMSizeCode <= 8
+}
+
+// ROMSize returns the rom size declared by the header, 0 if the size code is invalid
+func (h CartridgeHeader) ROMSize() int {
+	if !h.ValidROMSize() {
+		return 0
+	}
+	return (1 << 15) << h.ROMSizeCode
+}
+
+func (h CartridgeHeader) ValidRAMSize() bool {
+	return h.RAMSizeCode <= 5
+}
+
+// RAMSize returns the RAM size declared by the header, 0 if the size code is invalid
+func (h CartridgeHeader) RAMSize() int {
+	switch h.RAMSizeCode {
+	case 1:
+		return 1 << 11
+	case 2:
+		return 1 << 13
+	case 3:
+		return 1 << 15
+	case 4:
+		return 1 << 17
+	case 5:
+		return 1 << 16
+	default:
+		return 0
+	}
+}
+
+// ValidHeaderChecksum checks the checksum of 0x134-0x14C, the boot rom doesn't start the game if it is wrong
+func (h CartridgeHeader) ValidHeaderChecksum() bool {
+	return h.HeaderChecksum == h.ActualHeaderChecksum
+}
+
+// ValidGlobalChecksum checks the checksum of the whole rom, which isn't checked by the hardware
+func (h CartridgeHeader) ValidGlobalChecksum() bool {
+	return h.GlobalChecksum == h.ActualGlobalChecksum
+}
+
+// Validate returns an error listing the invalid fields of the header, nil if they are all valid
+func (h CartridgeHeader) Validate() error {
+	checks := []struct {
+		valid bool
+		field string
+	}{
+		{h.ValidLogo(), "logo"},
+		{h.ValidTitle(), fmt.Sprintf("title %q", h.Title)},
+		{h.ValidManufacturerCode(), fmt.Sprintf("manufacturer code %q", h.ManufacturerCode)},
+		{h.ValidCGBFlag(), fmt.Sprintf("CGB flag 0x%02X", h.CGBFlag)},
+		{h.ValidSGBFlag(), fmt.Sprintf("SGB flag 0x%02X", h.SGBFlag)},
+		{h.ValidLicenseeCode(), fmt.Sprintf("new licensee code %q", h.NewLicenseeCode)},
+		{h.ValidCartridgeType(), fmt.Sprintf("cartridge type 0x%02X", h.CartridgeType)},
+		{h.ValidROMSize(), fmt.Sprintf("rom size code 0x%02X", h.ROMSizeCode)},
+		{!h.ValidROMSize() || h.ROMSize() == h.ActualROMSize, fmt.Sprintf("rom size %d, the rom has %d bytes", h.ROMSize(), h.ActualROMSize)},
+		{h.ValidRAMSize(), fmt.Sprintf("RAM size code 0x%02X", h.RAMSizeCode)},
+		{h.ValidHeaderChecksum(), fmt.Sprintf("header checksum 0x%02X, expected 0x%02X", h.HeaderChecksum, h.ActualHeaderChecksum)},
+		{h.ValidGlobalChecksum(), fmt.Sprintf("global checksum 0x%04X, expected 0x%04X", h.GlobalChecksum, h.ActualGlobalChecksum)},
+	}
+
+	var invalid []string
+	for _, c := range checks {
+		if !c.valid {
+			invalid = append(invalid, c.field)
+		}
+	}
+	if len(invalid) == 0 {
+		return nil
+	}
+	return errors.New("invalid cartridge header: " + strings.Join(invalid, ", "))
+}
+
+// fitROM returns the rom resized to a whole number of banks matching the header where possible:
+// trimmed roms are padded with 0xFF up to a power of two, then mirrored up to the declared size
+// like the address lines of a smaller rom chip would, larger roms are kept whole
+func fitROM(rom []byte, header CartridgeHeader) []byte {
+	size := 1 << 15
+	for size < len(rom) {
+		size <<= 1
+	}
+	if len(rom) == size && size >= header.ROMSize() {
+		return rom
+	}
+
+	capacity := size
+	if header.ROMSize() > size {
+		capacity = header.ROMSize()
+	}
+
+	fitted := make([]byte, size, capacity)
+	copy(fitted, rom)
+	copy(fitted[len(rom):], padding(size-len(rom)))
+
+	for len(fitted) < cap(fitted) {
+		fitted = append(fitted, fitted...)
+	}
+	return fitted
+}
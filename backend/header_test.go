@@ -0,0 +1,164 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// makeHeaderRom returns a 64KB MBC1 rom with a valid header
+func makeHeaderRom() []byte {
+	rom := makeRom()
+	rom[0x147] = 0x01
+	copy(rom[0x104:], nintendoLogo[:])
+	copy(rom[0x134:], "POKEMON")
+	copy(rom[0x13F:], "APSE")
+	rom[0x143] = 0x80
+	copy(rom[0x144:], "01")
+	rom[0x146] = 0x03
+	rom[0x14A] = 0x01
+	rom[0x14B] = 0x33
+	rom[0x14C] = 0x02
+	rom[0x8000] = 0x12
+	fixChecksums(rom)
+	return rom
+}
+
+func fixChecksums(rom []byte) {
+	header := ParseCartridgeHeader(rom)
+	rom[0x14D] = header.ActualHeaderChecksum
+	// the global checksum includes the header checksum
+	header = ParseCartridgeHeader(rom)
+	rom[0x14E] = byte(header.ActualGlobalChecksum >> 8)
+	rom[0x14F] = byte(header.ActualGlobalChecksum)
+}
+
+func TestParseCartridgeHeader(t *testing.T) {
+	header := ParseCartridgeHeader(makeHeaderRom())
+
+	assert.Equal(t, "POKEMON", header.Title)
+	assert.Equal(t, "APSE", header.ManufacturerCode)
+	assert.Equal(t, byte(0x80), header.CGBFlag)
+	assert.Equal(t, byte(0x03), header.SGBFlag)
+	assert.Equal(t, "01", header.LicenseeCode())
+	assert.Equal(t, byte(0x01), header.CartridgeType)
+	assert.Equal(t, 1<<16, header.ROMSize())
+	assert.Equal(t, 1<<11, header.RAMSize())
+	assert.Equal(t, byte(0x01), header.DestinationCode)
+	assert.Equal(t, byte(0x02), header.Version)
+	assert.NoError(t, header.Validate())
+
+	// older games use the whole title area
+	rom := makeHeaderRom()
+	copy(rom[0x134:], "SUPER MARIOLAND ")
+	rom[0x14B] = 0x01
+	header = ParseCartridgeHeader(rom)
+	assert.Equal(t, "SUPER MARIOLAND", header.Title)
+	assert.Equal(t, "", header.ManufacturerCode)
+	assert.Equal(t, "01", header.LicenseeCode())
+	assert.True(t, header.ValidCGBFlag())
+}
+
+func TestValidateCartridgeHeader(t *testing.T) {
+	rom := makeHeaderRom()
+	rom[0x104] = 0
+	rom[0x134] = 0x01
+	rom[0x143] = 0x90
+	copy(rom[0x144:], "a!")
+	rom[0x146] = 0x01
+	rom[0x147] = 0x04
+	rom[0x148] = 0x20
+	rom[0x149] = 0x07
+
+	header := ParseCartridgeHeader(rom)
+	assert.False(t, header.ValidLogo())
+	assert.False(t, header.ValidTitle())
+	assert.False(t, header.ValidCGBFlag())
+	assert.False(t, header.ValidSGBFlag())
+	assert.False(t, header.ValidLicenseeCode())
+	assert.False(t, header.ValidROMSize())
+	assert.Equal(t, 0, header.ROMSize())
+	assert.False(t, header.ValidRAMSize())
+	assert.Equal(t, 0, header.RAMSize())
+	assert.False(t, header.ValidHeaderChecksum())
+	assert.False(t, header.ValidGlobalChecksum())
+
+	err := header.Validate()
+	assert.Error(t, err)
+	for _, field := range []string{"logo", "title", "CGB flag 0x90", "SGB flag 0x01", "licensee", "cartridge type 0x04", "rom size code 0x20", "RAM size code 0x07", "header checksum", "global checksum"} {
+		assert.Contains(t, err.Error(), field)
+	}
+
+	// the global checksum isn't checked by the hardware, fixing the header checksum is enough to boot
+	rom = makeHeaderRom()
+	rom[0x8000] = 0x34
+	header = ParseCartridgeHeader(rom)
+	assert.True(t, header.ValidHeaderChecksum())
+	assert.False(t, header.ValidGlobalChecksum())
+
+	// the rom size is compared to the size of the rom
+	rom = makeHeaderRom()
+	rom[0x148] = 2
+	fixChecksums(rom)
+	assert.EqualError(t, ParseCartridgeHeader(rom).Validate(), "invalid cartridge header: rom size 131072, the rom has 65536 bytes")
+}
+
+func TestParseMMM01CartridgeHeader(t *testing.T) {
+	rom := makeMMM01Rom()
+	header := parseCartridgeHeaderAt(rom, len(rom)-0x8000)
+	assert.Equal(t, byte(0x0D), header.CartridgeType)
+	assert.Equal(t, len(rom), header.ActualROMSize)
+	assert.Equal(t, ParseCartridgeHeader(rom).ActualGlobalChecksum, header.ActualGlobalChecksum)
+}
+
+func TestFitROM(t *testing.T) {
+	// same size
+	rom := makeHeaderRom()
+	assert.Equal(t, rom, fitROM(rom, ParseCartridgeHeader(rom)))
+
+	// trimmed: padded up to 64KB, then mirrored up to the 128KB of the header
+	rom[0x148] = 2
+	trimmed := rom[:0xA000]
+	fitted := fitROM(trimmed, ParseCartridgeHeader(trimmed))
+	assert.Len(t, fitted, 1<<17)
+	assert.Equal(t, trimmed, fitted[:0xA000])
+	assert.Equal(t, byte(0xFF), fitted[0xA000])
+	assert.Equal(t, byte(0xFF), fitted[0xFFFF])
+	assert.Equal(t, fitted[:1<<16], fitted[1<<16:])
+
+	// overdumped: kept whole
+	rom = makeHeaderRom()
+	rom[0x148] = 0
+	fitted = fitROM(rom, ParseCartridgeHeader(rom))
+	assert.Len(t, fitted, 1<<16)
+}
+
+func TestNewMBCWithMismatchedROMSize(t *testing.T) {
+	rom := makeHeaderRom()
+	rom[0x148] = 2
+
+	// the 64KB rom is mirrored in the 128KB declared by the header
+	m := NewMBC(rom).(*MBC1)
+	assert.Equal(t, uint16(8), m.NumRomBanks)
+	m.WriteMemory(0x2000, 2)
+	assert.Equal(t, byte(0x12), m.ReadMemory(0x4000))
+	m.WriteMemory(0x2000, 6)
+	assert.Equal(t, byte(0x12), m.ReadMemory(0x4000))
+
+	// without MBC, a trimmed rom is padded to 32KB
+	small := make([]byte, 0x4000)
+	assert.Equal(t, byte(0xFF), NewMBC(small).ReadMemory(0x7FFF))
+
+	// an overdumped rom without MBC is truncated to the 32KB which can be mapped
+	large := make([]byte, 1<<16)
+	large[0x7FFF] = 0x34
+	large[0x8000] = 0x56
+	m0 := NewMBC(large).(*MBC0)
+	assert.Len(t, m0.Rom, 1<<15)
+	assert.Equal(t, byte(0x34), m0.ReadMemory(0x7FFF))
+
+	large[0x147] = 0x09
+	assert.Len(t, NewMBC(large).(*ROMRAM).Rom, 1<<15)
+
+	assert.PanicsWithValue(t, "Rom has size 256, it is too small to have a header", func() { NewMBC(small[:0x100]) })
+}
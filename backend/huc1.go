@@ -0,0 +1,122 @@
+package backend
+
+import "fmt"
+
+// HuC1 is similar to MBC1, with an infrared LED and receiver which can be mapped instead of the RAM
+type HuC1 struct {
+	SelectedROMBank byte
+	SelectedRAMBank byte
+
+	Rom []byte
+	Ram []byte
+
+	// when set, 0xA000-0xBFFF accesses the infrared port instead of the RAM
+	IRMode bool
+	LED    bool
+
+	NumRomBanks uint16
+	NumRamBanks byte
+
+	infraredPeer InfraredPeer
+}
+
+func NewHuC1(rom []byte, header CartridgeHeader) *HuC1 {
+	m := new(HuC1)
+
+	m.SelectedROMBank = 1
+
+	m.Rom = fitROM(rom, header)
+
+	m.NumRomBanks = uint16(len(m.Rom) / 0x4000)
+
+	ramSize := header.RAMSize()
+	m.NumRamBanks = byte(ramSize / 0x2000)
+	m.Ram = make([]byte, ramSize)
+
+	return m
+}
+
+func (m *HuC1) ReadMemory(address uint16) byte {
+
+	if address < 0x4000 {
+		return m.Rom[address]
+	}
+	if 0x4000 <= address && address < 0x8000 {
+
+		offset := uint32(address) - 0x4000
+		bankAddress := (uint32(m.SelectedROMBank) * 0x4000) + offset
+		return m.Rom[bankAddress]
+
+	} else if 0xA000 <= address && address < 0xC000 {
+
+		if m.IRMode {
+			// bit 0 is set when light is received
+			if receivesLight(m.infraredPeer) {
+				return 0xC1
+			}
+			return 0xC0
+		}
+
+		// the RAM doesn't need to be enabled
+		if len(m.Ram) > 0 {
+			offset := uint32(address) - 0xA000
+			bankAddress := (uint32(m.SelectedRAMBank) * 0x2000) + offset
+			return m.Ram[bankAddress%uint32(len(m.Ram))]
+		}
+
+		return 0xFF
+	}
+
+	panic(fmt.Sprintf("Got unexpected read address not handled by MBC %d", address))
+}
+
+func (m *HuC1) WriteMemory(address uint16, value byte) {
+
+	if address < 0x2000 {
+
+		m.IRMode = value&0xF == 0xE
+
+	} else if 0x2000 <= address && address < 0x4000 {
+
+		value &= 0x3F
+		if value == 0 {
+			value++
+		}
+		m.SelectedROMBank = byte(uint16(value) % m.NumRomBanks)
+
+	} else if 0x4000 <= address && address < 0x6000 {
+
+		if m.NumRamBanks > 0 {
+			m.SelectedRAMBank = (value & 0x3) % m.NumRamBanks
+		}
+
+	} else if 0x6000 <= address && address < 0x8000 {
+
+		// no registers there
+
+	} else if 0xA000 <= address && address < 0xC000 {
+
+		if m.IRMode {
+			m.LED = value&1 > 0
+		} else if len(m.Ram) > 0 {
+			offset := uint32(address) - 0xA000
+			bankAddress := (uint32(m.SelectedRAMBank) * 0x2000) + offset
+			m.Ram[bankAddress%uint32(len(m.Ram))] = value
+		}
+
+	} else {
+		panic(fmt.Sprintf("Got unexpected write address not handled by MBC %d", address))
+	}
+}
+
+func (m *HuC1) batteryRAM() []byte {
+	return m.Ram
+}
+
+func (m *HuC1) setInfraredPeer(peer InfraredPeer) {
+	m.infraredPeer = peer
+}
+
+func (m *HuC1) ledOn() bool {
+	return m.LED
+}
@@ -0,0 +1,317 @@
+package backend
+
+import (
+	"fmt"
+	"time"
+)
+
+// HuC3 modes, selected by writing to 0x0000-0x1FFF
+const (
+	huc3RAMReadOnly = 0x0
+	huc3RAM         = 0xA
+	huc3Command     = 0xB // writes send a command to the clock chip
+	huc3Response    = 0xC // reads return the result of the last command
+	huc3Semaphore   = 0xD // writing bit 0 cleared runs the command, reading bit 0 set means it is done
+	huc3IR          = 0xE
+
+	// clock chip commands, in the upper nibble, the lower one is the argument
+	huc3ReadMemory   = 0x1 // returns the nibble at the address, which is then incremented
+	huc3WriteMemory  = 0x3 // writes the argument at the address, which is then incremented
+	huc3AddressLow   = 0x4
+	huc3AddressHigh  = 0x5
+	huc3Extended     = 0x6
+	huc3ReadTime     = 0x0 // extended: copies the time to memory 0x00-0x05
+	huc3WriteTime    = 0x1 // extended: sets the time from memory 0x00-0x05
+	huc3Status       = 0x2 // extended: returns 1
+	huc3ToneGenerate = 0xE // extended: plays a tone through the cartridge speaker
+
+	minutesPerDay = 24 * 60
+)
+
+// HuC3 has a clock chip counting minutes and days, driven through a command interface,
+// a tone generator and the infrared port of the HuC1
+type HuC3 struct {
+	Mode            byte
+	SelectedROMBank byte
+	SelectedRAMBank byte
+
+	Rom []byte
+	Ram []byte
+
+	NumRomBanks uint16
+	NumRamBanks byte
+
+	LED bool
+
+	Command  byte // last command written in command mode
+	Response byte
+	Address  byte
+	Memory   [256]byte // memory of the clock chip, made of nibbles
+
+	// the speaker isn't emulated, this is set when the game plays a tone
+	TonePlayed bool
+
+	Clock *HuC3Clock
+
+	infraredPeer InfraredPeer
+}
+
+func NewHuC3(rom []byte, header CartridgeHeader) *HuC3 {
+	m := new(HuC3)
+
+	m.SelectedROMBank = 1
+
+	m.Rom = fitROM(rom, header)
+
+	m.NumRomBanks = uint16(len(m.Rom) / 0x4000)
+
+	ramSize := header.RAMSize()
+	m.NumRamBanks = byte(ramSize / 0x2000)
+	m.Ram = make([]byte, ramSize)
+
+	m.Clock = NewHuC3Clock()
+
+	return m
+}
+
+func (m *HuC3) ReadMemory(address uint16) byte {
+
+	if address < 0x4000 {
+		return m.Rom[address]
+	}
+	if 0x4000 <= address && address < 0x8000 {
+
+		offset := uint32(address) - 0x4000
+		bankAddress := (uint32(m.SelectedROMBank) * 0x4000) + offset
+		return m.Rom[bankAddress]
+
+	} else if 0xA000 <= address && address < 0xC000 {
+
+		switch m.Mode {
+		case huc3RAMReadOnly, huc3RAM:
+			if len(m.Ram) > 0 {
+				offset := uint32(address) - 0xA000
+				bankAddress := (uint32(m.SelectedRAMBank) * 0x2000) + offset
+				return m.Ram[bankAddress%uint32(len(m.Ram))]
+			}
+		case huc3Response:
+			return m.Command&0xF0 | m.Response&0x0F
+		case huc3Semaphore:
+			// the commands complete instantly
+			return 0xFF
+		case huc3IR:
+			if receivesLight(m.infraredPeer) {
+				return 0xC1
+			}
+			return 0xC0
+		}
+
+		return 0xFF
+	}
+
+	panic(fmt.Sprintf("Got unexpected read address not handled by MBC %d", address))
+}
+
+func (m *HuC3) WriteMemory(address uint16, value byte) {
+
+	if address < 0x2000 {
+
+		m.Mode = value & 0xF
+
+	} else if 0x2000 <= address && address < 0x4000 {
+
+		value &= 0x7F
+		if value == 0 {
+			value++
+		}
+		m.SelectedROMBank = byte(uint16(value) % m.NumRomBanks)
+
+	} else if 0x4000 <= address && address < 0x6000 {
+
+		if m.NumRamBanks > 0 {
+			m.SelectedRAMBank = (value & 0x3) % m.NumRamBanks
+		}
+
+	} else if 0x6000 <= address && address < 0x8000 {
+
+		// no registers there
+
+	} else if 0xA000 <= address && address < 0xC000 {
+
+		switch m.Mode {
+		case huc3RAM:
+			if len(m.Ram) > 0 {
+				offset := uint32(address) - 0xA000
+				bankAddress := (uint32(m.SelectedRAMBank) * 0x2000) + offset
+				m.Ram[bankAddress%uint32(len(m.Ram))] = value
+			}
+		case huc3Command:
+			m.Command = value
+		case huc3Semaphore:
+			if value&1 == 0 {
+				m.runCommand()
+			}
+		case huc3IR:
+			m.LED = value&1 > 0
+		}
+
+	} else {
+		panic(fmt.Sprintf("Got unexpected write address not handled by MBC %d", address))
+	}
+}
+
+func (m *HuC3) runCommand() {
+	argument := m.Command & 0xF
+
+	switch m.Command >> 4 {
+	case huc3ReadMemory:
+		m.Response = m.Memory[m.Address] & 0xF
+		m.Address++
+	case huc3WriteMemory:
+		m.Memory[m.Address] = argument
+		m.Address++
+	case huc3AddressLow:
+		m.Address = m.Address&0xF0 | argument
+	case huc3AddressHigh:
+		m.Address = m.Address&0x0F | argument<<4
+	case huc3Extended:
+		switch argument {
+		case huc3ReadTime:
+			m.Clock.sync(timeNow())
+			putNibbles(m.Memory[0:3], m.Clock.Minutes)
+			putNibbles(m.Memory[3:6], m.Clock.Days)
+		case huc3WriteTime:
+			m.Clock.set(getNibbles(m.Memory[0:3]), getNibbles(m.Memory[3:6]))
+		case huc3Status:
+			m.Response = 1
+		case huc3ToneGenerate:
+			m.TonePlayed = true
+		}
+	}
+}
+
+// putNibbles stores a value in the given nibbles, least significant first
+func putNibbles(nibbles []byte, value int) {
+	for i := range nibbles {
+		nibbles[i] = byte(value>>(4*i)) & 0xF
+	}
+}
+
+func getNibbles(nibbles []byte) int {
+	value := 0
+	for i := range nibbles {
+		value |= int(nibbles[i]&0xF) << (4 * i)
+	}
+	return value
+}
+
+func (m *HuC3) batteryRAM() []byte {
+	return m.Ram
+}
+
+func (m *HuC3) getClock() cartridgeClock {
+	return m.Clock
+}
+
+func (m *HuC3) setInfraredPeer(peer InfraredPeer) {
+	m.infraredPeer = peer
+}
+
+func (m *HuC3) ledOn() bool {
+	return m.LED
+}
+
+// HuC3Clock counts minutes in the day and days, the game reads and sets it through memory 0x00-0x05
+// like RTC, it either counts emulated cycles or follows the host clock
+// it is also the clock of the TAMA5, which can stop it
+type HuC3Clock struct {
+	Minutes int // 0-1439
+	Days    int // 12 bits
+	Seconds int // seconds in the current minute, not visible to the game
+	Stopped bool
+
+	Dots int
+
+	HostClock bool
+	Timestamp int64
+}
+
+func NewHuC3Clock() *HuC3Clock {
+	c := new(HuC3Clock)
+	c.Timestamp = timeNow().Unix()
+	return c
+}
+
+func (c *HuC3Clock) tick(dots int) {
+	if c.HostClock || c.Stopped {
+		return
+	}
+
+	c.Dots += dots
+	for c.Dots >= rtcDotsPerSecond {
+		c.Dots -= rtcDotsPerSecond
+		c.advance(1)
+	}
+}
+
+func (c *HuC3Clock) setHostClock(hostClock bool) {
+	c.Timestamp = timeNow().Unix()
+	c.HostClock = hostClock
+}
+
+func (c *HuC3Clock) save(now time.Time) {
+	if c.HostClock {
+		c.catchUp(now)
+	} else {
+		c.Timestamp = now.Unix()
+	}
+}
+
+func (c *HuC3Clock) load(now time.Time) {
+	c.catchUp(now)
+}
+
+// sync brings the clock up to date when it follows the host clock
+func (c *HuC3Clock) sync(now time.Time) {
+	if c.HostClock {
+		c.catchUp(now)
+	}
+}
+
+// catchUp applies the whole seconds elapsed since Timestamp
+func (c *HuC3Clock) catchUp(now time.Time) {
+	elapsed := now.Unix() - c.Timestamp
+	if elapsed < 0 || c.Stopped {
+		c.Timestamp = now.Unix()
+		return
+	}
+	c.Timestamp += elapsed
+	c.advance(elapsed)
+}
+
+func (c *HuC3Clock) advance(seconds int64) {
+	total := int64(c.Seconds) + seconds
+	c.Seconds = int(total % 60)
+
+	minutes := int64(c.Minutes) + total/60
+	c.Minutes = int(minutes % minutesPerDay)
+	c.Days = int((int64(c.Days) + minutes/minutesPerDay) & 0xFFF)
+}
+
+func (c *HuC3Clock) stop() {
+	c.sync(timeNow())
+	c.Stopped = true
+}
+
+func (c *HuC3Clock) start() {
+	c.Timestamp = timeNow().Unix()
+	c.Stopped = false
+}
+
+func (c *HuC3Clock) set(minutes, days int) {
+	c.sync(timeNow())
+	c.Minutes = minutes % minutesPerDay
+	c.Days = days & 0xFFF
+	c.Seconds = 0
+	c.Dots = 0
+}
@@ -0,0 +1,178 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newHuCEmulator(cartridgeType byte) *Emulator {
+	return NewEmulator(withMBC(NewMBC(makeBankedRom(cartridgeType, 2, 3))), WithDisableApu())
+}
+
+func TestHuC1Banking(t *testing.T) {
+	m := NewMBC(makeBankedRom(0xFF, 2, 3)).(*HuC1)
+
+	m.WriteMemory(0x2000, 5)
+	assert.Equal(t, byte(5), m.ReadMemory(0x4200))
+	m.WriteMemory(0x2000, 0)
+	assert.Equal(t, byte(1), m.ReadMemory(0x4200))
+
+	// the RAM is always enabled
+	m.WriteMemory(0x4000, 2)
+	m.WriteMemory(0xA000, 0x12)
+	m.WriteMemory(0x4000, 0)
+	assert.Equal(t, byte(0), m.ReadMemory(0xA000))
+	m.WriteMemory(0x4000, 2)
+	assert.Equal(t, byte(0x12), m.ReadMemory(0xA000))
+	assert.Equal(t, m.Ram, getBatteryRAM(m))
+}
+
+func TestInfraredLink(t *testing.T) {
+	huc1 := newHuCEmulator(0xFF)
+	huc3 := newHuCEmulator(0xFE)
+	huc1.LinkInfrared(huc3)
+
+	// IR mode
+	huc1.mbc.WriteMemory(0x0000, 0x0E)
+	huc3.mbc.WriteMemory(0x0000, 0x0E)
+	assert.Equal(t, byte(0xC0), huc1.mbc.ReadMemory(0xA000))
+	assert.Equal(t, byte(0xC0), huc3.mbc.ReadMemory(0xA000))
+
+	huc1.mbc.WriteMemory(0xA000, 0x01)
+	assert.True(t, huc1.IsEmittingLight())
+	assert.Equal(t, byte(0xC1), huc3.mbc.ReadMemory(0xA000))
+	assert.Equal(t, byte(0xC0), huc1.mbc.ReadMemory(0xA000))
+
+	huc1.mbc.WriteMemory(0xA000, 0x00)
+	huc3.mbc.WriteMemory(0xA000, 0x01)
+	assert.Equal(t, byte(0xC0), huc3.mbc.ReadMemory(0xA000))
+	assert.Equal(t, byte(0xC1), huc1.mbc.ReadMemory(0xA000))
+
+	// the LED doesn't change in RAM mode
+	huc3.mbc.WriteMemory(0x0000, 0x0A)
+	huc3.mbc.WriteMemory(0xA000, 0x00)
+	assert.True(t, huc3.IsEmittingLight())
+
+	// nothing in front of the port
+	huc1.SetInfraredPeer(nil)
+	assert.Equal(t, byte(0xC0), huc1.mbc.ReadMemory(0xA000))
+}
+
+// runHuC3Command runs a clock chip command and returns the response
+func runHuC3Command(m *HuC3, command byte) byte {
+	m.WriteMemory(0x0000, huc3Command)
+	m.WriteMemory(0xA000, command)
+	m.WriteMemory(0x0000, huc3Semaphore)
+	m.WriteMemory(0xA000, 0xFE)
+	if m.ReadMemory(0xA000)&1 == 0 {
+		panic("HuC3 command not done")
+	}
+	m.WriteMemory(0x0000, huc3Response)
+	return m.ReadMemory(0xA000)
+}
+
+func readHuC3Time(m *HuC3) (minutes, days int) {
+	runHuC3Command(m, huc3Extended<<4|huc3ReadTime)
+	runHuC3Command(m, huc3AddressLow<<4)
+	runHuC3Command(m, huc3AddressHigh<<4)
+
+	var nibbles [6]byte
+	for i := range nibbles {
+		nibbles[i] = runHuC3Command(m, huc3ReadMemory<<4) & 0xF
+	}
+	return getNibbles(nibbles[0:3]), getNibbles(nibbles[3:6])
+}
+
+func TestHuC3Commands(t *testing.T) {
+	m := NewMBC(makeBankedRom(0xFE, 2, 3)).(*HuC3)
+
+	assert.Equal(t, byte(0x61), runHuC3Command(m, huc3Extended<<4|huc3Status))
+
+	// write then read back the clock chip memory
+	runHuC3Command(m, huc3AddressLow<<4|0x6)
+	runHuC3Command(m, huc3AddressHigh<<4|0x2)
+	runHuC3Command(m, huc3WriteMemory<<4|0x9)
+	runHuC3Command(m, huc3WriteMemory<<4|0x3)
+	assert.Equal(t, byte(0x28), m.Address)
+
+	runHuC3Command(m, huc3AddressLow<<4|0x6)
+	assert.Equal(t, byte(0x19), runHuC3Command(m, huc3ReadMemory<<4))
+	assert.Equal(t, byte(0x13), runHuC3Command(m, huc3ReadMemory<<4))
+
+	runHuC3Command(m, huc3Extended<<4|huc3ToneGenerate)
+	assert.True(t, m.TonePlayed)
+
+	// RAM is read only in mode 0
+	m.WriteMemory(0x0000, huc3RAM)
+	m.WriteMemory(0xA000, 0x12)
+	m.WriteMemory(0x0000, huc3RAMReadOnly)
+	m.WriteMemory(0xA000, 0x34)
+	assert.Equal(t, byte(0x12), m.ReadMemory(0xA000))
+}
+
+func TestHuC3Clock(t *testing.T) {
+	now := setTestTime(t)
+
+	emulator := newHuCEmulator(0xFE)
+	m := emulator.mbc.(*HuC3)
+
+	// set the time to day 2, 23:59
+	runHuC3Command(m, huc3AddressLow<<4)
+	runHuC3Command(m, huc3AddressHigh<<4)
+	var nibbles [6]byte
+	putNibbles(nibbles[0:3], minutesPerDay-1)
+	putNibbles(nibbles[3:6], 2)
+	for _, n := range nibbles {
+		runHuC3Command(m, huc3WriteMemory<<4|n)
+	}
+	runHuC3Command(m, huc3Extended<<4|huc3WriteTime)
+
+	m.Clock.tick(rtcDotsPerSecond * 60)
+	minutes, days := readHuC3Time(m)
+	assert.Equal(t, 0, minutes)
+	assert.Equal(t, 3, days)
+
+	// the time elapsed while the emulator was closed is applied
+	m.Clock.save(*now)
+	m.Clock.load(now.Add(90 * time.Minute))
+	minutes, days = readHuC3Time(m)
+	assert.Equal(t, 90, minutes)
+	assert.Equal(t, 3, days)
+}
+
+func TestHuC3BatterySave(t *testing.T) {
+	now := setTestTime(t)
+	path := t.TempDir() + "/game.sav"
+
+	emulator := newHuCEmulator(0xFE)
+	emulator.SetBatterySave(path)
+	m := emulator.mbc.(*HuC3)
+	m.Clock.Minutes = 100
+	m.WriteMemory(0x0000, huc3RAM)
+	m.WriteMemory(0xA000, 0x12)
+	assert.NoError(t, emulator.FlushBatterySave())
+
+	*now = now.Add(2 * time.Minute)
+	emulator = NewEmulator(withMBC(NewMBC(makeBankedRom(0xFE, 2, 3))), WithBatterySave(path), WithDisableApu())
+	m = emulator.mbc.(*HuC3)
+	assert.Equal(t, 102, m.Clock.Minutes)
+	m.WriteMemory(0x0000, huc3RAM)
+	assert.Equal(t, byte(0x12), m.ReadMemory(0xA000))
+}
+
+func TestMarshalHuC(t *testing.T) {
+	rom := makeBankedRom(0xFF, 2, 3)
+	huc1 := NewHuC1(rom, ParseCartridgeHeader(rom))
+	huc1.IRMode = true
+	huc1.SelectedROMBank = 3
+	runTest(t, huc1)
+
+	rom = makeBankedRom(0xFE, 2, 3)
+	huc3 := NewHuC3(rom, ParseCartridgeHeader(rom))
+	huc3.Memory[0x10] = 0xA
+	huc3.Clock.Days = 12
+	huc3.Mode = huc3IR
+	runTest(t, huc3)
+}
@@ -0,0 +1,49 @@
+package backend
+
+// InfraredPeer is the device in front of the infrared port of the cartridge, e.g. another emulator
+type InfraredPeer interface {
+	// IsEmittingLight returns whether the infrared LED of the peer is on
+	IsEmittingLight() bool
+}
+
+// infraredMBC is implemented by the MBCs with an infrared LED and receiver
+type infraredMBC interface {
+	setInfraredPeer(peer InfraredPeer)
+	ledOn() bool
+}
+
+// receivesLight returns whether the peer's LED is on, nothing is received if there is no peer
+func receivesLight(peer InfraredPeer) bool {
+	return peer != nil && peer.IsEmittingLight()
+}
+
+// WithInfraredPeer puts the given device in front of the infrared port of the cartridge
+func WithInfraredPeer(peer InfraredPeer) func(*Emulator) {
+	return func(e *Emulator) {
+		e.infraredPeer = peer
+	}
+}
+
+// SetInfraredPeer puts the given device in front of the infrared port of the cartridge, see WithInfraredPeer
+func (e *Emulator) SetInfraredPeer(peer InfraredPeer) {
+	e.infraredPeer = peer
+	if m, ok := e.mbc.(infraredMBC); ok {
+		m.setInfraredPeer(peer)
+	}
+}
+
+// IsEmittingLight returns whether the infrared LED of the cartridge is on
+func (e *Emulator) IsEmittingLight() bool {
+	if m, ok := e.mbc.(infraredMBC); ok {
+		return m.ledOn()
+	}
+	return false
+}
+
+// LinkInfrared points the infrared ports of two emulators at each other
+// both emulators have to be run from the same goroutine, and the games have to tolerate the latency
+// of running them one frame after the other
+func (e *Emulator) LinkInfrared(other *Emulator) {
+	e.SetInfraredPeer(other)
+	other.SetInfraredPeer(e)
+}
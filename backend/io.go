@@ -0,0 +1,214 @@
+package backend
+
+// ioRegister describes an I/O register between 0xFF00 and 0xFF7F
+// the registers which aren't listed are unmapped: they read 0xFF and writes are ignored
+type ioRegister struct {
+	readable byte // bits read from ram, the others read as 1
+	writable byte // bits which can be written by the CPU
+	cgbOnly  bool // unmapped in DMG mode
+}
+
+var ioRegisters = [0x80]ioRegister{
+	0x00: {0x3F, 0x30, false}, // P1
+	0x01: {0xFF, 0xFF, false}, // SB
+	0x02: {0x83, 0x83, false}, // SC
+	0x04: {0xFF, 0xFF, false}, // DIV
+	0x05: {0xFF, 0xFF, false}, // TIMA
+	0x06: {0xFF, 0xFF, false}, // TMA
+	0x07: {0x07, 0x07, false}, // TAC
+	0x0F: {0x1F, 0x1F, false}, // IF
+
+	0x10: {0x7F, 0xFF, false}, // NR10
+	0x11: {0xC0, 0xFF, false}, // NR11
+	0x12: {0xFF, 0xFF, false}, // NR12
+	0x13: {0x00, 0xFF, false}, // NR13
+	0x14: {0x40, 0xFF, false}, // NR14
+	0x16: {0xC0, 0xFF, false}, // NR21
+	0x17: {0xFF, 0xFF, false}, // NR22
+	0x18: {0x00, 0xFF, false}, // NR23
+	0x19: {0x40, 0xFF, false}, // NR24
+	0x1A: {0x80, 0xFF, false}, // NR30
+	0x1B: {0x00, 0xFF, false}, // NR31
+	0x1C: {0x60, 0xFF, false}, // NR32
+	0x1D: {0x00, 0xFF, false}, // NR33
+	0x1E: {0x40, 0xFF, false}, // NR34
+	0x20: {0x00, 0xFF, false}, // NR41
+	0x21: {0xFF, 0xFF, false}, // NR42
+	0x22: {0xFF, 0xFF, false}, // NR43
+	0x23: {0x40, 0xFF, false}, // NR44
+	0x24: {0xFF, 0xFF, false}, // NR50
+	0x25: {0xFF, 0xFF, false}, // NR51
+	0x26: {0x8F, 0xFF, false}, // NR52
+
+	// wave RAM
+	0x30: {0xFF, 0xFF, false},
+	0x31: {0xFF, 0xFF, false},
+	0x32: {0xFF, 0xFF, false},
+	0x33: {0xFF, 0xFF, false},
+	0x34: {0xFF, 0xFF, false},
+	0x35: {0xFF, 0xFF, false},
+	0x36: {0xFF, 0xFF, false},
+	0x37: {0xFF, 0xFF, false},
+	0x38: {0xFF, 0xFF, false},
+	0x39: {0xFF, 0xFF, false},
+	0x3A: {0xFF, 0xFF, false},
+	0x3B: {0xFF, 0xFF, false},
+	0x3C: {0xFF, 0xFF, false},
+	0x3D: {0xFF, 0xFF, false},
+	0x3E: {0xFF, 0xFF, false},
+	0x3F: {0xFF, 0xFF, false},
+
+	0x40: {0xFF, 0xFF, false}, // LCDC
+	0x41: {0x7F, 0x78, false}, // STAT
+	0x42: {0xFF, 0xFF, false}, // SCY
+	0x43: {0xFF, 0xFF, false}, // SCX
+	0x44: {0xFF, 0x00, false}, // LY
+	0x45: {0xFF, 0xFF, false}, // LYC
+	0x46: {0xFF, 0xFF, false}, // DMA
+	0x47: {0xFF, 0xFF, false}, // BGP
+	0x48: {0xFF, 0xFF, false}, // OBP0
+	0x49: {0xFF, 0xFF, false}, // OBP1
+	0x4A: {0xFF, 0xFF, false}, // WY
+	0x4B: {0xFF, 0xFF, false}, // WX
+
+	0x4C: {0x00, 0x0C, true},  // KEY0, write only
+	0x4D: {0x81, 0x01, true},  // KEY1
+	0x4F: {0x01, 0x01, true},  // VBK
+	0x50: {0x00, 0xFF, false}, // BOOT, always reads 0xFF
+	0x51: {0x00, 0xFF, true},  // HDMA1
+	0x52: {0x00, 0xFF, true},  // HDMA2
+	0x53: {0x00, 0xFF, true},  // HDMA3
+	0x54: {0x00, 0xFF, true},  // HDMA4
+	0x55: {0xFF, 0xFF, true},  // HDMA5
+	0x56: {0xC1, 0xC1, true},  // RP, infrared port (bit 1 reads 1: no light received)
+
+	0x68: {0xBF, 0xBF, true}, // BCPS
+	0x69: {0xFF, 0xFF, true}, // BCPD
+	0x6A: {0xBF, 0xBF, true}, // OCPS
+	0x6B: {0xFF, 0xFF, true}, // OCPD
+	0x6C: {0x01, 0x01, true}, // OPRI
+	0x70: {0x07, 0x07, true}, // SVBK
+
+	// undocumented CGB registers
+	0x72: {0xFF, 0xFF, true},
+	0x73: {0xFF, 0xFF, true},
+	0x74: {0xFF, 0xFF, true},
+	0x75: {0x70, 0x70, true},
+	0x76: {0xFF, 0x00, true}, // PCM12, digital outputs of channels 1 and 2
+	0x77: {0xFF, 0x00, true}, // PCM34, digital outputs of channels 3 and 4
+}
+
+func isIORegister(address uint16) bool {
+	return 0xFF00 <= address && address < 0xFF80
+}
+
+var unmappedIORegister ioRegister
+
+func (m *MMU) ioRegister(address uint16) *ioRegister {
+	r := &ioRegisters[address-0xFF00]
+	if r.cgbOnly && !m.cgb {
+		return &unmappedIORegister
+	}
+	return r
+}
+
+func (m *MMU) readIORegister(address uint16) byte {
+	if m.cgb {
+		// the palette data is not kept in ram
+		switch address {
+		case BCPD:
+			return m.bgPalette[m.ram[BCPS]&0x3F]
+		case OCPD:
+			return m.objPalette[m.ram[OCPS]&0x3F]
+		}
+	}
+
+	r := m.ioRegister(address)
+	return m.ram[address]&r.readable | ^r.readable
+}
+
+// writeIORegister stores the writable bits of the value, after performing the side effects of the write if any
+func (m *MMU) writeIORegister(address uint16, value byte) {
+	r := m.ioRegister(address)
+	if r.writable == 0 {
+		// read only or unmapped
+		return
+	}
+	value &= r.writable
+
+	switch {
+	case address == 0xFF00:
+		m.writeJoypad(value)
+	case address == SB || address == SC:
+		m.serial.writeRegister(address, value)
+	case DIV <= address && address <= TAC:
+		m.timer.writeRegister(address, value)
+	case 0xFF10 <= address && address <= 0xFF26:
+		m.writeAudio(address, value)
+	case address == STAT || address == LYC:
+		m.writeLCDRegister(address, value)
+	case address == DMA:
+		m.writeDMA(value)
+	case address == BOOT:
+		if value != 0 && m.bootRom != nil {
+			m.bootRom = nil
+			if m.ram[KEY0]&0x04 > 0 {
+				m.enterCompatibilityMode()
+			}
+		}
+		m.ram[BOOT] = value
+	case address == KEY0:
+		// locked once the boot rom is unmapped
+		if m.bootRom != nil {
+			m.ram[KEY0] = value
+		}
+	case address == KEY1:
+		// the current speed can't be written
+		m.ram[KEY1] = m.ram[KEY1]&0x80 | value
+	case address == HDMA5:
+		m.writeHDMA5(value)
+	case address == BCPD:
+		m.bgPalette[m.ram[BCPS]&0x3F] = value
+		m.incrementPaletteIndex(BCPS)
+	case address == OCPD:
+		m.objPalette[m.ram[OCPS]&0x3F] = value
+		m.incrementPaletteIndex(OCPS)
+	default:
+		m.ram[address] = m.ram[address]&^r.writable | value
+	}
+}
+
+func (m *MMU) writeJoypad(value byte) {
+	m.ram[0xFF00] = 0b1100_0000 | value | m.readKeyPressed(value)
+}
+
+func (m *MMU) writeAudio(address uint16, value byte) {
+	oldValue := m.ram[address]
+	if address == 0xFF26 {
+		// NR52 only top bits are writeable
+		m.ram[address] = value & 0xF0
+
+		// check if APU disabled. If yes, then clear all regs
+		if value&0x80 == 0 {
+			for i := 0xFF10; i <= 0xFF2F; i++ {
+				m.ram[i] = 0
+			}
+		}
+
+	} else {
+		// ignore all writes if APU disabled
+		isOn := m.ram[0xFF26]&0x80 > 0
+		if isOn {
+			m.ram[address] = value
+		}
+	}
+	m.audioRegisterWriteCallback(address, oldValue, value)
+}
+
+func (m *MMU) writeLCDRegister(address uint16, value byte) {
+	if m.ppu == nil {
+		m.ram[address] = value
+		return
+	}
+	m.ppu.writeRegister(address, value)
+}
@@ -0,0 +1,193 @@
+package backend
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// link cable messages are 2 bytes: the kind of message followed by the byte shifted out
+const (
+	linkTransfer = 1 // sent by the side driving the clock
+	linkReply    = 2 // sent back by the other side
+
+	// how long the side driving the clock waits for the reply before assuming nothing is connected
+	linkReplyTimeout = time.Second
+	// how long the other side pauses for a transfer to start once it is ready for one
+	linkPauseTimeout = 50 * time.Millisecond
+)
+
+// TCPLink connects the link ports of two GoGB processes over TCP
+// the side driving the clock waits for every byte to be answered, so both sides stay in sync on its clock
+// the other side pauses while waiting for the next byte, to absorb the network latency
+// once disconnected, the link port behaves as if nothing was connected
+type TCPLink struct {
+	conn net.Conn
+
+	transfers chan byte // bytes received from the peer driving the clock
+	replies   chan byte // bytes received in reply to our transfers
+
+	done      chan struct{} // closed on disconnect
+	closeOnce sync.Once
+
+	out [2]byte
+}
+
+// ListenLink waits for another process to connect with DialLink
+func ListenLink(address string) (*TCPLink, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+
+	return AcceptLink(listener)
+}
+
+// AcceptLink waits for another process to connect to the given listener
+func AcceptLink(listener net.Listener) (*TCPLink, error) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewTCPLink(conn), nil
+}
+
+// DialLink connects to a process waiting in ListenLink
+func DialLink(address string) (*TCPLink, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewTCPLink(conn), nil
+}
+
+func NewTCPLink(conn net.Conn) *TCPLink {
+	l := new(TCPLink)
+	l.conn = conn
+	l.transfers = make(chan byte, 1)
+	l.replies = make(chan byte, 1)
+	l.done = make(chan struct{})
+
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		// messages are tiny and latency sensitive
+		tcp.SetNoDelay(true)
+	}
+
+	go l.receive()
+
+	return l
+}
+
+func (l *TCPLink) receive() {
+	defer l.Close()
+
+	var message [2]byte
+	for {
+		if _, err := io.ReadFull(l.conn, message[:]); err != nil {
+			return
+		}
+
+		var messages chan byte
+		switch message[0] {
+		case linkTransfer:
+			messages = l.transfers
+		case linkReply:
+			messages = l.replies
+		default:
+			// not a GoGB peer
+			return
+		}
+
+		select {
+		case messages <- message[1]:
+		case <-l.done:
+			return
+		}
+	}
+}
+
+func (l *TCPLink) send(kind, value byte) {
+	l.out[0], l.out[1] = kind, value
+	if _, err := l.conn.Write(l.out[:]); err != nil {
+		l.Close()
+	}
+}
+
+// Close disconnects the link
+func (l *TCPLink) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.done)
+		err = l.conn.Close()
+	})
+	return err
+}
+
+// Connected returns false once the peer disconnected
+func (l *TCPLink) Connected() bool {
+	select {
+	case <-l.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Transfer implements SerialPeer
+func (l *TCPLink) Transfer(out byte) byte {
+	if !l.Connected() {
+		return 0xFF
+	}
+
+	l.send(linkTransfer, out)
+
+	timeout := time.NewTimer(linkReplyTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case in := <-l.replies:
+			return in
+		case <-l.transfers:
+			// both sides are driving the clock
+			l.send(linkReply, 0xFF)
+		case <-timeout.C:
+			return 0xFF
+		case <-l.done:
+			return 0xFF
+		}
+	}
+}
+
+// ReceiveTransfer implements SerialClockSource
+func (l *TCPLink) ReceiveTransfer(wait bool) (byte, bool) {
+	if !wait {
+		select {
+		case in := <-l.transfers:
+			return in, true
+		default:
+			return 0, false
+		}
+	}
+
+	timeout := time.NewTimer(linkPauseTimeout)
+	defer timeout.Stop()
+
+	select {
+	case in := <-l.transfers:
+		return in, true
+	case <-timeout.C:
+		return 0, false
+	case <-l.done:
+		return 0, false
+	}
+}
+
+// CompleteTransfer implements SerialClockSource
+func (l *TCPLink) CompleteTransfer(out byte) {
+	if l.Connected() {
+		l.send(linkReply, out)
+	}
+}
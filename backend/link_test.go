@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLinks(t *testing.T) (*TCPLink, *TCPLink) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	accepted := make(chan *TCPLink)
+	go func() {
+		link, err := AcceptLink(listener)
+		assert.NoError(t, err)
+		accepted <- link
+	}()
+
+	dialed, err := DialLink(listener.Addr().String())
+	assert.NoError(t, err)
+
+	return <-accepted, dialed
+}
+
+func TestTCPLinkTransfer(t *testing.T) {
+	masterLink, slaveLink := newTestLinks(t)
+	defer masterLink.Close()
+	defer slaveLink.Close()
+
+	master := NewEmulator(WithNoRom(), WithDisableApu(), WithSerialPeer(masterLink))
+	slave := NewEmulator(WithNoRom(), WithDisableApu(), WithSerialPeer(slaveLink))
+
+	slave.cpu.writeMemory(SB, 0x24)
+	slave.cpu.writeMemory(SC, 0x80)
+
+	// each emulator runs in its own goroutine, as if they were in different processes
+	slaveDone := make(chan struct{})
+	go func() {
+		defer close(slaveDone)
+		for i := 0; i < 100000 && slave.mmu.readMemory(SC)&scTransfer > 0; i++ {
+			slave.cpu.tick()
+		}
+	}()
+
+	master.cpu.writeMemory(SB, 0x42)
+	master.cpu.writeMemory(SC, 0x81)
+	for i := 0; i < 1024; i++ {
+		master.cpu.tick()
+	}
+	<-slaveDone
+
+	assert.Equal(t, byte(0x24), master.mmu.readMemory(SB))
+	assert.Equal(t, byte(0x42), slave.mmu.readMemory(SB))
+	assert.Equal(t, byte(0), master.mmu.readMemory(SC)&scTransfer)
+	assert.Equal(t, byte(0), slave.mmu.readMemory(SC)&scTransfer)
+}
+
+func TestTCPLinkSlaveNotReady(t *testing.T) {
+	masterLink, slaveLink := newTestLinks(t)
+	defer masterLink.Close()
+	defer slaveLink.Close()
+
+	slave := NewEmulator(WithNoRom(), WithDisableApu(), WithSerialPeer(slaveLink))
+	slave.cpu.writeMemory(SB, 0x24)
+
+	stop := make(chan struct{})
+	slaveDone := make(chan struct{})
+	go func() {
+		defer close(slaveDone)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				slave.cpu.tick()
+			}
+		}
+	}()
+
+	// the slave did not request a transfer
+	assert.Equal(t, byte(0xFF), masterLink.Transfer(0x42))
+
+	close(stop)
+	<-slaveDone
+	assert.Equal(t, byte(0x24), slave.mmu.readMemory(SB))
+}
+
+func TestTCPLinkDisconnect(t *testing.T) {
+	masterLink, slaveLink := newTestLinks(t)
+	defer masterLink.Close()
+
+	master := NewEmulator(WithNoRom(), WithDisableApu(), WithSerialPeer(masterLink))
+
+	slaveLink.Close()
+
+	master.cpu.writeMemory(SB, 0x42)
+	master.cpu.writeMemory(SC, 0x81)
+	for i := 0; i < 1024; i++ {
+		master.cpu.tick()
+	}
+
+	// behaves as if nothing was connected
+	assert.Equal(t, byte(0xFF), master.mmu.readMemory(SB))
+	assert.Equal(t, byte(0), master.mmu.readMemory(SC)&scTransfer)
+	assert.False(t, masterLink.Connected())
+}
@@ -60,6 +60,12 @@ func (w *MbcWrapper) UnmarshalJSON(d []byte) error {
 			return e
 		}
 		w.mbc = &mbc
+	case "MBC2":
+		var mbc MBC2
+		if e := json.Unmarshal(v, &mbc); e != nil {
+			return e
+		}
+		w.mbc = &mbc
 	case "MBC3":
 		var mbc MBC3
 		if e := json.Unmarshal(v, &mbc); e != nil {
@@ -72,6 +78,48 @@ func (w *MbcWrapper) UnmarshalJSON(d []byte) error {
 			return e
 		}
 		w.mbc = &mbc
+	case "MBC7":
+		var mbc MBC7
+		if e := json.Unmarshal(v, &mbc); e != nil {
+			return e
+		}
+		w.mbc = &mbc
+	case "HuC1":
+		var mbc HuC1
+		if e := json.Unmarshal(v, &mbc); e != nil {
+			return e
+		}
+		w.mbc = &mbc
+	case "Camera":
+		var mbc Camera
+		if e := json.Unmarshal(v, &mbc); e != nil {
+			return e
+		}
+		w.mbc = &mbc
+	case "ROMRAM":
+		var mbc ROMRAM
+		if e := json.Unmarshal(v, &mbc); e != nil {
+			return e
+		}
+		w.mbc = &mbc
+	case "MMM01":
+		var mbc MMM01
+		if e := json.Unmarshal(v, &mbc); e != nil {
+			return e
+		}
+		w.mbc = &mbc
+	case "TAMA5":
+		var mbc TAMA5
+		if e := json.Unmarshal(v, &mbc); e != nil {
+			return e
+		}
+		w.mbc = &mbc
+	case "HuC3":
+		var mbc HuC3
+		if e := json.Unmarshal(v, &mbc); e != nil {
+			return e
+		}
+		w.mbc = &mbc
 	default:
 		panic("Got unexpected type: " + t)
 	}
@@ -79,108 +127,103 @@ func (w *MbcWrapper) UnmarshalJSON(d []byte) error {
 	return nil
 }
 
-func getROMSize(sizeIndex byte) int {
-	if sizeIndex > 8 {
-		panic(fmt.Sprintf("Got invalid rom size index %d", sizeIndex))
-	}
-	return (1 << 15) << sizeIndex
+// the logo displayed by the boot rom, it has to be at 0x104-0x133 in the header for the game to boot
+var nintendoLogo = [48]byte{
+	0xCE, 0xED, 0x66, 0x66, 0xCC, 0x0D, 0x00, 0x0B, 0x03, 0x73, 0x00, 0x83, 0x00, 0x0C, 0x00, 0x0D,
+	0x00, 0x08, 0x11, 0x1F, 0x88, 0x89, 0x00, 0x0E, 0xDC, 0xCC, 0x6E, 0xE6, 0xDD, 0xDD, 0xD9, 0x99,
+	0xBB, 0xBB, 0x67, 0x63, 0x6E, 0x0E, 0xEC, 0xCC, 0xDD, 0xDC, 0x99, 0x9F, 0xBB, 0xB9, 0x33, 0x3E,
 }
 
-func getRAMSize(sizeIndex byte) int {
-	switch sizeIndex {
-	case 0:
-		return 0
-	case 1:
-		return 1 << 11
-	case 2:
-		return 1 << 13
-	case 3:
-		return 1 << 15
-	case 4:
-		return 1 << 17
-	case 5:
-		return 1 << 16
-	default:
-		panic(fmt.Sprintf("Got invalid rom size index %d", sizeIndex))
-	}
+// hasNintendoLogo checks the logo of the header at the start of the given rom area
+func hasNintendoLogo(rom []byte) bool {
+	return len(rom) >= 0x134 && string(rom[0x104:0x134]) == string(nintendoLogo[:])
+}
+
+// isCGBCartridge checks the CGB flag in the cartridge header
+// 0x80 means the game supports CGB functions but also works on DMG, 0xC0 means CGB only
+func isCGBCartridge(mbc MBC) bool {
+	return mbc.ReadMemory(0x143)&0x80 > 0
 }
 
 func NewMBC(rom []byte) MBC {
 
-	mbcNumber := rom[0x147]
+	if len(rom) < headerEnd {
+		panic(fmt.Sprintf("Rom has size %d, it is too small to have a header", len(rom)))
+	}
+
+	// the header at the start of a MMM01 rom is the one of the first game, the menu has the real one
+	offset := 0
+	if isMMM01(rom) {
+		offset = len(rom) - 0x8000
+	}
+	header := parseCartridgeHeaderAt(rom, offset)
+	if err := header.Validate(); err != nil {
+		fmt.Println("Warning:", err)
+	}
+	mbcNumber := header.CartridgeType
 
 	switch mbcNumber {
 	case 0x00:
-		return NewMBC0(rom)
+		return NewMBC0(rom, header)
 	case 0x01:
-		return NewMBC1(rom, false, false)
+		return NewMBC1(rom, header, false, false)
 	case 0x02:
-		return NewMBC1(rom, true, false)
+		return NewMBC1(rom, header, true, false)
 	case 0x03:
-		fmt.Println("WARNING: this games uses MBC1 with battery, presumably for saves, however GoGB doesnt support that")
-		return NewMBC1(rom, true, true)
+		return NewMBC1(rom, header, true, true)
 
 	case 0x05:
-		panic("MBC2 unimplemented")
+		return NewMBC2(rom, header, false)
 	case 0x06:
-		panic("MBC2 + RAM + Battery unimplemented")
+		return NewMBC2(rom, header, true)
 
 	case 0x08:
-		panic("ROM + RAM unimplemented")
+		return NewROMRAM(rom, header, false)
 	case 0x09:
-		panic("ROM + RAM + Battery unimplemented")
+		return NewROMRAM(rom, header, true)
 
-	case 0x0B:
-		panic("MMM01 unimplemented")
-	case 0x0C:
-		panic("MMM01 + RAM unimplemented")
-	case 0x0D:
-		panic("MMM01 + RAM + Battery unimplemented")
+	case 0x0B, 0x0C, 0x0D:
+		return NewMMM01(rom, header)
 
 	case 0x0F:
-		panic("MBC3 + Timer + Battery unimplemented")
+		return NewMBC3(rom, header, false, true, true)
 	case 0x10:
-		panic("MBC3 + RAM + Timer + Battery unimplemented")
+		return NewMBC3(rom, header, true, true, true)
 	case 0x11:
-		return NewMBC3(rom, false, false, false)
+		return NewMBC3(rom, header, false, false, false)
 	case 0x12:
-		return NewMBC3(rom, true, false, false)
+		return NewMBC3(rom, header, true, false, false)
 	case 0x13:
-		fmt.Println("WARNING: this games uses MBC3 with battery, presumably for saves, however GoGB doesnt support that")
-		return NewMBC3(rom, true, false, true)
+		return NewMBC3(rom, header, true, false, true)
 
 	case 0x19:
-		return NewMBC5(rom, false, false)
+		return NewMBC5(rom, header, false, false, false)
 	case 0x1A:
-		return NewMBC5(rom, true, false)
+		return NewMBC5(rom, header, true, false, false)
 	case 0x1B:
-		return NewMBC5(rom, true, true)
+		return NewMBC5(rom, header, true, true, false)
 	case 0x1C:
-		fmt.Println("WARNING: MBC5 with rumble requested")
-		return NewMBC5(rom, false, false)
+		return NewMBC5(rom, header, false, false, true)
 	case 0x1D:
-		fmt.Println("WARNING: MBC5 with rumble requested")
-		// what is Battery-backed rumble ??
-		return NewMBC5(rom, false, false)
+		return NewMBC5(rom, header, true, false, true)
 	case 0x1E:
-		fmt.Println("WARNING: MBC5 with rumble requested")
-		return NewMBC5(rom, true, true)
+		return NewMBC5(rom, header, true, true, true)
 
 	case 0x20:
 		panic("MBC6 + RAM + Battery unimplemented")
 	case 0x22:
-		panic("MBC7 + RAM + Bat. + Accelerometer unimplemented")
+		return NewMBC7(rom, header)
 
 	case 0xFC:
-		panic("POCKET CAMERA unimplemented")
+		return NewCamera(rom, header)
 	case 0xFD:
-		panic("BANDAI TAMA5 unimplemented")
+		return NewTAMA5(rom, header)
 	case 0xFE:
-		panic("HuC3 unimplemented")
+		return NewHuC3(rom, header)
 	case 0xFF:
-		panic("HuC1 + RAM + Battery unimplemented")
+		return NewHuC1(rom, header)
 
 	default:
-		panic(fmt.Sprintf("Got unusued mbcNumber %d\n", mbcNumber))
+		panic(fmt.Sprintf("Got unknown cartridge type 0x%02X in the header", mbcNumber))
 	}
 }
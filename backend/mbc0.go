@@ -6,14 +6,11 @@ type MBC0 struct {
 	Rom []byte
 }
 
-func NewMBC0(rom []byte) *MBC0 {
+func NewMBC0(rom []byte, header CartridgeHeader) *MBC0 {
 	m := new(MBC0)
 
-	if len(rom) > (1 << 15) {
-		panic("Cartridge has no MBC but the rom is larger than 32KB, this is inconsistent")
-	}
-
-	m.Rom = rom
+	// without MBC only 32KB can be mapped, an overdumped rom is truncated
+	m.Rom = fitROM(rom, header)[:1<<15]
 
 	return m
 }
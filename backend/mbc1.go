@@ -4,50 +4,101 @@ import "fmt"
 
 type MBC1 struct {
 	RamEnabled      bool
-	SelectedROMBank byte
+	SelectedROMBank byte // mapped at 0x4000-0x7FFF
 	SelectedRAMBank byte
 
+	// mapped at 0x0000-0x3FFF, only non zero in RAM mode on large cartridges
+	SelectedZeroBank byte
+
+	// BANK1 (0x2000-0x3FFF) and BANK2 (0x4000-0x5FFF) registers
+	Bank1 byte
+	Bank2 byte
+
 	Rom []byte
 	Ram []byte
 
 	ROMMode bool
 
-	NumRomBanks byte
+	// MBC1M: the games of multicart compilations are 16 banks each,
+	// BANK1 only has 4 bits connected and BANK2 selects the game
+	Multicart bool
+
+	NumRomBanks uint16
 	NumRamBanks byte
+	HasBattery  bool
 }
 
-func NewMBC1(rom []byte, useRam, useBattery bool) *MBC1 {
+func NewMBC1(rom []byte, header CartridgeHeader, useRam, useBattery bool) *MBC1 {
 	m := new(MBC1)
 
 	m.SelectedROMBank = 1
+	m.Bank1 = 1
 
-	headerSize := getROMSize(rom[0x0148])
-	if len(rom) != headerSize {
-		panic(fmt.Sprintf(
-			"Actual rom has size %d but header says it has size %d, this is inconsistent",
-			len(rom), headerSize))
-	}
-	m.Rom = rom
+	m.Rom = fitROM(rom, header)
 
-	m.NumRomBanks = byte(headerSize / 0x4000)
+	m.NumRomBanks = uint16(len(m.Rom) / 0x4000)
+	m.Multicart = isMBC1Multicart(m.Rom)
 
 	if useRam {
-		ramSize := getRAMSize(rom[0x0149])
+		ramSize := header.RAMSize()
 		m.NumRamBanks = byte(ramSize / 0x2000)
 		m.Ram = make([]byte, ramSize)
 	}
 
 	m.ROMMode = true
+	m.HasBattery = useBattery
 
 	return m
 }
 
+// isMBC1Multicart detects MBC1M cartridges, which have the same header as MBC1 cartridges
+// they are 8 Mbit and each game starts with its own Nintendo logo, every 16 banks
+func isMBC1Multicart(rom []byte) bool {
+	if len(rom) != 1<<20 {
+		return false
+	}
+
+	logos := 0
+	for bank := 0; bank < 0x40; bank += 0x10 {
+		if hasNintendoLogo(rom[bank*0x4000:]) {
+			logos++
+		}
+	}
+
+	// the menu and at least one game
+	return logos > 1
+}
+
+// updateBanks maps the banks selected by the BANK1, BANK2 and mode registers
+func (m *MBC1) updateBanks() {
+	shift := 5
+	bank1 := m.Bank1
+	if m.Multicart {
+		shift = 4
+		bank1 &= 0xF
+	}
+
+	m.SelectedROMBank = byte(uint16(m.Bank2<<shift|bank1) % m.NumRomBanks)
+
+	// in RAM mode, BANK2 also applies to 0x0000-0x3FFF and to the RAM
+	m.SelectedZeroBank = 0
+	m.SelectedRAMBank = 0
+	if !m.ROMMode {
+		m.SelectedZeroBank = byte(uint16(m.Bank2<<shift) % m.NumRomBanks)
+		if m.NumRamBanks > 0 {
+			m.SelectedRAMBank = m.Bank2 % m.NumRamBanks
+		}
+	}
+}
+
 func (m *MBC1) ReadMemory(address uint16) byte {
 
 	if address < 0x4000 {
-		return m.Rom[address]
-	}
-	if 0x4000 <= address && address < 0x8000 {
+
+		bankAddress := (uint32(m.SelectedZeroBank) * 0x4000) + uint32(address)
+		return m.Rom[bankAddress]
+
+	} else if 0x4000 <= address && address < 0x8000 {
 
 		offset := uint32(address) - 0x4000
 		bankAddress := (uint32(m.SelectedROMBank) * 0x4000) + offset
@@ -58,7 +109,7 @@ func (m *MBC1) ReadMemory(address uint16) byte {
 		if m.RamEnabled && len(m.Ram) > 0 {
 			offset := uint32(address) - 0xA000
 			bankAddress := (uint32(m.SelectedRAMBank) * 0x2000) + offset
-			return m.Ram[bankAddress]
+			return m.Ram[bankAddress%uint32(len(m.Ram))]
 		}
 
 		return 0xFF
@@ -74,50 +125,40 @@ func (m *MBC1) WriteMemory(address uint16, value byte) {
 		m.RamEnabled = value&0xF == 0xA
 
 	} else if 0x2000 <= address && address < 0x4000 {
-		value &= 0x1F // mask off lower 5 bits
-		if value%0x20 == 0 {
-			value++
-		}
-		m.SelectedROMBank &= 0x60
-		m.SelectedROMBank |= value
 
-		m.SelectedROMBank %= m.NumRomBanks
+		// bank 0 is mapped to bank 1, the check is done on the 5 bits even on multicart
+		m.Bank1 = value & 0x1F
+		if m.Bank1 == 0 {
+			m.Bank1 = 1
+		}
+		m.updateBanks()
 
 	} else if 0x4000 <= address && address < 0x6000 {
-		value &= 0b11
-		if m.ROMMode {
-			// in ROM mode
-			m.SelectedROMBank &= 0x1F
-			m.SelectedROMBank |= value << 5
-
-			// in ROM mode only RAM bank 0 can be used
-			m.SelectedRAMBank = 0
-		} else {
-			// in RAM mode
-			m.SelectedRAMBank = value
-
-			// in RAM mode, only ROM banks 0x01-0x1F can be used
-			m.SelectedROMBank &= 0x1F
-		}
 
-		m.SelectedROMBank %= m.NumRomBanks
-		if m.RamEnabled {
-			m.SelectedRAMBank %= m.NumRamBanks
-		}
+		m.Bank2 = value & 0b11
+		m.updateBanks()
 
 	} else if 0x6000 <= address && address < 0x8000 {
 
 		m.ROMMode = value&1 == 0
+		m.updateBanks()
 
 	} else if 0xA000 <= address && address < 0xC000 {
 
-		if m.RamEnabled {
+		if m.RamEnabled && len(m.Ram) > 0 {
 			offset := uint32(address) - 0xA000
 			bankAddress := (uint32(m.SelectedRAMBank) * 0x2000) + offset
-			m.Ram[bankAddress] = value
+			m.Ram[bankAddress%uint32(len(m.Ram))] = value
 		}
 
 	} else {
 		panic(fmt.Sprintf("Got unexpected write address not handled by MBC %d", address))
 	}
 }
+
+func (m *MBC1) batteryRAM() []byte {
+	if !m.HasBattery {
+		return nil
+	}
+	return m.Ram
+}
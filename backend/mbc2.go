@@ -0,0 +1,95 @@
+package backend
+
+import "fmt"
+
+const mbc2RamSize = 512
+
+// MBC2 supports up to 16 ROM banks and has 512 x 4 bits of RAM built into the chip
+type MBC2 struct {
+	RamEnabled      bool
+	SelectedROMBank byte
+
+	Rom []byte
+	Ram []byte
+
+	NumRomBanks uint16
+	HasBattery  bool
+}
+
+func NewMBC2(rom []byte, header CartridgeHeader, useBattery bool) *MBC2 {
+	m := new(MBC2)
+
+	m.SelectedROMBank = 1
+
+	m.Rom = fitROM(rom, header)
+
+	m.NumRomBanks = uint16(len(m.Rom) / 0x4000)
+
+	// the header RAM size is 0, the RAM is always there
+	m.Ram = make([]byte, mbc2RamSize)
+	m.HasBattery = useBattery
+
+	return m
+}
+
+func (m *MBC2) ReadMemory(address uint16) byte {
+
+	if address < 0x4000 {
+		return m.Rom[address]
+	}
+	if 0x4000 <= address && address < 0x8000 {
+
+		offset := uint32(address) - 0x4000
+		bankAddress := (uint32(m.SelectedROMBank) * 0x4000) + offset
+		return m.Rom[bankAddress]
+
+	} else if 0xA000 <= address && address < 0xC000 {
+
+		if m.RamEnabled {
+			// only the lower 9 bits are decoded, the RAM is echoed over the whole area
+			// the upper nibble isn't connected and reads as 1s
+			return 0xF0 | m.Ram[address&(mbc2RamSize-1)]
+		}
+
+		return 0xFF
+	}
+
+	panic(fmt.Sprintf("Got unexpected read address not handled by MBC %d", address))
+}
+
+func (m *MBC2) WriteMemory(address uint16, value byte) {
+
+	if address < 0x4000 {
+
+		// bit 8 of the address selects the register
+		if address&0x100 == 0 {
+			m.RamEnabled = value&0xF == 0xA
+		} else {
+			value &= 0xF
+			if value == 0 {
+				value++
+			}
+			m.SelectedROMBank = byte(uint16(value) % m.NumRomBanks)
+		}
+
+	} else if 0x4000 <= address && address < 0x8000 {
+
+		// no registers there
+
+	} else if 0xA000 <= address && address < 0xC000 {
+
+		if m.RamEnabled {
+			m.Ram[address&(mbc2RamSize-1)] = value & 0xF
+		}
+
+	} else {
+		panic(fmt.Sprintf("Got unexpected write address not handled by MBC %d", address))
+	}
+}
+
+func (m *MBC2) batteryRAM() []byte {
+	if !m.HasBattery {
+		return nil
+	}
+	return m.Ram
+}
@@ -9,27 +9,30 @@ type MBC3 struct {
 
 	Rom []byte
 	Ram []byte
+
+	Rtc *RTC // nil if the cartridge has no clock
+
+	HasBattery bool
 }
 
-func NewMBC3(rom []byte, useRam, useTimer, useBattery bool) *MBC3 {
+func NewMBC3(rom []byte, header CartridgeHeader, useRam, useTimer, useBattery bool) *MBC3 {
 	m := new(MBC3)
 
 	m.SelectedROMBank = 1
 
-	headerSize := getROMSize(rom[0x0148])
-	if len(rom) != headerSize {
-		panic(fmt.Sprintf(
-			"Actual rom has size %d but header says it has size %d, this is inconsistent",
-			len(rom), headerSize))
-	}
-	m.Rom = rom
+	m.Rom = fitROM(rom, header)
 
 	if useRam {
-		m.Ram = make([]byte, getRAMSize(rom[0x0149]))
+		m.Ram = make([]byte, header.RAMSize())
 	} else {
 		m.Ram = make([]byte, 0)
 	}
 
+	if useTimer {
+		m.Rtc = NewRTC()
+	}
+	m.HasBattery = useBattery
+
 	return m
 }
 
@@ -45,12 +48,14 @@ func (m *MBC3) ReadMemory(address uint16) byte {
 	}
 	if 0xA000 <= address && address < 0xC000 {
 		if m.RamEnabled {
-			if m.SelectedRAMBank < 8 {
+			if m.SelectedRAMBank < 8 && len(m.Ram) > 0 {
 				offset := uint32(address) - 0xA000
 				bankAddress := (uint32(m.SelectedRAMBank) * 0x2000) + offset
 				return m.Ram[bankAddress]
 			}
-			panic("MBC3: RTC unimplemented")
+			if m.Rtc != nil && 0x08 <= m.SelectedRAMBank && m.SelectedRAMBank <= 0x0C {
+				return m.Rtc.read(m.SelectedRAMBank - 0x08)
+			}
 		}
 		return 0xFF
 	}
@@ -77,10 +82,14 @@ func (m *MBC3) WriteMemory(address uint16, value byte) {
 		m.SelectedRAMBank = value
 
 	} else if 0x6000 <= address && address < 0x8000 {
-		// latch clock data
+		if m.Rtc != nil {
+			m.Rtc.latch(value)
+		}
 	} else if 0xA000 <= address && address < 0xC000 {
 
-		if m.RamEnabled && len(m.Ram) > 0 {
+		if m.RamEnabled && m.Rtc != nil && 0x08 <= m.SelectedRAMBank && m.SelectedRAMBank <= 0x0C {
+			m.Rtc.write(m.SelectedRAMBank-0x08, value)
+		} else if m.RamEnabled && len(m.Ram) > 0 && m.SelectedRAMBank < 8 {
 			offset := uint32(address) - 0xA000
 			bankAddress := (uint32(m.SelectedRAMBank) * 0x2000) + offset
 			m.Ram[bankAddress] = value
@@ -91,3 +100,17 @@ func (m *MBC3) WriteMemory(address uint16, value byte) {
 		panic(fmt.Sprintf("Got unexpected write address not handled by MBC %d", address))
 	}
 }
+
+func (m *MBC3) getClock() cartridgeClock {
+	if m.Rtc == nil {
+		return nil
+	}
+	return m.Rtc
+}
+
+func (m *MBC3) batteryRAM() []byte {
+	if !m.HasBattery {
+		return nil
+	}
+	return m.Ram
+}
@@ -10,34 +10,33 @@ type MBC5 struct {
 	Rom []byte
 	Ram []byte
 
-	NumRomBanks byte
+	NumRomBanks uint16
 	NumRamBanks byte
+	HasBattery  bool
+
+	// on rumble cartridges, bit 3 of the RAM bank register drives the motor instead of selecting a bank
+	HasRumble      bool
+	RumbleOn       bool
+	rumbleCallback func(on bool)
 }
 
-func NewMBC5(rom []byte, useRam, useBattery bool) *MBC5 {
+func NewMBC5(rom []byte, header CartridgeHeader, useRam, useBattery, useRumble bool) *MBC5 {
 	m := new(MBC5)
 
 	m.SelectedROMBank = 1
 
-	headerSize := getROMSize(rom[0x0148])
-	if len(rom) != headerSize {
-		panic(fmt.Sprintf(
-			"Actual rom has size %d but header says it has size %d, this is inconsistent",
-			len(rom), headerSize))
-	}
-	m.Rom = rom
+	m.Rom = fitROM(rom, header)
 
-	m.NumRomBanks = byte(headerSize / 0x4000)
+	m.NumRomBanks = uint16(len(m.Rom) / 0x4000)
 
 	if useRam {
-		ramSize := getRAMSize(rom[0x0149])
+		ramSize := header.RAMSize()
 		m.NumRamBanks = byte(ramSize / 0x2000)
-		m.Ram = make([]byte, getRAMSize(rom[0x0149]))
+		m.Ram = make([]byte, header.RAMSize())
 	}
 
-	if useBattery {
-		fmt.Println("MBC5 - WARNING: battery backed ram not implemented")
-	}
+	m.HasBattery = useBattery
+	m.HasRumble = useRumble
 
 	return m
 }
@@ -55,7 +54,7 @@ func (m *MBC5) ReadMemory(address uint16) byte {
 
 	} else if 0xA000 <= address && address < 0xC000 {
 
-		if m.RamEnabled {
+		if m.RamEnabled && len(m.Ram) > 0 {
 			offset := uint32(address) - 0xA000
 			bankAddress := (uint32(m.SelectedRAMBank) * 0x2000) + offset
 			return m.Ram[bankAddress]
@@ -75,15 +74,18 @@ func (m *MBC5) WriteMemory(address uint16, value byte) {
 
 	} else if 0x2000 <= address && address < 0x3000 {
 		m.SelectedROMBank = m.SelectedROMBank&0xFF00 | uint16(value)
-		m.SelectedROMBank %= uint16(m.NumRomBanks)
+		m.SelectedROMBank %= m.NumRomBanks
 	} else if 0x3000 <= address && address < 0x4000 {
 		m.SelectedROMBank = m.SelectedROMBank&0xFF | uint16(value)<<8
-		m.SelectedROMBank %= uint16(m.NumRomBanks)
+		m.SelectedROMBank %= m.NumRomBanks
 	} else if 0x4000 <= address && address < 0x6000 {
 
-		// either ram bank to use
-		// or RTC register to access
-		if m.RamEnabled {
+		if m.HasRumble {
+			m.setRumble(value&0x08 > 0)
+			value &= 0x07
+		}
+
+		if m.RamEnabled && m.NumRamBanks > 0 {
 			m.SelectedRAMBank = value % m.NumRamBanks
 		}
 
@@ -91,7 +93,7 @@ func (m *MBC5) WriteMemory(address uint16, value byte) {
 		// latch clock data
 	} else if 0xA000 <= address && address < 0xC000 {
 
-		if m.RamEnabled {
+		if m.RamEnabled && len(m.Ram) > 0 {
 			offset := uint32(address) - 0xA000
 			bankAddress := (uint32(m.SelectedRAMBank) * 0x2000) + offset
 			m.Ram[bankAddress] = value
@@ -102,3 +104,34 @@ func (m *MBC5) WriteMemory(address uint16, value byte) {
 		panic(fmt.Sprintf("Got unexpected write address not handled by MBC %d", address))
 	}
 }
+
+func (m *MBC5) batteryRAM() []byte {
+	if !m.HasBattery {
+		return nil
+	}
+	return m.Ram
+}
+
+// rumbleMBC is implemented by the MBCs which can have a rumble motor
+type rumbleMBC interface {
+	rumbling() bool
+	setRumbleCallback(callback func(on bool))
+}
+
+func (m *MBC5) setRumble(on bool) {
+	if on == m.RumbleOn {
+		return
+	}
+	m.RumbleOn = on
+	if m.rumbleCallback != nil {
+		m.rumbleCallback(on)
+	}
+}
+
+func (m *MBC5) rumbling() bool {
+	return m.RumbleOn
+}
+
+func (m *MBC5) setRumbleCallback(callback func(on bool)) {
+	m.rumbleCallback = callback
+}
@@ -0,0 +1,322 @@
+package backend
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// accelerometer value when the cartridge is flat, and change for a 1 g tilt
+	accelerometerCenter = 0x81D0
+	accelerometerScale  = 0x70
+
+	// the accelerometer registers read this value once erased, until they are latched
+	accelerometerErased = 0x8000
+
+	eepromSize = 256
+)
+
+// MBC7 is used by cartridges with an accelerometer, the save is kept in a serial EEPROM
+// instead of RAM, and both are accessed through registers at 0xA000-0xAFFF
+type MBC7 struct {
+	// the registers are only accessible when both are enabled
+	RamEnabled1     bool
+	RamEnabled2     bool
+	SelectedROMBank byte
+
+	Rom []byte
+
+	NumRomBanks uint16
+
+	// the accelerometer values are latched by the game
+	LatchedX uint16
+	LatchedY uint16
+	tiltX    float64
+	tiltY    float64
+
+	Eeprom EEPROM
+}
+
+func NewMBC7(rom []byte, header CartridgeHeader) *MBC7 {
+	m := new(MBC7)
+
+	m.SelectedROMBank = 1
+
+	m.Rom = fitROM(rom, header)
+
+	m.NumRomBanks = uint16(len(m.Rom) / 0x4000)
+
+	m.LatchedX = accelerometerErased
+	m.LatchedY = accelerometerErased
+
+	m.Eeprom = newEEPROM()
+
+	return m
+}
+
+func (m *MBC7) ReadMemory(address uint16) byte {
+
+	if address < 0x4000 {
+		return m.Rom[address]
+	}
+	if 0x4000 <= address && address < 0x8000 {
+
+		offset := uint32(address) - 0x4000
+		bankAddress := (uint32(m.SelectedROMBank) * 0x4000) + offset
+		return m.Rom[bankAddress]
+
+	} else if 0xA000 <= address && address < 0xC000 {
+
+		if !m.RamEnabled1 || !m.RamEnabled2 || address >= 0xB000 {
+			return 0xFF
+		}
+
+		// the register is selected by bits 4-7 of the address
+		switch (address >> 4) & 0xF {
+		case 0x2:
+			return byte(m.LatchedX)
+		case 0x3:
+			return byte(m.LatchedX >> 8)
+		case 0x4:
+			return byte(m.LatchedY)
+		case 0x5:
+			return byte(m.LatchedY >> 8)
+		case 0x6:
+			// Z axis, not connected
+			return 0x00
+		case 0x8:
+			return m.Eeprom.read()
+		default:
+			return 0xFF
+		}
+	}
+
+	panic(fmt.Sprintf("Got unexpected read address not handled by MBC %d", address))
+}
+
+func (m *MBC7) WriteMemory(address uint16, value byte) {
+
+	if address < 0x2000 {
+
+		m.RamEnabled1 = value == 0x0A
+
+	} else if 0x2000 <= address && address < 0x4000 {
+
+		m.SelectedROMBank = byte(uint16(value) % m.NumRomBanks)
+
+	} else if 0x4000 <= address && address < 0x6000 {
+
+		m.RamEnabled2 = value == 0x40
+
+	} else if 0x6000 <= address && address < 0x8000 {
+
+		// no registers there
+
+	} else if 0xA000 <= address && address < 0xC000 {
+
+		if !m.RamEnabled1 || !m.RamEnabled2 || address >= 0xB000 {
+			return
+		}
+
+		switch (address >> 4) & 0xF {
+		case 0x0:
+			if value == 0x55 {
+				m.LatchedX = accelerometerErased
+				m.LatchedY = accelerometerErased
+			}
+		case 0x1:
+			// the values can only be latched once erased
+			if value == 0xAA && m.LatchedX == accelerometerErased && m.LatchedY == accelerometerErased {
+				m.LatchedX = accelerometerValue(m.tiltX)
+				m.LatchedY = accelerometerValue(m.tiltY)
+			}
+		case 0x8:
+			m.Eeprom.write(value)
+		}
+
+	} else {
+		panic(fmt.Sprintf("Got unexpected write address not handled by MBC %d", address))
+	}
+}
+
+func accelerometerValue(tilt float64) uint16 {
+	return uint16(accelerometerCenter + int(tilt*accelerometerScale))
+}
+
+// setTilt sets the values measured by the accelerometer, in g
+func (m *MBC7) setTilt(x, y float64) {
+	m.tiltX, m.tiltY = x, y
+}
+
+func (m *MBC7) batteryRAM() []byte {
+	return m.Eeprom.Data
+}
+
+// EEPROM emulates the 93LC56 serial EEPROM of MBC7 cartridges, made of 128 words of 16 bits
+// the game drives the chip select, clock and data in lines and reads the data out line
+type EEPROM struct {
+	Data []byte // the words are stored little endian
+
+	CS  bool // chip select
+	CLK bool // clock, the data in line is sampled on the rising edge
+	DI  bool // data in
+	DO  bool // data out, or ready after a write
+
+	// command being received, made of a start bit, a 2 bit opcode, an 8 bit address and 16 data bits for writes
+	Started bool
+	Command uint32
+	Bits    int // bits received after the start bit
+
+	// READ shifts out the words starting from the given address until the chip is deselected
+	Reading     bool
+	ReadAddress byte
+	ReadBuffer  uint16
+	ReadBits    int // bits of ReadBuffer left to shift out
+
+	WriteEnabled bool
+}
+
+func newEEPROM() EEPROM {
+	e := EEPROM{Data: make([]byte, eepromSize)}
+	// blank EEPROMs read as 1s
+	for i := range e.Data {
+		e.Data[i] = 0xFF
+	}
+	e.DO = true
+	return e
+}
+
+func (e *EEPROM) word(address byte) uint16 {
+	return binary.LittleEndian.Uint16(e.Data[2*int(address&0x7F):])
+}
+
+func (e *EEPROM) setWord(address byte, value uint16) {
+	if e.WriteEnabled {
+		binary.LittleEndian.PutUint16(e.Data[2*int(address&0x7F):], value)
+	}
+}
+
+func (e *EEPROM) read() byte {
+	var value byte
+	if e.CS {
+		value |= 0x80
+	}
+	if e.CLK {
+		value |= 0x40
+	}
+	if e.DI {
+		value |= 0x02
+	}
+	if e.DO {
+		value |= 0x01
+	}
+	return value
+}
+
+func (e *EEPROM) write(value byte) {
+	cs := value&0x80 > 0
+	clk := value&0x40 > 0
+	di := value&0x02 > 0
+
+	if !cs {
+		// deselecting the chip aborts the current command, writes complete instantly so it is ready
+		e.Started = false
+		e.Reading = false
+		e.DO = true
+	} else if clk && !e.CLK {
+		e.clock(di)
+	}
+
+	e.CS, e.CLK, e.DI = cs, clk, di
+}
+
+// clock handles a rising edge of the clock
+func (e *EEPROM) clock(di bool) {
+	if e.Reading {
+		// sequential read: the next word follows without a dummy bit
+		if e.ReadBits == 0 {
+			e.ReadAddress = (e.ReadAddress + 1) & 0x7F
+			e.ReadBuffer = e.word(e.ReadAddress)
+			e.ReadBits = 16
+		}
+		e.DO = e.ReadBuffer&0x8000 > 0
+		e.ReadBuffer <<= 1
+		e.ReadBits--
+		return
+	}
+
+	if !e.Started {
+		// leading zeros are ignored until the start bit
+		if di {
+			e.Started = true
+			e.Command = 0
+			e.Bits = 0
+		}
+		return
+	}
+
+	e.Command <<= 1
+	if di {
+		e.Command |= 1
+	}
+	e.Bits++
+
+	switch e.Bits {
+	case 10:
+		e.runCommand()
+	case 26:
+		e.runWriteCommand()
+	}
+}
+
+// runCommand runs a command once its opcode and address were received
+func (e *EEPROM) runCommand() {
+	opcode := e.Command >> 8 & 0x3
+	address := byte(e.Command)
+
+	switch opcode {
+	case 0b10: // READ, a dummy 0 is output before the data
+		e.Started = false
+		e.Reading = true
+		e.ReadAddress = address & 0x7F
+		e.ReadBuffer = e.word(e.ReadAddress)
+		e.ReadBits = 16
+		e.DO = false
+	case 0b11: // ERASE
+		e.Started = false
+		e.setWord(address, 0xFFFF)
+	case 0b01: // WRITE, waits for the data
+	case 0b00:
+		switch address >> 6 {
+		case 0b00: // EWDS
+			e.Started = false
+			e.WriteEnabled = false
+		case 0b11: // EWEN
+			e.Started = false
+			e.WriteEnabled = true
+		case 0b10: // ERAL
+			e.Started = false
+			for i := byte(0); i < eepromSize/2; i++ {
+				e.setWord(i, 0xFFFF)
+			}
+		case 0b01: // WRAL, waits for the data
+		}
+	}
+}
+
+// runWriteCommand runs WRITE and WRAL once the data was received
+func (e *EEPROM) runWriteCommand() {
+	e.Started = false
+
+	opcode := e.Command >> 24 & 0x3
+	address := byte(e.Command >> 16)
+	data := uint16(e.Command)
+
+	if opcode == 0b01 {
+		e.setWord(address, data)
+		return
+	}
+	for i := byte(0); i < eepromSize/2; i++ {
+		e.setWord(i, data)
+	}
+}
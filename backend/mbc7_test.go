@@ -0,0 +1,133 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMBC7() *MBC7 {
+	m := NewMBC(makeBankedRom(0x22, 1, 0)).(*MBC7)
+	m.WriteMemory(0x0000, 0x0A)
+	m.WriteMemory(0x4000, 0x40)
+	return m
+}
+
+const mbc7EEPROM = 0xA080
+
+// sendEEPROMBits clocks the given bits into the EEPROM, most significant first
+func sendEEPROMBits(m *MBC7, value uint32, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		di := byte(value>>i&1) << 1
+		m.WriteMemory(mbc7EEPROM, 0x80|di)
+		m.WriteMemory(mbc7EEPROM, 0x80|0x40|di)
+	}
+}
+
+// receiveEEPROMBits clocks bits out of the EEPROM
+func receiveEEPROMBits(m *MBC7, bits int) uint32 {
+	var value uint32
+	for i := 0; i < bits; i++ {
+		m.WriteMemory(mbc7EEPROM, 0x80)
+		m.WriteMemory(mbc7EEPROM, 0x80|0x40)
+		value = value<<1 | uint32(m.ReadMemory(mbc7EEPROM)&1)
+	}
+	return value
+}
+
+func eepromCommand(m *MBC7, command uint32, bits int) {
+	m.WriteMemory(mbc7EEPROM, 0x00)
+	m.WriteMemory(mbc7EEPROM, 0x80)
+	// start bit
+	sendEEPROMBits(m, 1, 1)
+	sendEEPROMBits(m, command, bits)
+}
+
+func eepromRead(t *testing.T, m *MBC7, address byte) uint16 {
+	eepromCommand(m, 0b10<<8|uint32(address), 10)
+	// dummy bit
+	assert.Equal(t, byte(0), m.ReadMemory(mbc7EEPROM)&1)
+	return uint16(receiveEEPROMBits(m, 16))
+}
+
+func TestMBC7EEPROM(t *testing.T) {
+	m := newTestMBC7()
+	assert.Equal(t, uint16(0xFFFF), eepromRead(t, m, 3))
+
+	// writes are ignored until enabled
+	eepromCommand(m, 0b01<<24|3<<16|0x1234, 26)
+	assert.Equal(t, uint16(0xFFFF), eepromRead(t, m, 3))
+
+	// EWEN
+	eepromCommand(m, 0b0011<<6, 10)
+	eepromCommand(m, 0b01<<24|3<<16|0x1234, 26)
+	eepromCommand(m, 0b01<<24|4<<16|0x5678, 26)
+	assert.Equal(t, uint16(0x1234), eepromRead(t, m, 3))
+
+	// the chip is ready once deselected
+	m.WriteMemory(mbc7EEPROM, 0x00)
+	assert.Equal(t, byte(1), m.ReadMemory(mbc7EEPROM)&1)
+
+	// sequential read
+	eepromCommand(m, 0b10<<8|3, 10)
+	assert.Equal(t, uint32(0x12345678), receiveEEPROMBits(m, 32))
+
+	// the words are stored little endian
+	assert.Equal(t, []byte{0x34, 0x12, 0x78, 0x56}, m.Eeprom.Data[6:10])
+
+	// ERASE
+	eepromCommand(m, 0b11<<8|3, 10)
+	assert.Equal(t, uint16(0xFFFF), eepromRead(t, m, 3))
+
+	// WRAL then ERAL
+	eepromCommand(m, 0b0001<<22|0xABCD, 26)
+	assert.Equal(t, uint16(0xABCD), eepromRead(t, m, 0x7F))
+	eepromCommand(m, 0b0010<<6, 10)
+	assert.Equal(t, uint16(0xFFFF), eepromRead(t, m, 0))
+
+	// EWDS
+	eepromCommand(m, 0b0000<<6, 10)
+	eepromCommand(m, 0b01<<24|3<<16|0x1234, 26)
+	assert.Equal(t, uint16(0xFFFF), eepromRead(t, m, 3))
+
+	assert.Equal(t, m.Eeprom.Data, getBatteryRAM(m))
+}
+
+func TestMBC7Accelerometer(t *testing.T) {
+	m := newTestMBC7()
+	emulator := NewEmulator(withMBC(m), WithDisableApu())
+
+	readAxis := func(address uint16) uint16 {
+		return uint16(m.ReadMemory(address+0x10))<<8 | uint16(m.ReadMemory(address))
+	}
+
+	emulator.SetTilt(0.5, -1)
+
+	assert.Equal(t, uint16(accelerometerErased), readAxis(0xA020))
+	m.WriteMemory(0xA010, 0xAA)
+	assert.Equal(t, uint16(0x81D0+0x38), readAxis(0xA020))
+	assert.Equal(t, uint16(0x81D0-0x70), readAxis(0xA040))
+
+	// the values can't be latched again until erased
+	emulator.SetTilt(0, 0)
+	m.WriteMemory(0xA010, 0xAA)
+	assert.Equal(t, uint16(0x81D0+0x38), readAxis(0xA020))
+
+	m.WriteMemory(0xA000, 0x55)
+	assert.Equal(t, uint16(accelerometerErased), readAxis(0xA020))
+	m.WriteMemory(0xA010, 0xAA)
+	assert.Equal(t, uint16(0x81D0), readAxis(0xA020))
+	assert.Equal(t, uint16(0x81D0), readAxis(0xA040))
+
+	// both RAM enable registers have to be set
+	m.WriteMemory(0x4000, 0)
+	assert.Equal(t, byte(0xFF), m.ReadMemory(0xA020))
+}
+
+func TestMarshalMbc7(t *testing.T) {
+	m := newTestMBC7()
+	m.LatchedX = 0x1234
+	m.Eeprom.Data[5] = 0x42
+
+	runTest(t, m)
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -19,14 +20,14 @@ func TestRunMbcTests(t *testing.T) {
 		"mbc1/bits_bank2.gb",
 		"mbc1/bits_mode.gb",
 		"mbc1/bits_ramg.gb",
-		// "mbc1/multicart_rom_8Mb.gb",
+		"mbc1/multicart_rom_8Mb.gb",
 		"mbc1/ram_64kb.gb",
 		"mbc1/ram_256kb.gb",
 		"mbc1/rom_1Mb.gb",
 		"mbc1/rom_2Mb.gb",
 		"mbc1/rom_4Mb.gb",
-		// "mbc1/rom_8Mb.gb",
-		// "mbc1/rom_16Mb.gb",
+		"mbc1/rom_8Mb.gb",
+		"mbc1/rom_16Mb.gb",
 		"mbc1/rom_512kb.gb",
 
 		"mbc5/rom_1Mb.gb",
@@ -67,6 +68,28 @@ func makeRom() []byte {
 	return rom
 }
 
+// makeBankedRom returns a rom with the given cartridge type and size codes, which loops at the entry point,
+// each bank has its number at offset 0x200
+func makeBankedRom(cartType, romSize, ramSize byte) []byte {
+	rom := make([]byte, (1<<15)<<romSize)
+	rom[0x100] = 0x18 // JR -2
+	rom[0x101] = 0xFE
+	rom[0x147] = cartType
+	rom[0x148] = romSize
+	rom[0x149] = ramSize
+	for bank := 0; bank < len(rom)/0x4000; bank++ {
+		rom[bank*0x4000+0x200] = byte(bank)
+	}
+	return rom
+}
+
+// withMBC sets the cartridge of the emulator
+func withMBC(mbc MBC) func(*Emulator) {
+	return func(e *Emulator) {
+		e.mbc = mbc
+	}
+}
+
 func runTest(t *testing.T, m MBC) {
 	wrapped := MbcWrapper{m}
 
@@ -85,13 +108,14 @@ func runTest(t *testing.T, m MBC) {
 
 func TestMarshalMbc0(t *testing.T) {
 	rom := make([]byte, 32768)
-	mbc := NewMBC0(rom)
+	mbc := NewMBC0(rom, ParseCartridgeHeader(rom))
 
 	runTest(t, mbc)
 }
 
 func TestMarshalMbc1(t *testing.T) {
-	mbc := NewMBC1(makeRom(), true, false)
+	rom := makeRom()
+	mbc := NewMBC1(rom, ParseCartridgeHeader(rom), true, false)
 	mbc.NumRomBanks = 1
 	mbc.NumRamBanks = 2
 	mbc.SelectedRAMBank = 3
@@ -101,7 +125,8 @@ func TestMarshalMbc1(t *testing.T) {
 }
 
 func TestMarshalMbc3(t *testing.T) {
-	mbc := NewMBC3(makeRom(), true, false, false)
+	rom := makeRom()
+	mbc := NewMBC3(rom, ParseCartridgeHeader(rom), true, false, false)
 	mbc.SelectedRAMBank = 3
 	mbc.SelectedROMBank = 4
 	mbc.RamEnabled = true
@@ -110,7 +135,8 @@ func TestMarshalMbc3(t *testing.T) {
 }
 
 func TestMarshalMbc5(t *testing.T) {
-	mbc := NewMBC5(makeRom(), true, false)
+	rom := makeRom()
+	mbc := NewMBC5(rom, ParseCartridgeHeader(rom), true, false, false)
 	mbc.NumRomBanks = 1
 	mbc.NumRamBanks = 2
 	mbc.SelectedRAMBank = 3
@@ -119,3 +145,333 @@ func TestMarshalMbc5(t *testing.T) {
 
 	runTest(t, mbc)
 }
+
+func TestMarshalMbc2(t *testing.T) {
+	rom := makeRom()
+	mbc := NewMBC2(rom, ParseCartridgeHeader(rom), true)
+	mbc.SelectedROMBank = 3
+	mbc.RamEnabled = true
+	mbc.Ram[0x1FF] = 0xA
+
+	runTest(t, mbc)
+}
+
+func TestMBC2ROMBanking(t *testing.T) {
+	mbc := NewMBC(makeBankedRom(0x06, 3, 0)).(*MBC2)
+	assert.True(t, mbc.HasBattery)
+	assert.Equal(t, byte(1), mbc.ReadMemory(0x4200))
+
+	// bit 8 of the address set selects the ROM bank register
+	mbc.WriteMemory(0x2100, 5)
+	assert.Equal(t, byte(5), mbc.ReadMemory(0x4200))
+	mbc.WriteMemory(0x0100, 0xF7)
+	assert.Equal(t, byte(7), mbc.ReadMemory(0x4200))
+
+	// bank 0 maps to bank 1
+	mbc.WriteMemory(0x3FFF, 0x10)
+	assert.Equal(t, byte(1), mbc.ReadMemory(0x4200))
+
+	// bit 8 clear selects the RAM enable register
+	mbc.WriteMemory(0x2000, 0x0A)
+	assert.Equal(t, byte(1), mbc.ReadMemory(0x4200))
+	assert.True(t, mbc.RamEnabled)
+}
+
+func TestMBC2RAM(t *testing.T) {
+	rom := makeBankedRom(0x06, 3, 0)
+	mbc := NewMBC2(rom, ParseCartridgeHeader(rom), false)
+
+	mbc.WriteMemory(0xA000, 0x5)
+	assert.Equal(t, byte(0xFF), mbc.ReadMemory(0xA000))
+
+	mbc.WriteMemory(0x0000, 0x0A)
+	mbc.WriteMemory(0xA000, 0x5)
+	mbc.WriteMemory(0xA1FF, 0xC3)
+
+	// only the lower nibble is stored, the upper one reads as 1s
+	assert.Equal(t, byte(0xF5), mbc.ReadMemory(0xA000))
+	assert.Equal(t, byte(0xF3), mbc.ReadMemory(0xA1FF))
+
+	// the 512 cells are echoed over 0xA000-0xBFFF
+	assert.Equal(t, byte(0xF5), mbc.ReadMemory(0xA200))
+	assert.Equal(t, byte(0xF3), mbc.ReadMemory(0xBFFF))
+	mbc.WriteMemory(0xB000, 0x9)
+	assert.Equal(t, byte(0xF9), mbc.ReadMemory(0xA000))
+
+	mbc.WriteMemory(0x0000, 0x00)
+	assert.Equal(t, byte(0xFF), mbc.ReadMemory(0xA000))
+}
+
+func TestMBC1MulticartDetection(t *testing.T) {
+	for r, expected := range map[string]bool{
+		"mbc1/multicart_rom_8Mb.gb": true,
+		"mbc1/rom_8Mb.gb":           false,
+		"mbc1/rom_512kb.gb":         false,
+	} {
+		emulator := NewEmulator(WithRom(path.Join(mbcTestRomPath, r)), WithDisableApu())
+		assert.Equal(t, expected, emulator.mbc.(*MBC1).Multicart, r)
+	}
+}
+
+func TestMBC5Rumble(t *testing.T) {
+	var events []bool
+	emulator := NewEmulator(withMBC(NewMBC(makeBankedRom(0x1E, 1, 3))),
+		WithRumbleCallback(func(on bool) { events = append(events, on) }), WithDisableApu())
+	mbc := emulator.mbc.(*MBC5)
+
+	mbc.WriteMemory(0x0000, 0x0A)
+	mbc.WriteMemory(0x4000, 0x00)
+	mbc.WriteMemory(0xA000, 0x12)
+
+	// bit 3 turns the motor on, it doesn't select a RAM bank
+	mbc.WriteMemory(0x4000, 0x08)
+	assert.True(t, emulator.IsRumbling())
+	assert.Equal(t, byte(0x12), mbc.ReadMemory(0xA000))
+
+	mbc.WriteMemory(0x4000, 0x09)
+	assert.Equal(t, byte(1), mbc.SelectedRAMBank)
+	mbc.WriteMemory(0x4000, 0x01)
+	assert.False(t, emulator.IsRumbling())
+
+	// the callback is only called when the motor state changes
+	assert.Equal(t, []bool{true, false}, events)
+}
+
+func TestMBC5WithoutRumble(t *testing.T) {
+	emulator := NewEmulator(withMBC(NewMBC(makeBankedRom(0x1B, 1, 3))), WithDisableApu())
+	mbc := emulator.mbc.(*MBC5)
+
+	mbc.WriteMemory(0x0000, 0x0A)
+	mbc.WriteMemory(0x4000, 0x0B)
+	assert.False(t, emulator.IsRumbling())
+	assert.Equal(t, byte(0x0B%4), mbc.SelectedRAMBank)
+
+	// rumble without RAM
+	mbc = NewMBC(makeBankedRom(0x1C, 1, 0)).(*MBC5)
+	mbc.WriteMemory(0x0000, 0x0A)
+	mbc.WriteMemory(0x4000, 0x08)
+	assert.True(t, mbc.RumbleOn)
+	assert.Equal(t, byte(0xFF), mbc.ReadMemory(0xA000))
+}
+
+func TestMBC5With512Banks(t *testing.T) {
+	// 8MB, the number of banks doesn't fit in a byte
+	rom := make([]byte, 1<<23)
+	rom[0x147] = 0x19
+	rom[0x148] = 8
+	for bank := 0; bank < 512; bank++ {
+		rom[bank*0x4000] = byte(bank)
+		rom[bank*0x4000+1] = byte(bank >> 8)
+	}
+
+	mbc := NewMBC(rom).(*MBC5)
+	assert.Equal(t, uint16(512), mbc.NumRomBanks)
+
+	mbc.WriteMemory(0x2000, 0xFF)
+	mbc.WriteMemory(0x3000, 0x01)
+	assert.Equal(t, byte(0xFF), mbc.ReadMemory(0x4000))
+	assert.Equal(t, byte(0x01), mbc.ReadMemory(0x4001))
+
+	mbc.WriteMemory(0x2000, 0x00)
+	mbc.WriteMemory(0x3000, 0x00)
+	assert.Equal(t, byte(0x00), mbc.ReadMemory(0x4000))
+	assert.Equal(t, byte(0x00), mbc.ReadMemory(0x4001))
+}
+
+func TestNewMBCCartridgeTypes(t *testing.T) {
+	cartridgeTypes := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x05, 0x06, 0x08, 0x09, 0x0B, 0x0C, 0x0D,
+		0x0F, 0x10, 0x11, 0x12, 0x13, 0x19, 0x1A, 0x1B, 0x1C, 0x1D, 0x1E,
+		0x22, 0xFC, 0xFD, 0xFE, 0xFF,
+	}
+	for _, cartridgeType := range cartridgeTypes {
+		rom := makeRom()
+		if cartridgeType == 0x00 || cartridgeType == 0x08 || cartridgeType == 0x09 {
+			rom = rom[:0x8000]
+			rom[0x148] = 0
+		}
+		rom[0x147] = cartridgeType
+		assert.NotPanics(t, func() { NewMBC(rom) }, "cartridge type 0x%02X", cartridgeType)
+	}
+
+	rom := makeRom()
+	rom[0x147] = 0x20
+	assert.PanicsWithValue(t, "MBC6 + RAM + Battery unimplemented", func() { NewMBC(rom) })
+	rom[0x147] = 0x04
+	assert.PanicsWithValue(t, "Got unknown cartridge type 0x04 in the header", func() { NewMBC(rom) })
+}
+
+func TestROMRAM(t *testing.T) {
+	rom := make([]byte, 0x8000)
+	rom[0x147] = 0x09
+	rom[0x149] = 2
+	rom[0x7FFF] = 0x12
+
+	m := NewMBC(rom).(*ROMRAM)
+	assert.Equal(t, byte(0x12), m.ReadMemory(0x7FFF))
+
+	// the RAM is always enabled and there are no registers
+	m.WriteMemory(0x0000, 0x00)
+	m.WriteMemory(0xA000, 0x34)
+	m.WriteMemory(0xBFFF, 0x56)
+	assert.Equal(t, byte(0x34), m.ReadMemory(0xA000))
+	assert.Equal(t, byte(0x56), m.ReadMemory(0xBFFF))
+	assert.Equal(t, m.Ram, getBatteryRAM(m))
+
+	rom[0x147] = 0x08
+	assert.Nil(t, getBatteryRAM(NewMBC(rom)))
+
+	rom[0x149] = 3
+	assert.Panics(t, func() { NewMBC(rom) })
+
+	runTest(t, m)
+}
+
+// makeMMM01Rom returns a 256KB banked rom with the menu in banks 14 and 15
+func makeMMM01Rom() []byte {
+	// header of the first game
+	rom := makeBankedRom(0x01, 3, 0)
+	rom[0x148] = 1
+
+	menu := rom[14*0x4000:]
+	copy(menu[0x104:], nintendoLogo[:])
+	menu[0x147] = 0x0D
+	menu[0x148] = 3
+	menu[0x149] = 3
+	return rom
+}
+
+func TestMMM01MenuLock(t *testing.T) {
+	m := NewMBC(makeMMM01Rom()).(*MMM01)
+	assert.True(t, m.HasBattery)
+	assert.Len(t, m.Ram, 1<<15)
+
+	// the menu is mapped at startup
+	assert.Equal(t, byte(14), m.ReadMemory(0x0200))
+	assert.Equal(t, byte(15), m.ReadMemory(0x4200))
+	m.WriteMemory(0x2000, 0x03)
+	assert.Equal(t, byte(15), m.ReadMemory(0x4200))
+
+	// start the 64KB game in banks 4-7, with RAM bank 1
+	m.WriteMemory(0x2000, 0x04)
+	m.WriteMemory(0x6000, 0x0E<<2)
+	m.WriteMemory(0x4000, 0x01)
+	m.WriteMemory(0x0000, 0x40|0x30)
+	assert.True(t, m.Mapped)
+
+	assert.Equal(t, byte(4), m.ReadMemory(0x0200))
+	assert.Equal(t, byte(5), m.ReadMemory(0x4200))
+
+	// the game only controls the lower bits of the bank
+	m.WriteMemory(0x2000, 0x02)
+	assert.Equal(t, byte(6), m.ReadMemory(0x4200))
+	m.WriteMemory(0x2000, 0x1F)
+	assert.Equal(t, byte(7), m.ReadMemory(0x4200))
+	m.WriteMemory(0x2000, 0x00)
+	assert.Equal(t, byte(5), m.ReadMemory(0x4200))
+
+	// the menu can't be mapped back, and the outer bank and masks are locked
+	m.WriteMemory(0x0000, 0x00)
+	m.WriteMemory(0x6000, 0x00)
+	m.WriteMemory(0x4000, 0x30)
+	assert.True(t, m.Mapped)
+	assert.Equal(t, byte(4), m.ReadMemory(0x0200))
+	m.WriteMemory(0x2000, 0x1F)
+	assert.Equal(t, byte(7), m.ReadMemory(0x4200))
+
+	// the RAM bank is fixed by the menu
+	m.WriteMemory(0x0000, 0x0A)
+	m.WriteMemory(0x6000, 0x01)
+	m.WriteMemory(0x4000, 0x02)
+	m.WriteMemory(0xA000, 0x55)
+	assert.Equal(t, byte(0x55), m.Ram[0x2000])
+	m.WriteMemory(0x0000, 0x00)
+	assert.Equal(t, byte(0xFF), m.ReadMemory(0xA000))
+
+	runTest(t, m)
+}
+
+func TestMMM01Detection(t *testing.T) {
+	rom := makeMMM01Rom()
+	assert.IsType(t, &MBC1{}, NewMBC(rom[:1<<16]))
+
+	// without a valid logo, the last bank is just data
+	rom[14*0x4000+0x104] = 0
+	rom[0x148] = 3
+	assert.IsType(t, &MBC1{}, NewMBC(rom))
+}
+
+func tama5Write(m *TAMA5, register, value byte) {
+	m.WriteMemory(0xA001, register)
+	m.WriteMemory(0xA000, value)
+}
+
+func tama5Read(m *TAMA5, register byte) byte {
+	m.WriteMemory(0xA001, register)
+	return m.ReadMemory(0xA000) & 0xF
+}
+
+// tama5Run runs a command with the given 8 bit value and 5 bit address, and returns the result
+func tama5Run(m *TAMA5, command, value, address byte) byte {
+	tama5Write(m, tama5ValueLow, value&0xF)
+	tama5Write(m, tama5ValueHigh, value>>4)
+	tama5Write(m, tama5Command, command<<1|address>>4)
+	tama5Write(m, tama5AddressLow, address&0xF)
+	return tama5Read(m, tama5ResultHigh)<<4 | tama5Read(m, tama5ResultLow)
+}
+
+func TestTAMA5(t *testing.T) {
+	m := NewMBC(makeBankedRom(0xFD, 4, 0)).(*TAMA5)
+
+	assert.Equal(t, byte(1), tama5Read(m, tama5Ready))
+
+	tama5Write(m, tama5ROMBankLow, 0x5)
+	assert.Equal(t, byte(5), m.ReadMemory(0x4200))
+	tama5Write(m, tama5ROMBankHigh, 0x1)
+	assert.Equal(t, byte(0x15), m.ReadMemory(0x4200))
+
+	tama5Run(m, tama5WriteRAM, 0xAB, 0x13)
+	assert.Equal(t, byte(0xAB), m.Ram[0x13])
+	assert.Equal(t, byte(0xAB), tama5Run(m, tama5ReadRAM, 0, 0x13))
+	assert.Equal(t, byte(0x00), tama5Run(m, tama5ReadRAM, 0, 0x03))
+
+	runTest(t, m)
+}
+
+func TestTAMA5Clock(t *testing.T) {
+	now := setTestTime(t)
+	path := filepath.Join(t.TempDir(), "game.sav")
+
+	rom := makeBankedRom(0xFD, 4, 0)
+	emulator := NewEmulator(withMBC(NewMBC(rom)), WithDisableApu())
+	emulator.SetBatterySave(path)
+	m := emulator.mbc.(*TAMA5)
+
+	tama5Run(m, tama5Clock, 0x23, tama5WriteHours)
+	tama5Run(m, tama5Clock, 0x59, tama5WriteMinutes)
+	assert.Equal(t, byte(0x23), tama5Run(m, tama5Clock, 0, tama5ReadHours))
+	assert.Equal(t, byte(0x59), tama5Run(m, tama5Clock, 0, tama5ReadMinutes))
+
+	m.Clock.tick(rtcDotsPerSecond * 60)
+	assert.Equal(t, byte(0x00), tama5Run(m, tama5Clock, 0, tama5ReadHours))
+	assert.Equal(t, byte(0x00), tama5Run(m, tama5Clock, 0, tama5ReadMinutes))
+
+	// a stopped clock doesn't count
+	tama5Run(m, tama5Clock, 0, tama5StopClock)
+	m.Clock.tick(rtcDotsPerSecond * 60)
+	assert.Equal(t, byte(0x00), tama5Run(m, tama5Clock, 0, tama5ReadMinutes))
+	tama5Run(m, tama5Clock, 0, tama5StartClock)
+	m.Clock.tick(rtcDotsPerSecond * 60)
+	assert.Equal(t, byte(0x01), tama5Run(m, tama5Clock, 0, tama5ReadMinutes))
+
+	// the RAM and the clock are saved, the time elapsed while the emulator was closed is applied
+	tama5Run(m, tama5WriteRAM, 0x42, 0x00)
+	assert.NoError(t, emulator.FlushBatterySave())
+
+	*now = now.Add(2 * time.Hour)
+	emulator = NewEmulator(withMBC(NewMBC(rom)), WithBatterySave(path), WithDisableApu())
+	m = emulator.mbc.(*TAMA5)
+	assert.Equal(t, byte(0x42), m.Ram[0])
+	assert.Equal(t, byte(0x02), tama5Run(m, tama5Clock, 0, tama5ReadHours))
+	assert.Equal(t, byte(0x01), tama5Run(m, tama5Clock, 0, tama5ReadMinutes))
+}
@@ -0,0 +1,186 @@
+package backend
+
+import "fmt"
+
+// MMM01 holds several games behind a menu, stored in the last 32KB of the rom, which is mapped at startup
+// the menu sets the outer bank and the size of the game, then maps the game which sees an MBC1:
+// from then on only the bits of the bank registers not fixed by the menu can be changed
+type MMM01 struct {
+	RamEnabled bool
+	// set when the menu starts the game, locks the outer banks and the masks
+	Mapped bool
+
+	RomBankLow  byte // bits 0-4 of the bank
+	RomBankMid  byte // bits 5-6
+	RomBankHigh byte // bits 7-8
+	RomBankMask byte // bits 1-4 of RomBankLow fixed by the menu, from bit 0
+
+	RamBankLow  byte // bits 0-1 of the bank
+	RamBankHigh byte // bits 2-3
+	RamBankMask byte // bits of RamBankLow fixed by the menu
+
+	// MBC1 banking mode, RamBankLow only selects the RAM bank in mode 1
+	Mode       byte
+	ModeLocked bool
+
+	Rom []byte
+	Ram []byte
+
+	NumRomBanks uint16
+	NumRamBanks byte
+	HasBattery  bool
+}
+
+// isMMM01 detects MMM01 roms, which have the header of the menu at the start of the last 32KB
+// rather than at the start of the rom, where the first game is
+func isMMM01(rom []byte) bool {
+	if len(rom) <= 0x8000 {
+		return false
+	}
+	menu := rom[len(rom)-0x8000:]
+	mbcNumber := menu[0x147]
+	return 0x0B <= mbcNumber && mbcNumber <= 0x0D && hasNintendoLogo(menu)
+}
+
+// NewMMM01 takes the header of the menu, found by isMMM01
+func NewMMM01(rom []byte, header CartridgeHeader) *MMM01 {
+	m := new(MMM01)
+
+	m.Rom = fitROM(rom, header)
+
+	m.NumRomBanks = uint16(len(m.Rom) / 0x4000)
+
+	if header.CartridgeType != 0x0B {
+		ramSize := header.RAMSize()
+		m.NumRamBanks = byte(ramSize / 0x2000)
+		m.Ram = make([]byte, ramSize)
+	}
+
+	m.HasBattery = header.CartridgeType == 0x0D
+
+	return m
+}
+
+// bits of RomBankLow which the game can change
+func (m *MMM01) romGameBits() byte {
+	if !m.Mapped {
+		return 0x1F
+	}
+	return 0x1F &^ (m.RomBankMask << 1)
+}
+
+// bits of RamBankLow which the game can change
+func (m *MMM01) ramGameBits() byte {
+	if !m.Mapped {
+		return 0x3
+	}
+	return 0x3 &^ m.RamBankMask
+}
+
+func (m *MMM01) romBank(address uint16) uint32 {
+	var bank uint32
+	if !m.Mapped {
+		// the menu is in the last 32KB
+		bank = uint32(m.NumRomBanks) - 2
+		if address >= 0x4000 {
+			bank++
+		}
+		return bank
+	}
+
+	outer := uint32(m.RomBankHigh)<<7 | uint32(m.RomBankMid)<<5
+	low := m.RomBankLow
+	if address < 0x4000 {
+		low &^= m.romGameBits()
+	} else if low&m.romGameBits() == 0 {
+		low |= 1
+	}
+	bank = outer | uint32(low)
+
+	return bank % uint32(m.NumRomBanks)
+}
+
+func (m *MMM01) ramAddress(address uint16) uint32 {
+	low := m.RamBankLow
+	if m.Mode == 0 {
+		low &^= m.ramGameBits()
+	}
+	bank := uint32(m.RamBankHigh)<<2 | uint32(low)
+
+	offset := uint32(address) - 0xA000
+	return (bank*0x2000 + offset) % uint32(len(m.Ram))
+}
+
+func (m *MMM01) ReadMemory(address uint16) byte {
+
+	if address < 0x8000 {
+
+		offset := uint32(address) & 0x3FFF
+		return m.Rom[m.romBank(address)*0x4000+offset]
+
+	} else if 0xA000 <= address && address < 0xC000 {
+
+		if m.RamEnabled && len(m.Ram) > 0 {
+			return m.Ram[m.ramAddress(address)]
+		}
+		return 0xFF
+	}
+
+	panic(fmt.Sprintf("Got unexpected read address not handled by MBC %d", address))
+}
+
+func (m *MMM01) WriteMemory(address uint16, value byte) {
+
+	if address < 0x2000 {
+
+		m.RamEnabled = value&0xF == 0xA
+		if !m.Mapped {
+			m.RamBankMask = value >> 4 & 0x3
+			// the menu lock: once set, it can only be cleared by a reset
+			m.Mapped = value&0x40 > 0
+		}
+
+	} else if 0x2000 <= address && address < 0x4000 {
+
+		bits := m.romGameBits()
+		m.RomBankLow = m.RomBankLow&^bits | value&bits
+		if !m.Mapped {
+			m.RomBankMid = value >> 5 & 0x3
+		}
+
+	} else if 0x4000 <= address && address < 0x6000 {
+
+		bits := m.ramGameBits()
+		m.RamBankLow = m.RamBankLow&^bits | value&bits
+		if !m.Mapped {
+			m.RamBankHigh = value >> 2 & 0x3
+			m.RomBankHigh = value >> 4 & 0x3
+			m.ModeLocked = value&0x40 > 0
+		}
+
+	} else if 0x6000 <= address && address < 0x8000 {
+
+		if !m.Mapped || !m.ModeLocked {
+			m.Mode = value & 1
+		}
+		if !m.Mapped {
+			m.RomBankMask = value >> 2 & 0xF
+		}
+
+	} else if 0xA000 <= address && address < 0xC000 {
+
+		if m.RamEnabled && len(m.Ram) > 0 {
+			m.Ram[m.ramAddress(address)] = value
+		}
+
+	} else {
+		panic(fmt.Sprintf("Got unexpected write address not handled by MBC %d", address))
+	}
+}
+
+func (m *MMM01) batteryRAM() []byte {
+	if !m.HasBattery {
+		return nil
+	}
+	return m.Ram
+}
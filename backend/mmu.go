@@ -3,9 +3,42 @@ package backend
 type MMU struct {
 	ram []byte
 
+	// hardware model being emulated, cgb is set when running in CGB mode
+	model Model
+	cgb   bool
+
+	// CGB only: banked VRAM (VBK, 0xFF4F) and WRAM (SVBK, 0xFF70)
+	// bank 0 of each aliases the corresponding section of ram so that DMG carts are unaffected
+	vram [][]byte
+	wram [][]byte
+
+	// CGB only: palette RAM, 8 palettes of 4 RGB555 colors each
+	// accessed through BCPS/BCPD (0xFF68/0xFF69) and OCPS/OCPD (0xFF6A/0xFF6B)
+	bgPalette  [64]byte
+	objPalette [64]byte
+
+	// number of cycles the CPU has to stay stopped for, while a CGB VRAM DMA runs
+	stallCycles int
+
+	oamDMA oamDMA
+
+	// mapped over the cartridge rom until 0xFF50 is written, nil if not in use
+	bootRom []byte
+
+	timer  *Timer
+	serial *Serial
+
+	// set by NewPPU, handles writes to the LCD registers affecting the STAT interrupt
+	ppu *PPU
+
 	KeyPressedMap map[string]bool
 	mbc           MBC
 
+	// nil if the cartridge has no real time clock
+	clock cartridgeClock
+	// nil if the cartridge isn't a Game Boy Camera
+	camera *Camera
+
 	logger Logger
 
 	audioRegisterWriteCallback AudioRegisterWriteCallback
@@ -13,11 +46,31 @@ type MMU struct {
 
 type AudioRegisterWriteCallback = func(uint16, byte, byte)
 
-func NewMMU(ram []byte, mbc MBC, logger Logger, audioRegisterWriteCallback AudioRegisterWriteCallback) *MMU {
+func NewMMU(ram []byte, model Model, cgb bool, mbc MBC, logger Logger, audioRegisterWriteCallback AudioRegisterWriteCallback) *MMU {
 	mmu := new(MMU)
 
 	mmu.ram = ram
 	mmu.mbc = mbc
+	mmu.clock = getCartridgeClock(mbc)
+	mmu.camera, _ = mbc.(*Camera)
+	mmu.timer = NewTimer(ram)
+
+	mmu.model = model
+
+	mmu.cgb = cgb
+	if cgb {
+		mmu.vram = [][]byte{ram[0x8000:0xA000], make([]byte, 0x2000)}
+
+		mmu.wram = [][]byte{ram[0xC000:0xD000], ram[0xD000:0xE000]}
+		for i := 2; i < 8; i++ {
+			mmu.wram = append(mmu.wram, make([]byte, 0x1000))
+		}
+
+		// the boot rom initialises all background palettes to white
+		for i := range mmu.bgPalette {
+			mmu.bgPalette[i] = 0xFF
+		}
+	}
 
 	mmu.KeyPressedMap = map[string]bool{
 		"up": false, "down": false, "left": false, "right": false,
@@ -30,92 +83,168 @@ func NewMMU(ram []byte, mbc MBC, logger Logger, audioRegisterWriteCallback Audio
 		mmu.logger = logger
 	}
 
+	// the serial output of test roms is logged unless another peer is connected
+	mmu.serial = NewSerial(ram, cgb, loggerSerialPeer{mmu.logger})
+
 	mmu.audioRegisterWriteCallback = audioRegisterWriteCallback
 
 	return mmu
 }
 
-var audioRegOrLookup = [32]byte{
-	0x80, 0x3F, 0x00, 0xFF, 0xBF, // NR10-NR14
-	0xFF, 0x3F, 0x00, 0xFF, 0xBF, // NR20-NR24
-	0x7F, 0xFF, 0x9F, 0xFF, 0xBF, // NR30-NR34
-	0xFF, 0xFF, 0x00, 0x00, 0xBF, // NR40-NR44
-	0x00, 0x00, 0x70, // NR50-NR52
-	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, // unused regs
-}
-
 func delegateToMBC(address uint16) bool {
 	return address < 0x8000 || 0xA000 <= address && address < 0xC000
 }
 
+const (
+	KEY0 = 0xFF4C // CGB mode select, only writable by the boot rom: bit 2 selects DMG compatibility mode
+	KEY1 = 0xFF4D // CGB speed switch: bit 7 current speed, bit 0 prepare switch
+	VBK  = 0xFF4F // CGB VRAM bank
+	SVBK = 0xFF70 // CGB WRAM bank
+
+	BCPS = 0xFF68 // CGB background palette index, bit 7 enables auto-increment
+	BCPD = 0xFF69 // CGB background palette data
+	OCPS = 0xFF6A // CGB object palette index, bit 7 enables auto-increment
+	OCPD = 0xFF6B // CGB object palette data
+	OPRI = 0xFF6C // CGB object priority mode, bit 0: 0 = OAM position, 1 = X coordinate
+)
+
+const (
+	BOOT = 0xFF50 // writing a non zero value unmaps the boot rom
+
+	DMG_BOOT_ROM_SIZE = 0x100
+	CGB_BOOT_ROM_SIZE = 0x900
+)
+
+// isBootRomMapped checks if the address should be read from the boot rom
+// the CGB boot rom is mapped at 0x0000-0x00FF and 0x0200-0x08FF, the cartridge header is visible in between
+func (m *MMU) isBootRomMapped(address uint16) bool {
+	if m.bootRom == nil {
+		return false
+	}
+	return address < DMG_BOOT_ROM_SIZE ||
+		len(m.bootRom) == CGB_BOOT_ROM_SIZE && 0x200 <= address && address < CGB_BOOT_ROM_SIZE
+}
+
+// enterCompatibilityMode switches to DMG compatibility mode when the CGB boot rom hands over to a DMG cart
+// the boot rom also sets OPRI to prioritise objects by X coordinate, which is what the PPU does outside of CGB mode
+// the colors the boot rom picks for the DMG palettes are not emulated, the screen stays in shades of grey
+func (m *MMU) enterCompatibilityMode() {
+	m.cgb = false
+	m.serial.cgb = false
+	if m.ppu != nil {
+		m.ppu.cgb = false
+	}
+}
+
+func (m *MMU) vramBank() int {
+	return int(m.ram[VBK] & 1)
+}
+
+func (m *MMU) wramBank() int {
+	bank := int(m.ram[SVBK] & 0x7)
+	if bank == 0 {
+		return 1
+	}
+	return bank
+}
+
+func (m *MMU) isDoubleSpeed() bool {
+	return m.cgb && m.ram[KEY1]&0x80 > 0
+}
+
+func (m *MMU) isSpeedSwitchArmed() bool {
+	return m.cgb && m.ram[KEY1]&1 > 0
+}
+
+// switchSpeed is called when STOP is executed with KEY1 bit 0 set
+func (m *MMU) switchSpeed() {
+	m.ram[KEY1] = (m.ram[KEY1] ^ 0x80) & 0x80
+}
+
+// incrementPaletteIndex increments BCPS/OCPS after a data write if auto-increment is enabled
+func (m *MMU) incrementPaletteIndex(address uint16) {
+	spec := m.ram[address]
+	if spec&0x80 > 0 {
+		m.ram[address] = 0x80 | (spec+1)&0x3F
+	}
+}
+
+// readCGBMemory handles the CGB banked memory
+// returns false if the address is not handled
+func (m *MMU) readCGBMemory(address uint16) (byte, bool) {
+	switch {
+	case 0x8000 <= address && address < 0xA000:
+		return m.vram[m.vramBank()][address-0x8000], true
+	case 0xD000 <= address && address < 0xE000:
+		return m.wram[m.wramBank()][address-0xD000], true
+	}
+	return 0, false
+}
+
+// writeCGBMemory handles the CGB banked memory
+// returns false if the address is not handled
+func (m *MMU) writeCGBMemory(address uint16, value byte) bool {
+	switch {
+	case 0x8000 <= address && address < 0xA000:
+		m.vram[m.vramBank()][address-0x8000] = value
+	case 0xD000 <= address && address < 0xE000:
+		m.wram[m.wramBank()][address-0xD000] = value
+	default:
+		return false
+	}
+	return true
+}
+
+// echoAddress maps 0xE000-0xFDFF to the WRAM it mirrors
+func echoAddress(address uint16) uint16 {
+	if 0xE000 <= address && address < 0xFE00 {
+		return address - 0x2000
+	}
+	return address
+}
+
 func (m *MMU) readMemory(address uint16) byte {
+	address = echoAddress(address)
 
-	if delegateToMBC(address) {
+	if m.isBootRomMapped(address) {
+
+		return m.bootRom[address]
+
+	} else if delegateToMBC(address) {
 
 		return m.mbc.ReadMemory(address)
 
-	} else if 0xFEA0 <= address && address < 0xFF00 {
+	} else if m.cgb {
+		if value, ok := m.readCGBMemory(address); ok {
+			return value
+		}
+	}
+
+	if 0xFEA0 <= address && address < 0xFF00 {
 		return 00
-	} else if 0xFF10 <= address && address <= 0xFF2F {
-		// audio regs
-		or := audioRegOrLookup[address-0xFF10]
-		return m.ram[address] | or
+	} else if isIORegister(address) {
+		return m.readIORegister(address)
 	}
 	return m.ram[address]
 }
 
 func (m *MMU) writeMemory(address uint16, value byte) {
+	address = echoAddress(address)
 
 	if delegateToMBC(address) {
 
 		m.mbc.WriteMemory(address, value)
 
+	} else if m.cgb && m.writeCGBMemory(address, value) {
+
+		// handled by CGB specific logic
+
 	} else if 0xFEA0 <= address && address < 0xFF00 {
 		// ignore
-	} else if 0xFF10 <= address && address <= 0xFF2F {
-		oldValue := m.ram[address]
-		// audio
-		if address == 0xFF26 {
-			// NR52 only top bits are writeable
-			m.ram[address] = value & 0xF0
-
-			// check if APU disabled. If yes, then clear all regs
-			if value&0x80 == 0 {
-				for i := 0xFF10; i <= 0xFF2F; i++ {
-					m.ram[i] = 0
-				}
-			}
-
-		} else {
-			// ignore all writes if APU disabled
-			isOn := m.ram[0xFF26]&0x80 > 0
-			if isOn {
-				m.ram[address] = value
-			}
-		}
-		m.audioRegisterWriteCallback(address, oldValue, value)
+	} else if isIORegister(address) {
+		m.writeIORegister(address, value)
 	} else {
-		if address == 0xFF02 && value == 0x81 {
-			m.logger.Log(string(m.ram[0xFF01]))
-		} else if address == 0xFF46 {
-			m.DMA(value)
-			m.ram[0xFF46] = value
-		} else if address == 0xFF00 {
-			m.ram[0xFF00] = 0b1100_0000 | (value & 0b11_0000) | m.readKeyPressed(value)
-		} else if address == 0xFF04 {
-			// when DIV is written
-			// it is reset to 0
-			m.ram[0xFF04] = 0
-		} else {
-			m.ram[address] = value
-		}
-	}
-}
-
-func (m *MMU) DMA(sourceAddress byte) {
-	blockAddress := uint16(sourceAddress) << 8
-	for i := uint16(0); i < 0xA0; i++ {
-		m.ram[0xFE00+i] = m.ram[blockAddress+i]
+		m.ram[address] = value
 	}
 }
 
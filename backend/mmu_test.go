@@ -0,0 +1,425 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// a CGB rom which loops forever at the entry point
+func withCGBTestRom() func(*Emulator) {
+	return func(e *Emulator) {
+		rom := make([]byte, 1<<15)
+		rom[0x100] = 0x18 // JR -2
+		rom[0x101] = 0xFE
+		rom[0x143] = 0x80
+		e.mbc = NewMBC0(rom, ParseCartridgeHeader(rom))
+	}
+}
+
+func NewTestCGBCPU() *CPU {
+	return NewEmulator(withCGBTestRom(), WithDisableApu()).cpu
+}
+
+func TestCGBPostBootRegisters(t *testing.T) {
+	c := NewTestCGBCPU()
+
+	assert.Equal(t, uint16(0x1180), c.ReadAF())
+	assert.Equal(t, uint16(0x0000), c.ReadBC())
+	assert.Equal(t, uint16(0xFF56), c.ReadDE())
+	assert.Equal(t, uint16(0x000D), c.ReadHL())
+
+	c = NewTestCPU()
+	assert.Equal(t, uint16(0x0013), c.ReadBC())
+}
+
+func TestCGBVramBanking(t *testing.T) {
+	c := NewTestCGBCPU()
+
+	c.writeMemory(0x8000, 0x12)
+	c.writeMemory(VBK, 1)
+	assert.Equal(t, byte(0xFF), c.readMemory(VBK))
+	assert.Equal(t, byte(0), c.readMemory(0x8000))
+
+	c.writeMemory(0x8000, 0x34)
+	c.writeMemory(VBK, 0)
+	assert.Equal(t, byte(0xFE), c.readMemory(VBK))
+	assert.Equal(t, byte(0x12), c.readMemory(0x8000))
+
+	// bank 0 is what the PPU sees in ram
+	assert.Equal(t, byte(0x12), c.mmu.ram[0x8000])
+	assert.Equal(t, byte(0x34), c.mmu.vram[1][0])
+}
+
+func TestCGBWramBanking(t *testing.T) {
+	c := NewTestCGBCPU()
+
+	for bank := byte(1); bank < 8; bank++ {
+		c.writeMemory(SVBK, bank)
+		c.writeMemory(0xD000, bank)
+	}
+
+	// bank 0 selects bank 1
+	c.writeMemory(SVBK, 0)
+	assert.Equal(t, byte(1), c.readMemory(0xD000))
+
+	for bank := byte(1); bank < 8; bank++ {
+		c.writeMemory(SVBK, bank)
+		assert.Equal(t, 0xF8|bank, c.readMemory(SVBK))
+		assert.Equal(t, bank, c.readMemory(0xD000))
+	}
+
+	// bank 0 at 0xC000 is not switchable
+	c.writeMemory(0xC000, 0xAB)
+	c.writeMemory(SVBK, 2)
+	assert.Equal(t, byte(0xAB), c.readMemory(0xC000))
+}
+
+func TestCGBSpeedSwitch(t *testing.T) {
+	c := NewTestCGBCPU()
+
+	assert.Equal(t, byte(0x7E), c.readMemory(KEY1))
+
+	// STOP without preparing the switch does nothing
+	c.stop()
+	assert.False(t, c.mmu.isDoubleSpeed())
+
+	c.writeMemory(KEY1, 1)
+	assert.Equal(t, byte(0x7F), c.readMemory(KEY1))
+
+	c.stop()
+	assert.True(t, c.mmu.isDoubleSpeed())
+	assert.Equal(t, byte(0xFE), c.readMemory(KEY1))
+
+	c.writeMemory(KEY1, 1)
+	c.stop()
+	assert.False(t, c.mmu.isDoubleSpeed())
+	assert.Equal(t, byte(0x7E), c.readMemory(KEY1))
+}
+
+func ppuPosition(p *PPU) int {
+	return int(p.line)*DOTS_PER_LINE + p.dot
+}
+
+func TestDoubleSpeedRunsTwiceAsManyCycles(t *testing.T) {
+	c := NewTestCGBCPU()
+
+	// NOPs
+	c.PC = 0xC000
+	stepPPUTo(c.ppu, 0, 0)
+	start := ppuPosition(c.ppu)
+	for i := 0; i < 100; i++ {
+		c.Step()
+	}
+	assert.Equal(t, 400, ppuPosition(c.ppu)-start)
+
+	c.writeMemory(KEY1, 1)
+	c.stop()
+
+	// the PPU only advances by half as many dots
+	c.PC = 0xC000
+	start = ppuPosition(c.ppu)
+	for i := 0; i < 100; i++ {
+		c.Step()
+	}
+	assert.Equal(t, 200, ppuPosition(c.ppu)-start)
+}
+
+func TestDMGIgnoresCGBRegisters(t *testing.T) {
+	c := NewTestCPU()
+
+	c.writeMemory(0x8000, 0x12)
+	c.writeMemory(VBK, 1)
+	assert.Equal(t, byte(0x12), c.readMemory(0x8000))
+
+	c.writeMemory(KEY1, 1)
+	c.stop()
+	assert.False(t, c.mmu.isDoubleSpeed())
+
+	// unmapped in DMG mode
+	assert.Equal(t, byte(0xFF), c.readMemory(VBK))
+	assert.Equal(t, byte(0xFF), c.readMemory(SVBK))
+	assert.Equal(t, byte(0xFF), c.readMemory(HDMA5))
+}
+
+func TestEchoRAM(t *testing.T) {
+	c := NewTestCPU()
+
+	c.writeMemory(0xC123, 0x12)
+	assert.Equal(t, byte(0x12), c.readMemory(0xE123))
+
+	c.writeMemory(0xFDFF, 0x34)
+	assert.Equal(t, byte(0x34), c.readMemory(0xDDFF))
+
+	// the echo follows the WRAM bank on CGB
+	c = NewTestCGBCPU()
+	c.writeMemory(SVBK, 3)
+	c.writeMemory(0xF000, 0x56)
+	assert.Equal(t, byte(0x56), c.readMemory(0xD000))
+	c.writeMemory(SVBK, 4)
+	assert.NotEqual(t, byte(0x56), c.readMemory(0xF000))
+}
+
+func TestIORegisterMasks(t *testing.T) {
+	c := NewTestCPU()
+
+	// the unused bits read as 1, unmapped registers read 0xFF
+	for _, register := range []struct {
+		address  uint16
+		expected byte
+	}{
+		{0xFF03, 0xFF}, // unmapped
+		{0xFF0F, 0xE0}, // IF
+		{TAC, 0xF8},
+		{0xFF10, 0x80}, // NR10
+		{0xFF15, 0xFF}, // unused audio register
+		{0xFF30, 0x00}, // wave RAM
+		{0xFF4C, 0xFF}, // unmapped
+		{BOOT, 0xFF},
+		{VBK, 0xFF},    // CGB only
+		{0xFF7F, 0xFF}, // unmapped
+		{0xFF80, 0x00}, // HRAM
+		{0xFFFF, 0x00}, // IE
+	} {
+		c.writeMemory(register.address, 0)
+		assert.Equal(t, register.expected, c.readMemory(register.address), "%#04x", register.address)
+	}
+
+	// read only bits
+	c.writeMemory(STAT, 0)
+	assert.Equal(t, byte(0x80), c.readMemory(STAT)&0xF8)
+
+	line := c.readMemory(LY)
+	c.writeMemory(LY, line+1)
+	assert.Equal(t, line, c.readMemory(LY))
+
+	c = NewTestCGBCPU()
+	c.writeMemory(VBK, 0xFF)
+	assert.Equal(t, byte(0xFF), c.readMemory(VBK))
+	c.writeMemory(VBK, 0)
+	assert.Equal(t, byte(0xFE), c.readMemory(VBK))
+	c.writeMemory(0xFF4C, 0)
+	assert.Equal(t, byte(0xFF), c.readMemory(0xFF4C))
+}
+
+func TestIORegisterUnusedBits(t *testing.T) {
+	dmg := NewTestCPU()
+	cgb := NewTestCGBCPU()
+
+	// value read after writing 0, the unused bits read as 1: the masks checked by mooneye's unused_hwio
+	// registers whose reads depend on the rest of the system (P1, DIV, STAT, LY, DMA, HDMA5, NR52) aren't listed
+	for _, register := range []struct {
+		name     string
+		address  uint16
+		dmg, cgb byte
+	}{
+		{"SB", 0xFF01, 0x00, 0x00},
+		{"SC", 0xFF02, 0x7E, 0x7C},
+		{"unmapped", 0xFF03, 0xFF, 0xFF},
+		{"TIMA", 0xFF05, 0x00, 0x00},
+		{"TMA", 0xFF06, 0x00, 0x00},
+		{"TAC", 0xFF07, 0xF8, 0xF8},
+		{"unmapped", 0xFF08, 0xFF, 0xFF},
+		{"unmapped", 0xFF0E, 0xFF, 0xFF},
+		{"IF", 0xFF0F, 0xE0, 0xE0},
+		{"NR10", 0xFF10, 0x80, 0x80},
+		{"NR11", 0xFF11, 0x3F, 0x3F},
+		{"NR12", 0xFF12, 0x00, 0x00},
+		{"NR13", 0xFF13, 0xFF, 0xFF},
+		{"NR14", 0xFF14, 0xBF, 0xBF},
+		{"unused audio", 0xFF15, 0xFF, 0xFF},
+		{"NR21", 0xFF16, 0x3F, 0x3F},
+		{"NR22", 0xFF17, 0x00, 0x00},
+		{"NR23", 0xFF18, 0xFF, 0xFF},
+		{"NR24", 0xFF19, 0xBF, 0xBF},
+		{"NR30", 0xFF1A, 0x7F, 0x7F},
+		{"NR31", 0xFF1B, 0xFF, 0xFF},
+		{"NR32", 0xFF1C, 0x9F, 0x9F},
+		{"NR33", 0xFF1D, 0xFF, 0xFF},
+		{"NR34", 0xFF1E, 0xBF, 0xBF},
+		{"unused audio", 0xFF1F, 0xFF, 0xFF},
+		{"NR41", 0xFF20, 0xFF, 0xFF},
+		{"NR42", 0xFF21, 0x00, 0x00},
+		{"NR43", 0xFF22, 0x00, 0x00},
+		{"NR44", 0xFF23, 0xBF, 0xBF},
+		{"NR50", 0xFF24, 0x00, 0x00},
+		{"NR51", 0xFF25, 0x00, 0x00},
+		{"unused audio", 0xFF27, 0xFF, 0xFF},
+		{"unused audio", 0xFF2F, 0xFF, 0xFF},
+		{"wave RAM", 0xFF30, 0x00, 0x00},
+		{"SCY", 0xFF42, 0x00, 0x00},
+		{"SCX", 0xFF43, 0x00, 0x00},
+		{"LYC", 0xFF45, 0x00, 0x00},
+		{"BGP", 0xFF47, 0x00, 0x00},
+		{"OBP0", 0xFF48, 0x00, 0x00},
+		{"OBP1", 0xFF49, 0x00, 0x00},
+		{"WY", 0xFF4A, 0x00, 0x00},
+		{"WX", 0xFF4B, 0x00, 0x00},
+		{"unmapped", 0xFF4C, 0xFF, 0xFF},
+		{"KEY1", KEY1, 0xFF, 0x7E},
+		{"unmapped", 0xFF4E, 0xFF, 0xFF},
+		{"VBK", VBK, 0xFF, 0xFE},
+		{"BOOT", BOOT, 0xFF, 0xFF},
+		{"HDMA1", 0xFF51, 0xFF, 0xFF},
+		{"HDMA4", 0xFF54, 0xFF, 0xFF},
+		{"RP", 0xFF56, 0xFF, 0x3E},
+		{"unmapped", 0xFF57, 0xFF, 0xFF},
+		{"unmapped", 0xFF67, 0xFF, 0xFF},
+		{"BCPS", BCPS, 0xFF, 0x40},
+		{"OCPS", OCPS, 0xFF, 0x40},
+		{"OPRI", 0xFF6C, 0xFF, 0xFE},
+		{"unmapped", 0xFF6D, 0xFF, 0xFF},
+		{"SVBK", SVBK, 0xFF, 0xF8},
+		{"unmapped", 0xFF71, 0xFF, 0xFF},
+		{"FF72", 0xFF72, 0xFF, 0x00},
+		{"FF73", 0xFF73, 0xFF, 0x00},
+		{"FF74", 0xFF74, 0xFF, 0x00},
+		{"FF75", 0xFF75, 0xFF, 0x8F},
+		{"PCM12", 0xFF76, 0xFF, 0x00},
+		{"PCM34", 0xFF77, 0xFF, 0x00},
+		{"unmapped", 0xFF78, 0xFF, 0xFF},
+		{"unmapped", 0xFF7F, 0xFF, 0xFF},
+	} {
+		for _, c := range []struct {
+			cpu      *CPU
+			expected byte
+		}{{dmg, register.dmg}, {cgb, register.cgb}} {
+			c.cpu.mmu.writeMemory(register.address, 0)
+			assert.Equal(t, c.expected, c.cpu.mmu.readMemory(register.address), "%s %#04x, CGB: %v", register.name, register.address, c.cpu.mmu.cgb)
+		}
+	}
+}
+
+// writeTestBootRom writes a boot rom running the given code before unmapping itself
+func writeTestBootRom(t *testing.T, size int, code ...byte) string {
+	code = append([]byte{
+		0x31, 0xFE, 0xFF, // LD SP, 0xFFFE
+		0x3E, 0x42, // LD A, 0x42
+		0xE0, 0x80, // LDH (0x80), A
+	}, code...)
+	code = append(code,
+		0x3E, 0x01, // LD A, 0x01
+		0xE0, 0x50, // LDH (0x50), A -> unmap the boot rom, then run into the cartridge at 0x100
+	)
+
+	bootRom := make([]byte, size)
+	copy(bootRom, code)
+	if size == CGB_BOOT_ROM_SIZE {
+		bootRom[0x200] = 0xAB
+	}
+
+	path := filepath.Join(t.TempDir(), "boot.bin")
+	if err := os.WriteFile(path, bootRom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBootRom(t *testing.T) {
+	emulator := NewEmulator(withCGBTestRom(), WithBootRom(writeTestBootRom(t, DMG_BOOT_ROM_SIZE)), WithDisableApu())
+	c := emulator.cpu
+
+	// starts from a zeroed state
+	assert.Equal(t, uint16(0), c.PC)
+	assert.Equal(t, uint16(0), c.ReadAF())
+	assert.Equal(t, byte(0), c.readMemory(LCDC))
+
+	// boot rom is mapped over the cartridge, except for the header
+	assert.Equal(t, byte(0x31), c.readMemory(0x0000))
+	assert.Equal(t, byte(0x18), c.readMemory(0x0100))
+
+	emulator.RunForAFrame()
+
+	assert.Equal(t, uint16(0x100), c.PC)
+	assert.Equal(t, byte(0x42), c.readMemory(0xFF80))
+	assert.Equal(t, byte(0), c.readMemory(0x0000))
+
+	assert.Equal(t, byte(0xFF), c.readMemory(BOOT))
+
+	// the boot rom can't be mapped back
+	c.writeMemory(BOOT, 0)
+	assert.Equal(t, byte(0), c.readMemory(0x0000))
+}
+
+func TestCGBBootRom(t *testing.T) {
+	emulator := NewEmulator(withCGBTestRom(), WithBootRom(writeTestBootRom(t, CGB_BOOT_ROM_SIZE)), WithDisableApu())
+	c := emulator.cpu
+
+	assert.Equal(t, byte(0xAB), c.readMemory(0x0200))
+	assert.Equal(t, byte(0x80), c.readMemory(0x0143))
+
+	emulator.RunForAFrame()
+
+	assert.Equal(t, uint16(0x100), c.PC)
+	assert.Equal(t, byte(0), c.readMemory(0x0200))
+}
+
+func TestCGBBootRomKeepsCGBMode(t *testing.T) {
+	bootRom := writeTestBootRom(t, CGB_BOOT_ROM_SIZE,
+		0x3E, 0x80, // LD A, 0x80 -> the CGB flag of the cartridge
+		0xE0, 0x4C, // LDH (KEY0), A
+	)
+	emulator := NewEmulator(withCGBTestRom(), WithBootRom(bootRom), WithDisableApu())
+	emulator.RunForAFrame()
+
+	assert.Equal(t, uint16(0x100), emulator.cpu.PC)
+	assert.True(t, emulator.mmu.cgb)
+	assert.True(t, emulator.ppu.cgb)
+}
+
+func TestCGBBootRomCompatibilityMode(t *testing.T) {
+	bootRom := writeTestBootRom(t, CGB_BOOT_ROM_SIZE,
+		0x3E, 0x04, // LD A, 0x04
+		0xE0, 0x4C, // LDH (KEY0), A -> DMG compatibility mode
+		0x3E, 0x01, // LD A, 0x01
+		0xE0, 0x6C, // LDH (OPRI), A -> objects prioritised by X coordinate
+	)
+	rom := make([]byte, 1<<15)
+	rom[0x100] = 0x18 // JR -2
+	rom[0x101] = 0xFE
+	emulator := NewEmulator(withMBC(NewMBC0(rom, ParseCartridgeHeader(rom))), WithBootRom(bootRom), WithDisableApu())
+	c := emulator.cpu
+
+	// the boot rom runs in CGB mode, whatever the cartridge
+	assert.Equal(t, ModelCGB, emulator.GetModel())
+	assert.True(t, emulator.mmu.cgb)
+	assert.Equal(t, byte(0xFE), c.readMemory(VBK))
+
+	emulator.RunForAFrame()
+
+	assert.Equal(t, uint16(0x100), c.PC)
+	assert.False(t, emulator.mmu.cgb)
+	assert.False(t, emulator.ppu.cgb)
+	assert.False(t, emulator.mmu.serial.cgb)
+	assert.Equal(t, byte(0xFF), c.readMemory(VBK))
+	assert.Equal(t, byte(0xFF), c.readMemory(OPRI))
+}
+
+func TestKEY0LockedAfterBootRom(t *testing.T) {
+	emulator := NewEmulator(withCGBTestRom(), WithBootRom(writeTestBootRom(t, CGB_BOOT_ROM_SIZE)), WithDisableApu())
+	c := emulator.cpu
+
+	c.writeMemory(KEY0, 0x04)
+	assert.Equal(t, byte(0x04), emulator.mmu.ram[KEY0])
+
+	// the boot rom overwrites it with the CGB flag before handing over on hardware
+	c.writeMemory(KEY0, 0)
+	emulator.RunForAFrame()
+
+	c.writeMemory(KEY0, 0x04)
+	assert.Equal(t, byte(0), emulator.mmu.ram[KEY0])
+	assert.Equal(t, byte(0xFF), c.readMemory(KEY0))
+	assert.True(t, emulator.mmu.cgb)
+}
+
+func TestInvalidBootRom(t *testing.T) {
+	assert.Panics(t, func() {
+		NewEmulator(WithNoRom(), WithBootRom(writeTestBootRom(t, 0x200)))
+	})
+	// the CGB boot rom can only run on a CGB
+	assert.Panics(t, func() {
+		NewEmulator(WithNoRom(), WithModel(ModelDMG), WithBootRom(writeTestBootRom(t, CGB_BOOT_ROM_SIZE)))
+	})
+}
@@ -0,0 +1,123 @@
+package backend
+
+import "fmt"
+
+// Model represents the Game Boy hardware revision being emulated
+type Model int
+
+const (
+	ModelAuto Model = iota // DMG for DMG carts, CGB for carts with CGB support
+	ModelDMG0              // early DMG revision
+	ModelDMG
+	ModelMGB  // Game Boy Pocket
+	ModelSGB  // Super Game Boy
+	ModelSGB2 // Super Game Boy 2
+	ModelCGB  // Game Boy Color, runs DMG carts in DMG compatibility mode
+)
+
+var modelNames = map[Model]string{
+	ModelAuto: "auto",
+	ModelDMG0: "dmg0",
+	ModelDMG:  "dmg",
+	ModelMGB:  "mgb",
+	ModelSGB:  "sgb",
+	ModelSGB2: "sgb2",
+	ModelCGB:  "cgb",
+}
+
+func (m Model) String() string {
+	if name, ok := modelNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("Model(%d)", int(m))
+}
+
+// ParseModel converts a model name (as returned by Model.String) to a Model
+func ParseModel(name string) (Model, error) {
+	for model, modelName := range modelNames {
+		if modelName == name {
+			return model, nil
+		}
+	}
+	return ModelAuto, fmt.Errorf("unknown model: %s", name)
+}
+
+// isDMGFamily returns true for models based on the original DMG hardware
+// these have quirks that were fixed on CGB (e.g. the OAM corruption bug)
+func (m Model) isDMGFamily() bool {
+	return m != ModelCGB
+}
+
+// resolveModel picks the model and whether CGB mode is enabled for the given cartridge and boot rom
+// the CGB boot rom always starts in CGB mode, it selects the mode of the cartridge through KEY0
+func resolveModel(model Model, mbc MBC, bootRom []byte) (Model, bool) {
+	cgbCartridge := isCGBCartridge(mbc)
+	cgbBootRom := len(bootRom) == CGB_BOOT_ROM_SIZE
+	if model == ModelAuto {
+		if cgbCartridge || cgbBootRom {
+			model = ModelCGB
+		} else {
+			model = ModelDMG
+		}
+	}
+	if cgbBootRom && model != ModelCGB {
+		panic(fmt.Sprintf("Can't run a CGB boot rom on %s", model))
+	}
+	return model, model == ModelCGB && (cgbCartridge || cgbBootRom)
+}
+
+// powerUpState is the state the boot rom leaves the hardware in
+// register values are from the pandocs power up sequence
+// Div is the internal 16 bit divider (DIV is its upper byte), only the DMG0 and DMG/MGB upper bytes are documented,
+// the other values are approximations
+// the boot rom hands over during VBlank, the PPU position gives LY and STAT: only documented for DMG0 and DMG/MGB
+type powerUpState struct {
+	AF, BC, DE, HL uint16
+	Div            uint16
+	SC             byte // serial control
+	DMA            byte // last OAM DMA source
+	NR52           byte // channel 1 is still on after the boot sound, except on SGB
+	Line           byte
+	Dot            int
+}
+
+// audio registers left by the boot sound, the same on every model
+// written directly to ram: channel 1 has faded out, it must not be triggered again
+var powerUpAudioRegisters = map[uint16]byte{
+	NR11: 0x80,
+	NR12: 0xF3,
+	NR14: 0x80,
+	NR50: 0x77,
+	NR51: 0xF3,
+}
+
+func getPowerUpState(model Model, cgbMode bool, headerChecksum byte) powerUpState {
+
+	// the DMG boot rom leaves H and C set unless the header checksum is 0
+	dmgFlags := uint16(0xB0)
+	if headerChecksum == 0 {
+		dmgFlags = 0x80
+	}
+
+	switch model {
+	case ModelDMG0:
+		// LY=0x91, STAT=0x81
+		return powerUpState{AF: 0x0100, BC: 0xFF13, DE: 0x00C1, HL: 0x8403, Div: 0x182C, SC: 0x7E, DMA: 0xFF, NR52: 0xF1, Line: 145, Dot: 100}
+	case ModelDMG:
+		// LY=0x00 (line 153), STAT=0x85
+		return powerUpState{AF: 0x0100 | dmgFlags, BC: 0x0013, DE: 0x00D8, HL: 0x014D, Div: 0xABCC, SC: 0x7E, DMA: 0xFF, NR52: 0xF1, Line: 153, Dot: 100}
+	case ModelMGB:
+		return powerUpState{AF: 0xFF00 | dmgFlags, BC: 0x0013, DE: 0x00D8, HL: 0x014D, Div: 0xABCC, SC: 0x7E, DMA: 0xFF, NR52: 0xF1, Line: 153, Dot: 100}
+	case ModelSGB:
+		return powerUpState{AF: 0x0100, BC: 0x0014, DE: 0x0000, HL: 0xC060, Div: 0xD85C, SC: 0x7E, DMA: 0xFF, NR52: 0xF0, Line: 153, Dot: 100}
+	case ModelSGB2:
+		return powerUpState{AF: 0xFF00, BC: 0x0014, DE: 0x0000, HL: 0xC060, Div: 0xD85C, SC: 0x7E, DMA: 0xFF, NR52: 0xF0, Line: 153, Dot: 100}
+	case ModelCGB:
+		if cgbMode {
+			return powerUpState{AF: 0x1180, BC: 0x0000, DE: 0xFF56, HL: 0x000D, Div: 0x1EA0, SC: 0x7F, DMA: 0x00, NR52: 0xF1, Line: 153, Dot: 100}
+		}
+		return powerUpState{AF: 0x1180, BC: 0x0000, DE: 0x0008, HL: 0x007C, Div: 0x267C, SC: 0x7F, DMA: 0x00, NR52: 0xF1, Line: 153, Dot: 100}
+	default:
+		panic(fmt.Sprintf("Got unexpected model %s", model))
+	}
+}
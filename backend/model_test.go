@@ -0,0 +1,102 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPowerUpRegistersPerModel(t *testing.T) {
+	expected := map[Model][4]uint16{
+		ModelDMG0: {0x0100, 0xFF13, 0x00C1, 0x8403},
+		ModelDMG:  {0x0180, 0x0013, 0x00D8, 0x014D},
+		ModelMGB:  {0xFF80, 0x0013, 0x00D8, 0x014D},
+		ModelSGB:  {0x0100, 0x0014, 0x0000, 0xC060},
+		ModelSGB2: {0xFF00, 0x0014, 0x0000, 0xC060},
+		ModelCGB:  {0x1180, 0x0000, 0x0008, 0x007C},
+	}
+
+	for model, registers := range expected {
+		emulator := NewEmulator(WithNoRom(), WithModel(model), WithDisableApu())
+		c := emulator.cpu
+
+		assert.Equal(t, model, emulator.GetModel())
+		assert.Equal(t, registers, [4]uint16{c.ReadAF(), c.ReadBC(), c.ReadDE(), c.ReadHL()}, model.String())
+		assert.False(t, c.mmu.cgb, model.String())
+	}
+}
+
+func TestDMGFlagsDependOnHeaderChecksum(t *testing.T) {
+	rom := make([]byte, 1<<15)
+	rom[0x14D] = 0x12
+
+	emulator := NewEmulator(withMBC(NewMBC(rom)), WithModel(ModelDMG), WithDisableApu())
+	assert.Equal(t, uint16(0x01B0), emulator.cpu.ReadAF())
+}
+
+func TestPowerUpIORegisters(t *testing.T) {
+	// the registers which differ between models, from the pandocs power up sequence
+	registers := []uint16{0xFF02, 0xFF04, STAT, LY, DMA, NR52, KEY1, VBK, 0xFF56, SVBK}
+	for _, model := range []struct {
+		name     string
+		options  []func(*Emulator)
+		expected []byte
+	}{
+		{"dmg0", []func(*Emulator){WithModel(ModelDMG0), WithNoRom()}, []byte{0x7E, 0x18, 0x81, 0x91, 0xFF, 0xF1, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{"dmg", []func(*Emulator){WithModel(ModelDMG), WithNoRom()}, []byte{0x7E, 0xAB, 0x85, 0x00, 0xFF, 0xF1, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{"mgb", []func(*Emulator){WithModel(ModelMGB), WithNoRom()}, []byte{0x7E, 0xAB, 0x85, 0x00, 0xFF, 0xF1, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{"sgb", []func(*Emulator){WithModel(ModelSGB), WithNoRom()}, []byte{0x7E, 0xD8, 0x85, 0x00, 0xFF, 0xF0, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{"sgb2", []func(*Emulator){WithModel(ModelSGB2), WithNoRom()}, []byte{0x7E, 0xD8, 0x85, 0x00, 0xFF, 0xF0, 0xFF, 0xFF, 0xFF, 0xFF}},
+		// the CGB registers are unmapped in DMG compatibility mode
+		{"cgb, DMG cart", []func(*Emulator){WithModel(ModelCGB), WithNoRom()}, []byte{0x7F, 0x26, 0x85, 0x00, 0x00, 0xF1, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{"cgb, CGB cart", []func(*Emulator){withCGBTestRom()}, []byte{0x7F, 0x1E, 0x85, 0x00, 0x00, 0xF1, 0x7E, 0xFE, 0x3E, 0xF8}},
+	} {
+		m := NewEmulator(append(model.options, WithDisableApu())...).mmu
+
+		for i, address := range registers {
+			assert.Equal(t, model.expected[i], m.readMemory(address), "%s %#04x", model.name, address)
+		}
+
+		// the same on every model
+		for address, expected := range map[uint16]byte{
+			0xFF00: 0xCF, // P1
+			0xFF0F: 0xE1, // IF
+			NR11:   0xBF,
+			NR12:   0xF3,
+			NR14:   0xBF,
+			NR50:   0x77,
+			NR51:   0xF3,
+			LCDC:   0x91,
+			0xFF47: 0xFC, // BGP
+		} {
+			assert.Equal(t, expected, m.readMemory(address), "%s %#04x", model.name, address)
+		}
+	}
+}
+
+func TestAutoModel(t *testing.T) {
+	emulator := NewEmulator(WithNoRom(), WithDisableApu())
+	assert.Equal(t, ModelDMG, emulator.GetModel())
+	assert.False(t, emulator.mmu.cgb)
+
+	emulator = NewEmulator(withCGBTestRom(), WithDisableApu())
+	assert.Equal(t, ModelCGB, emulator.GetModel())
+	assert.True(t, emulator.mmu.cgb)
+
+	// CGB carts can be forced to run on a DMG
+	emulator = NewEmulator(withCGBTestRom(), WithModel(ModelDMG), WithDisableApu())
+	assert.Equal(t, ModelDMG, emulator.GetModel())
+	assert.False(t, emulator.mmu.cgb)
+	assert.Equal(t, uint16(0x0013), emulator.cpu.ReadBC())
+}
+
+func TestParseModel(t *testing.T) {
+	for _, model := range []Model{ModelAuto, ModelDMG0, ModelDMG, ModelMGB, ModelSGB, ModelSGB2, ModelCGB} {
+		parsed, err := ParseModel(model.String())
+		assert.NoError(t, err)
+		assert.Equal(t, model, parsed)
+	}
+
+	_, err := ParseModel("gba")
+	assert.Error(t, err)
+}
@@ -0,0 +1,104 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// the mooneye test roms are not checked in, tests are skipped if they are missing
+const mooneyeRomPath = "../rom/mooneye"
+
+// mooneye tests report success by loading the fibonacci sequence into the registers
+// and failure by loading 0x42 into all of them
+func mooneyeTestFinished(c *CPU) bool {
+	return c.ReadBC() == 0x0305 && c.ReadDE() == 0x080D && c.ReadHL() == 0x1522 ||
+		c.ReadBC() == 0x4242 && c.ReadDE() == 0x4242 && c.ReadHL() == 0x4242
+}
+
+func runMooneyeTest(t *testing.T, rom string, options ...func(*Emulator)) {
+	path := filepath.Join(mooneyeRomPath, rom)
+	if _, err := os.Stat(path); err != nil {
+		t.Skipf("%s not available", path)
+	}
+
+	options = append([]func(*Emulator){WithRom(path), WithDisableApu()}, options...)
+	emulator := NewEmulator(options...)
+	c := emulator.cpu
+
+	for frame := 0; frame < 600 && !mooneyeTestFinished(c); frame++ {
+		emulator.RunForAFrame()
+	}
+
+	assert.Equal(t, uint16(0x0305), c.ReadBC(), rom)
+	assert.Equal(t, uint16(0x080D), c.ReadDE(), rom)
+	assert.Equal(t, uint16(0x1522), c.ReadHL(), rom)
+}
+
+func runMooneyeTests(t *testing.T, roms []string, options ...func(*Emulator)) {
+	for _, rom := range roms {
+		t.Run(rom, func(t *testing.T) {
+			runMooneyeTest(t, rom, options...)
+		})
+	}
+}
+
+func TestMooneyeTimer(t *testing.T) {
+	runMooneyeTests(t, []string{
+		"acceptance/timer/div_write.gb",
+		"acceptance/timer/rapid_toggle.gb",
+		"acceptance/timer/tim00.gb",
+		"acceptance/timer/tim00_div_trigger.gb",
+		"acceptance/timer/tim01.gb",
+		"acceptance/timer/tim01_div_trigger.gb",
+		"acceptance/timer/tim10.gb",
+		"acceptance/timer/tim10_div_trigger.gb",
+		"acceptance/timer/tim11.gb",
+		"acceptance/timer/tim11_div_trigger.gb",
+		"acceptance/timer/tima_reload.gb",
+		"acceptance/timer/tima_write_reloading.gb",
+		"acceptance/timer/tma_write_reloading.gb",
+	})
+}
+
+func TestMooneyeOAMDMA(t *testing.T) {
+	runMooneyeTests(t, []string{
+		"acceptance/oam_dma/basic.gb",
+		"acceptance/oam_dma/reg_read.gb",
+		"acceptance/oam_dma_restart.gb",
+		"acceptance/oam_dma_start.gb",
+		"acceptance/oam_dma_timing.gb",
+	})
+
+	runMooneyeTests(t, []string{"acceptance/oam_dma/sources-GS.gb"}, WithModel(ModelDMG))
+}
+
+func TestMooneyePPU(t *testing.T) {
+	runMooneyeTests(t, []string{
+		"acceptance/ppu/intr_2_0_timing.gb",
+		"acceptance/ppu/intr_2_mode0_timing.gb",
+		"acceptance/ppu/intr_2_mode3_timing.gb",
+		"acceptance/ppu/intr_2_oam_ok_timing.gb",
+		"acceptance/ppu/stat_irq_blocking.gb",
+		"acceptance/ppu/stat_lyc_onoff.gb",
+	})
+
+	runMooneyeTests(t, []string{
+		"acceptance/ppu/hblank_ly_scx_timing-GS.gb",
+		"acceptance/ppu/intr_1_2_timing-GS.gb",
+		"acceptance/ppu/lcdon_timing-GS.gb",
+		"acceptance/ppu/lcdon_write_timing-GS.gb",
+		"acceptance/ppu/vblank_stat_intr-GS.gb",
+	}, WithModel(ModelDMG))
+}
+
+func TestMooneyeBits(t *testing.T) {
+	runMooneyeTests(t, []string{
+		"acceptance/bits/mem_oam.gb",
+		"acceptance/bits/reg_f.gb",
+	})
+
+	runMooneyeTests(t, []string{"acceptance/bits/unused_hwio-GS.gb"}, WithModel(ModelDMG))
+}
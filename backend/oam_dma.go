@@ -0,0 +1,114 @@
+package backend
+
+// OAM DMA
+// writing to DMA copies 160 bytes from (value << 8) to OAM, one byte per M-cycle,
+// starting one M-cycle after the write
+// while the transfer runs, OAM is hidden from the CPU and the PPU,
+// and the CPU sees the byte being transferred when accessing the bus used by the transfer
+const (
+	DMA = 0xFF46
+
+	oamDMALength = 0xA0
+)
+
+type oamDMA struct {
+	delay         int    // M-cycles until a requested transfer starts
+	pendingSource uint16 // source of the requested transfer
+
+	active bool
+	source uint16
+	index  uint16
+
+	blocking bool // a byte is being transferred in the current M-cycle
+	value    byte // last byte transferred
+}
+
+func (m *MMU) writeDMA(value byte) {
+	m.ram[DMA] = value
+
+	source := uint16(value) << 8
+	if source >= 0xE000 {
+		// 0xE000 and above is read from the echo of WRAM
+		source -= 0x2000
+	}
+
+	// a transfer already in progress continues until the new one starts
+	m.oamDMA.delay = 1
+	m.oamDMA.pendingSource = source
+}
+
+// stepOAMDMA advances the OAM DMA by one M-cycle
+func (m *MMU) stepOAMDMA() {
+	dma := &m.oamDMA
+
+	starting := false
+	if dma.delay > 0 {
+		dma.delay--
+		starting = dma.delay == 0
+	}
+
+	dma.blocking = dma.active
+	if dma.active {
+		dma.value = m.readMemory(dma.source + dma.index)
+		m.ram[0xFE00+dma.index] = dma.value
+
+		dma.index++
+		if dma.index == oamDMALength {
+			dma.active = false
+		}
+	}
+
+	if starting {
+		dma.active = true
+		dma.source = dma.pendingSource
+		dma.index = 0
+	}
+}
+
+func isVRAMBus(address uint16) bool {
+	return 0x8000 <= address && address < 0xA000
+}
+
+// isExternalBus is true for addresses on the bus shared by the cartridge and WRAM
+func isExternalBus(address uint16) bool {
+	return address < 0x8000 || 0xA000 <= address && address < 0xFE00
+}
+
+// conflictsWithOAMDMA returns true if the CPU can't access the given address because of the current transfer
+func (m *MMU) conflictsWithOAMDMA(address uint16) bool {
+	if !m.oamDMA.blocking {
+		return false
+	}
+
+	if 0xFE00 <= address && address < 0xFF00 {
+		return true
+	}
+
+	source := m.oamDMA.source
+	return isVRAMBus(source) && isVRAMBus(address) || isExternalBus(source) && isExternalBus(address)
+}
+
+// cpuReadMemory is a read by the CPU, which can conflict with OAM DMA or be blocked by the PPU
+func (m *MMU) cpuReadMemory(address uint16) byte {
+	if m.conflictsWithOAMDMA(address) {
+		if 0xFE00 <= address && address < 0xFF00 {
+			return 0xFF
+		}
+		return m.oamDMA.value
+	}
+	if m.ppu != nil && !m.ppu.cpuCanAccess(address) {
+		return 0xFF
+	}
+	return m.readMemory(address)
+}
+
+// cpuWriteMemory is a write by the CPU, which is ignored if it conflicts with OAM DMA or is blocked by the PPU
+func (m *MMU) cpuWriteMemory(address uint16, value byte) {
+	if m.conflictsWithOAMDMA(address) {
+		return
+	}
+	if m.ppu != nil && !m.ppu.cpuCanAccess(address) {
+		return
+	}
+	m.writeMemory(address, value)
+}
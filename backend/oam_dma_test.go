@@ -0,0 +1,152 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runOAMDMA(m *MMU, cycles int) {
+	for i := 0; i < cycles; i++ {
+		m.stepOAMDMA()
+	}
+}
+
+func TestOAMDMATakes160MCycles(t *testing.T) {
+	c := NewTestCPU()
+	m := c.mmu
+	for i := uint16(0); i < oamDMALength; i++ {
+		m.writeMemory(0xC100+i, byte(i+1))
+	}
+
+	m.writeMemory(DMA, 0xC1)
+	assert.Equal(t, byte(0xC1), m.readMemory(DMA))
+
+	// one M-cycle to start
+	runOAMDMA(m, 1)
+	assert.Equal(t, byte(0), m.ram[0xFE00])
+	assert.False(t, m.oamDMA.blocking)
+
+	runOAMDMA(m, 1)
+	assert.Equal(t, byte(1), m.ram[0xFE00])
+	assert.Equal(t, byte(0), m.ram[0xFE01])
+	assert.True(t, m.oamDMA.blocking)
+
+	runOAMDMA(m, oamDMALength-1)
+	for i := uint16(0); i < oamDMALength; i++ {
+		assert.Equal(t, byte(i+1), m.ram[0xFE00+i])
+	}
+	assert.True(t, m.oamDMA.blocking)
+
+	runOAMDMA(m, 1)
+	assert.False(t, m.oamDMA.blocking)
+}
+
+func TestOAMDMAReadsThroughTheBus(t *testing.T) {
+	rom := make([]byte, 1<<15)
+	for i := 0; i < oamDMALength; i++ {
+		rom[0x4200+i] = byte(i + 1)
+	}
+	c := NewEmulator(withMBC(NewMBC(rom)), WithDisableApu()).cpu
+	m := c.mmu
+
+	m.writeMemory(DMA, 0x42)
+	runOAMDMA(m, oamDMALength+1)
+	assert.Equal(t, byte(1), m.ram[0xFE00])
+	assert.Equal(t, byte(oamDMALength), m.ram[0xFE9F])
+
+	// echo RAM
+	m.writeMemory(0xC300, 0x12)
+	m.writeMemory(DMA, 0xE3)
+	runOAMDMA(m, oamDMALength+1)
+	assert.Equal(t, byte(0x12), m.ram[0xFE00])
+}
+
+func TestOAMDMABusConflicts(t *testing.T) {
+	c := NewTestCPU()
+	m := c.mmu
+	m.writeMemory(0xC100, 0x12)
+	m.writeMemory(0xC000, 0x34)
+	m.writeMemory(0x8000, 0x56)
+	m.writeMemory(0xFF80, 0x78)
+
+	m.writeMemory(DMA, 0xC1)
+	runOAMDMA(m, 2)
+
+	// same bus as the transfer: the CPU sees the byte being transferred
+	assert.Equal(t, byte(0x12), m.cpuReadMemory(0xC000))
+	m.cpuWriteMemory(0xC000, 0)
+	assert.Equal(t, byte(0x34), m.readMemory(0xC000))
+
+	// OAM is not accessible
+	assert.Equal(t, byte(0xFF), m.cpuReadMemory(0xFE00))
+	m.cpuWriteMemory(0xFE10, 0x42)
+	assert.Equal(t, byte(0), m.readMemory(0xFE10))
+
+	// other buses are accessible
+	assert.Equal(t, byte(0x56), m.cpuReadMemory(0x8000))
+	assert.Equal(t, byte(0x78), m.cpuReadMemory(0xFF80))
+	m.cpuWriteMemory(0xFF81, 0x42)
+	assert.Equal(t, byte(0x42), m.readMemory(0xFF81))
+}
+
+func TestOAMDMARestart(t *testing.T) {
+	c := NewTestCPU()
+	m := c.mmu
+	for i := uint16(0); i < oamDMALength; i++ {
+		m.writeMemory(0xC100+i, 1)
+		m.writeMemory(0xC200+i, 2)
+	}
+
+	m.writeMemory(DMA, 0xC1)
+	runOAMDMA(m, 11)
+	m.writeMemory(DMA, 0xC2)
+
+	// the previous transfer continues while the new one starts
+	runOAMDMA(m, 1)
+	assert.True(t, m.oamDMA.blocking)
+	assert.Equal(t, byte(1), m.ram[0xFE0A])
+
+	runOAMDMA(m, oamDMALength)
+	for i := uint16(0); i < oamDMALength; i++ {
+		assert.Equal(t, byte(2), m.ram[0xFE00+i])
+	}
+}
+
+func TestOAMDMAFromCPU(t *testing.T) {
+	c := NewTestCPU()
+	c.mmu.writeMemory(0xC100, 0x42)
+
+	// LDH (46),A then NOP
+	c.PC = 0xFF80
+	c.reg[A] = 0xC1
+	c.mmu.writeMemory(0xFF80, 0xE0)
+	c.mmu.writeMemory(0xFF81, 0x46)
+	c.mmu.writeMemory(0xFF82, 0x00)
+
+	c.Step()
+	assert.False(t, c.mmu.oamDMA.active)
+	c.Step()
+	assert.True(t, c.mmu.oamDMA.active)
+	assert.Equal(t, byte(0), c.mmu.ram[0xFE00])
+
+	for c.mmu.oamDMA.active {
+		c.tick()
+	}
+	assert.Equal(t, byte(0x42), c.mmu.ram[0xFE00])
+}
+
+func TestOAMDMAHidesOAMFromThePPU(t *testing.T) {
+	emulator := NewEmulator(WithNoRom(), WithDisableApu())
+	m := emulator.mmu
+	m.writeMemory(0xFE00, 16)
+	m.writeMemory(0xFE01, 8)
+
+	emulator.ppu.searchOAM(0)
+	assert.Len(t, emulator.ppu.sprites, 1)
+
+	m.writeMemory(DMA, 0xFE)
+	runOAMDMA(m, 2)
+	emulator.ppu.searchOAM(0)
+	assert.Len(t, emulator.ppu.sprites, 0)
+}
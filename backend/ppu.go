@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"image"
 	"image/color"
-	"sort"
 )
 
 const (
@@ -15,22 +14,45 @@ const (
 // PPU represents the pixel processing unit
 // contains references to ram sections containing video relevant data
 type PPU struct {
-	ram          []byte      // reference to memory shared with CPU
+	ram          []byte // reference to memory shared with CPU
+	mmu          *MMU   // for CGB banked VRAM and palette RAM
+	cgb          bool
 	Image        *image.RGBA // represents the current screen
 	rawLastImage *[ROWS * COLS]byte
-	screenBuffer *[ROWS * COLS]byte // contains the pixels to draw on next refresh
-	irq          bool
+	screenBuffer *[ROWS * COLS]byte   // contains the pixels to draw on next refresh
+	colorBuffer  *[ROWS * COLS]uint16 // CGB only: RGB555 pixels to draw on next refresh
+	irq          bool                 // state of the STAT interrupt line
 	sprites      Sprites
 
-	stepCpu func(int)
+	stepCpu func()
 
+	// the window is only displayed once LY == WY during the frame, even if WY changes afterwards
+	windowYTriggered bool
+	// internal line counter of the window, only incremented on lines where the window is displayed
 	windowCounter int
+	// WX = 166 makes the window cover the whole next line
+	windowWrap bool
+
+	fifo          pixelFIFO
+	pixelTransfer bool // mode 3
+
+	dot       int  // position within the current line (0-455)
+	line      byte // current line (0-153)
+	lyCompare int  // line compared with LYC, see compareLY
+	frameDone bool
+	frameDots int // dots since the end of the last frame
+
+	lcdOn      bool
+	lcdJustOn  bool // the first line after turning the LCD on has no OAM scan
+	blankFrame bool // the first frame after turning the LCD on is not displayed
 }
 
 // NewPPU creates a new PPU object
-func NewPPU(ram []byte, stepCpu func(int)) *PPU {
+func NewPPU(mmu *MMU, stepCpu func()) *PPU {
 	p := new(PPU)
-	p.ram = ram
+	p.ram = mmu.ram
+	p.mmu = mmu
+	p.cgb = mmu.cgb
 	p.Image = image.NewRGBA(image.Rectangle{image.Point{0, 0}, image.Point{COLS, ROWS}})
 	p.stepCpu = stepCpu
 
@@ -40,8 +62,16 @@ func NewPPU(ram []byte, stepCpu func(int)) *PPU {
 	var screenBuffer [ROWS * COLS]byte
 	p.screenBuffer = &screenBuffer
 
+	if p.cgb {
+		var colorBuffer [ROWS * COLS]uint16
+		p.colorBuffer = &colorBuffer
+	}
+
 	p.sprites = make([]Sprite, 0, 10)
 
+	p.lcdOn = p.LCDCBitSet(lcdDisplayEnable)
+	mmu.ppu = p
+
 	return p
 }
 
@@ -56,6 +86,8 @@ const (
 	lcdDisplayEnable                  // (0=Off, 1=On)
 
 	LCDC = 0xFF40
+	WY   = 0xFF4A
+	WX   = 0xFF4B
 )
 
 func (p *PPU) LCDCBitSet(bitnum uint) bool {
@@ -72,10 +104,6 @@ func (p *PPU) getBackgroundTileData() ([]byte, bool) {
 	return p.ram[0x8800 : 0x97FF+1], true
 }
 
-func (p *PPU) getWindowTileData() ([]byte, bool) {
-	return p.getBackgroundTileData()
-}
-
 func (p *PPU) getBackgroundTileMap() []byte {
 	if p.LCDCBitSet(bgTileMapDisplaySelect) {
 		return p.ram[0x9C00 : 0x9FFF+1]
@@ -102,55 +130,6 @@ func (p *PPU) getScroll() (byte, byte) {
 	return p.ram[0xFF42], p.ram[0xFF43]
 }
 
-func (p *PPU) getBackgroundPixels(lineNumber byte) [160]byte {
-
-	pixels := [160]byte{}
-	if !p.LCDCBitSet(bgDisplay) {
-		return pixels
-	}
-
-	tileMap := p.getBackgroundTileMap()
-	tileData, interpretIndexAsSigned := p.getBackgroundTileData()
-
-	scrollY, scrollX := p.getScroll()
-	rowInTile := (scrollY + lineNumber) % 8
-	tileRow := (scrollY + lineNumber) / 8
-
-	for i := byte(0); i < 160; i++ {
-
-		// compute in which background tile we fall in (in a 32 x 32 grid)
-		tileColumn := (scrollX + i) / 8
-		tileIndex := uint(tileRow)*32 + uint(tileColumn)
-
-		// get the tile data index for that tile
-		tileMapIndex := tileMap[tileIndex]
-
-		// if we are using 0x8000 to 0x8FFF
-		// then 0-127 maps to 8000-87FF and 128-255 maps to 8800-8FFF
-		//
-		// if we are using the 0x8800 to 0x97FF
-		// then 0-127 maps to 9000-97FF whereas 128-255 maps to 8800-8FFF
-		//
-		// we can just flip the MSB of the data index in the 0x8800 to 0x97FF case
-		if interpretIndexAsSigned {
-			tileMapIndex ^= 0x80
-		}
-
-		// 16 bytes per tile, 8 lines of 8 pixels per tiles
-		// meaning 2 bytes per line
-		lineDataIndex := uint(tileMapIndex)*16 + 2*uint(rowInTile)
-		pixelInLine := (scrollX + i) % 8
-		msb := (tileData[lineDataIndex+1] >> (7 - pixelInLine)) & 1
-		lsb := (tileData[lineDataIndex] >> (7 - pixelInLine)) & 1
-
-		colorCode := (msb << 1) | lsb
-
-		pixels[i] = mapColorToPalette(p.getBGPalette(), colorCode)
-	}
-
-	return pixels
-}
-
 func max(a, b byte) byte {
 	if a > b {
 		return a
@@ -158,72 +137,10 @@ func max(a, b byte) byte {
 	return b
 }
 
+// getWindowPosition returns WY and WX
+// the window starts on the first line where LY == WY, at the pixel WX - 7
 func (p *PPU) getWindowPosition() (byte, byte) {
-	// HACK: Link's awakening writes 6 to WX, whereas topleft is 7
-	// I'm not sure what should happen in this case, so just change anything under 7 to 7
-	return p.ram[0xFF4A], max(p.ram[0xFF4B], 7) - 7
-}
-
-func (p *PPU) getWindowPixels(lineNumber byte) [160]byte {
-
-	pixels := [160]byte{}
-	for i := 0; i < 160; i++ {
-		pixels[i] = 0xFF
-	}
-
-	if !p.LCDCBitSet(windowDisplayEnable) {
-		return pixels
-	}
-
-	yPos, xPos := p.getWindowPosition()
-	if yPos > lineNumber || xPos > 159 {
-		return pixels
-	}
-
-	tileMap := p.getWindowTileMap()
-	tileData, interpretIndexAsSigned := p.getWindowTileData()
-
-	rowInTile := (lineNumber - yPos) % 8
-	tileRow := p.windowCounter / 8
-
-	for i := 0; i < 160-int(xPos); i++ {
-
-		// compute in which background tile we fall in (in a 32 x 32 grid)
-		tileColumn := i / 8
-		tileIndex := uint(tileRow)*32 + uint(tileColumn)
-
-		// get the tile data index for that tile
-		tileMapIndex := tileMap[tileIndex]
-
-		// if we are using 0x8000 to 0x8FFF
-		// then 0-127 maps to 8000-87FF and 128-255 maps to 8800-8FFF
-		//
-		// if we are using the 0x8800 to 0x97FF
-		// then 0-127 maps to 9000-97FF whereas 128-255 maps to 8800-8FFF
-		//
-		// we can just flip the MSB of the data index in the 0x8800 to 0x97FF case
-		if interpretIndexAsSigned {
-			tileMapIndex ^= 0x80
-		}
-
-		// 16 bytes per tile, 8 lines of 8 pixels per tiles
-		// meaning 2 bytes per line
-		lineDataIndex := uint(tileMapIndex)*16 + 2*uint(rowInTile)
-		lineData := tileData[lineDataIndex : lineDataIndex+2]
-
-		pixelInLine := uint(i) % 8
-		msb := (lineData[1] >> (7 - pixelInLine)) & 1
-		lsb := (lineData[0] >> (7 - pixelInLine)) & 1
-
-		colorCode := (msb << 1) | lsb
-
-		pixels[int(xPos)+i] = mapColorToPalette(p.getBGPalette(), colorCode)
-	}
-
-	p.windowCounter++
-
-	return pixels
-
+	return p.ram[WY], p.ram[WX]
 }
 
 func (p *PPU) getSpriteData() []byte {
@@ -253,44 +170,26 @@ type Sprite struct {
 	xPos      byte
 	yPos      byte
 	tileIndex byte
-	palette   byte
 	xFlipped  bool
 	yFlipped  bool
-	priority  bool
+	flags     byte // raw attributes, used for the CGB palette and VRAM bank
 }
 
 type Sprites []Sprite
 
-// use pointer receiver on all these to avoid allocations
-
-func (sp *Sprites) Less(i, j int) bool {
-	s := *sp
-	if s[i].xPos < s[j].xPos {
-		return true
-	} else if s[i].xPos == s[j].xPos && s[i].position < s[j].position {
-		return true
-	}
-	return false
-}
-func (sp *Sprites) Len() int { return len(*sp) }
-func (sp *Sprites) Swap(i, j int) {
-	s := *sp
-	s[i], s[j] = s[j], s[i]
-}
-
-func (p *PPU) getSpritePixels(lineNumber byte) ([160]byte, [160]byte, [160]bool) {
-
-	if !p.LCDCBitSet(objDisplayEnable) {
-		return [160]byte{}, [160]byte{}, [160]bool{}
-	}
-
-	// Implements OAM searching and sprite rendering
+// searchOAM fills p.sprites with the (up to 10) sprites visible on the given line
+func (p *PPU) searchOAM(lineNumber byte) {
 	attributes := p.getSpriteAttributes()
 	spriteHeight := p.getSpriteHeight()
 
 	// reset sprites array but keep underlying memory to reduce allocations
 	p.sprites = p.sprites[:0]
 
+	// OAM is not accessible while a DMA transfer runs
+	if p.mmu.oamDMA.blocking {
+		return
+	}
+
 	for i := 0; i < 40 && len(p.sprites) < 10; i++ {
 
 		yPos := attributes[4*i]
@@ -307,136 +206,235 @@ func (p *PPU) getSpritePixels(lineNumber byte) ([160]byte, [160]byte, [160]bool)
 		flags := attributes[4*i+3]
 		xFlipped := flags&0x20 > 0
 		yFlipped := flags&0x40 > 0
-		palette := p.getSpritePalette(flags)
-		priority := flags&0x80 == 0
 
-		p.sprites = append(p.sprites, Sprite{i, xPos, yPos, tileIndex, palette, xFlipped, yFlipped, priority})
+		p.sprites = append(p.sprites, Sprite{i, xPos, yPos, tileIndex, xFlipped, yFlipped, flags})
 	}
+}
 
-	sort.Sort(&p.sprites)
+// spriteRowInTile computes which row of the sprite's tile to draw on the given line
+// for 8x16 sprites, also selects the top or bottom tile
+func (p *PPU) spriteRowInTile(s *Sprite, lineNumber, spriteHeight byte) byte {
+	var rowInTile byte
+	if s.yPos < 16 {
+		rowInTile = 16 - s.yPos + lineNumber
+	} else {
+		rowInTile = lineNumber - (s.yPos - 16)
+	}
 
-	pixels := [160]byte{}
-	palettes := [160]byte{}
-	priorities := [160]bool{}
-	tileData := p.getSpriteData()
-	for _, s := range p.sprites {
-		var rowInTile byte
-		if s.yPos < 16 {
-			rowInTile = 16 - s.yPos + lineNumber
+	if spriteHeight == 16 {
+		if rowInTile >= 8 {
+			s.tileIndex |= 1
+			rowInTile -= 8
 		} else {
-			rowInTile = lineNumber - (s.yPos - 16)
+			s.tileIndex &= 0xFE
 		}
 
-		if spriteHeight == 16 {
-			if rowInTile >= 8 {
-				s.tileIndex |= 1
-				rowInTile -= 8
-			} else {
-				s.tileIndex &= 0xFE
-			}
+		// for 16 high sprites, top becomes bottom and bottom becomes top
+		// so flip the tileIndex bit in that case
+		if s.yFlipped {
+			s.tileIndex ^= 1
+		}
+	}
+
+	if s.yFlipped {
+		return 7 - rowInTile
+	}
+	return rowInTile
+}
+
+func reverse(in byte) byte {
+	return (in & 0x1 << 7) | (in & 0x2 << 5) | (in & 0x4 << 3) | (in & 0x8 << 1) |
+		(in & 0x10 >> 1) | (in & 0x20 >> 3) | (in & 0x40 >> 5) | (in & 0x80 >> 7)
+}
+
+const (
+	DOTS_PER_LINE   = 456
+	OAM_DOTS        = 80
+	LINES_PER_FRAME = 154
+	DOTS_PER_FRAME  = DOTS_PER_LINE * LINES_PER_FRAME
+)
+
+// RunEmulatorForAFrame runs the CPU until the PPU has gone through all 154 lines,
+// or for a frame worth of dots if the LCD was turned off or on in the meantime
+// the CPU advances the PPU on every M-cycle, see CPU.tick
+func (p *PPU) RunEmulatorForAFrame() {
+	p.frameDone = false
+	for !p.frameDone {
+		p.stepCpu()
+	}
+}
 
-			// for 16 high sprites, top becomes bottom and bottom becomes top
-			// so flip the tileIndex bit in that case
-			if s.yFlipped {
-				s.tileIndex ^= 1
+// Step advances the PPU by the given number of dots
+func (p *PPU) Step(dots int) {
+	for i := 0; i < dots; i++ {
+		if p.LCDCBitSet(lcdDisplayEnable) != p.lcdOn {
+			if p.lcdOn {
+				p.turnLCDOff()
+			} else {
+				p.turnLCDOn()
 			}
 		}
 
-		lineDataIndex := uint(s.tileIndex)*16 + 2*uint(rowInTile)
-		if s.yFlipped {
-			lineDataIndex = uint(s.tileIndex)*16 + 2*7 - 2*uint(rowInTile)
-		}
-		lsbs := tileData[lineDataIndex]
-		msbs := tileData[lineDataIndex+1]
-		if s.xFlipped {
-			lsbs = reverse(lsbs)
-			msbs = reverse(msbs)
+		if p.lcdOn {
+			p.stepDot()
 		}
 
-		for l := 0; l < 8; l++ {
-			if s.xPos < 8-byte(l) {
-				continue
+		p.frameDots++
+		p.dot++
+		if p.dot == DOTS_PER_LINE {
+			p.dot = 0
+			p.line++
+			if p.line == LINES_PER_FRAME {
+				p.line = 0
+				p.endFrame()
 			}
-			msb := (msbs >> (7 - byte(l))) & 1
-			lsb := (lsbs >> (7 - byte(l))) & 1
-
-			colorCode := (msb << 1) | lsb
+		}
 
-			pos := s.xPos - 8 + byte(l)
-			if pos <= 159 && pixels[pos] == 0 && colorCode > 0 {
-				pixels[pos] = colorCode
-				palettes[pos] = s.palette
-				priorities[pos] = s.priority
-			}
+		// turning the LCD on restarts from line 0, the frame ends anyway so that a game
+		// turning the LCD off and on on every frame doesn't run forever
+		if p.frameDots == DOTS_PER_FRAME {
+			p.endFrame()
 		}
 	}
+}
+
+func (p *PPU) endFrame() {
+	p.frameDone = true
+	p.frameDots = 0
 
-	return pixels, palettes, priorities
+	// when the LCD is off, the CPU still runs for a frame worth of dots
+	if !p.lcdOn {
+		p.writeBufferToImage()
+	}
 }
 
-func reverse(in byte) byte {
-	return (in & 0x1 << 7) | (in & 0x2 << 5) | (in & 0x4 << 3) | (in & 0x8 << 1) |
-		(in & 0x10 >> 1) | (in & 0x20 >> 3) | (in & 0x40 >> 5) | (in & 0x80 >> 7)
+// turnLCDOff takes effect immediately: LY reads 0, STAT reports mode 0 and the screen goes blank
+func (p *PPU) turnLCDOff() {
+	p.lcdOn = false
+	p.pixelTransfer = false
+
+	p.ram[LY] = 0
+	p.setControllerMode(HBlank)
+	p.irq = false
+
+	p.clearScreen()
 }
 
-func (p *PPU) RunCPU(cycles int) {
-	p.stepCpu(cycles * 4)
+// turnLCDOn starts a new frame from line 0
+func (p *PPU) turnLCDOn() {
+	p.lcdOn = true
+	p.lcdJustOn = true
+	p.blankFrame = true
+
+	p.dot = 0
+	p.line = 0
+	p.compareLY(0)
+	p.updateSTATLine()
 }
 
-func (p *PPU) performPixelTransfer(lineNumber byte) {
-	background := p.getBackgroundPixels(lineNumber)
-	window := p.getWindowPixels(lineNumber)
-	sprites, palettes, priorities := p.getSpritePixels(lineNumber)
+// setPowerUpPosition moves the PPU to the position in VBlank where the boot rom hands over
+// on line 153, the dot must be past the point where LY reads 0
+func (p *PPU) setPowerUpPosition(line byte, dot int) {
+	p.line = line
+	p.dot = dot
+	p.frameDots = int(line)*DOTS_PER_LINE + dot
 
-	for i := range background {
-		if window[i] < 0xFF {
-			p.screenBuffer[int(lineNumber)*160+i] = window[i]
-		} else {
-			p.screenBuffer[int(lineNumber)*160+i] = background[i]
-		}
+	p.ram[LY] = line
+	if line == LINES_PER_FRAME-1 {
+		p.ram[LY] = 0
+	}
+	p.compareLY(int(p.ram[LY]))
+	p.setControllerMode(VBlank)
+	p.updateSTATLine()
+}
 
-		if sprites[i] > 0 {
-			if priorities[i] || p.screenBuffer[int(lineNumber)*160+i] == 0 {
-				p.screenBuffer[int(lineNumber)*160+i] = mapColorToPalette(palettes[i], sprites[i])
-			}
+func (p *PPU) clearScreen() {
+	for i := range p.screenBuffer {
+		p.screenBuffer[i] = 0
+	}
+	if p.cgb {
+		for i := range p.colorBuffer {
+			p.colorBuffer[i] = 0x7FFF
 		}
 	}
 }
 
-func (p *PPU) RunEmulatorForAFrame() {
+// stepDot performs the work happening on the current dot, if any
+func (p *PPU) stepDot() {
+	switch p.dot {
+	case 0:
+		p.startLine()
+	case 4:
+		// LY=LYC is compared one M-cycle after LY changes
+		// on line 153, LY only reads 153 for one M-cycle before reading 0
+		if p.line == LINES_PER_FRAME-1 {
+			p.ram[LY] = 0
+		}
+		p.compareLY(int(p.line))
+	case 8:
+		if p.line == LINES_PER_FRAME-1 {
+			p.compareLY(-1)
+		}
+	case 12:
+		if p.line == LINES_PER_FRAME-1 {
+			p.compareLY(0)
+		}
+	}
 
-	if !p.LCDCBitSet(lcdDisplayEnable) {
-		p.RunCPU(154 * 114)
-		return
+	if p.line < ROWS {
+		p.stepVisibleLine()
 	}
 
-	p.windowCounter = 0
+	p.updateSTATLine()
+}
 
-	for lineNumber := byte(0); lineNumber < 144; lineNumber++ {
-		p.writeLY(lineNumber)
+func (p *PPU) startLine() {
+	p.ram[LY] = p.line
+	if p.line == 0 {
+		// LY already was 0 at the end of line 153
+		p.windowYTriggered = false
+		p.windowCounter = 0
+		p.windowWrap = false
+	} else {
+		p.compareLY(-1)
+	}
 
+	if p.line == ROWS {
+		if p.blankFrame {
+			p.clearScreen()
+			p.blankFrame = false
+		}
+		p.writeBufferToImage()
+		p.dispatchVBlankInterrupt()
+		p.setControllerMode(VBlank)
+	} else if p.line < ROWS && !p.lcdJustOn {
 		p.setControllerMode(OAM)
-		p.RunCPU(20)
-
-		p.setControllerMode(PixelTransfer)
-		p.RunCPU(43)
-
-		p.performPixelTransfer(lineNumber)
+	}
 
-		p.setControllerMode(HBlank)
-		p.RunCPU(51)
+	if p.line < ROWS && p.ram[WY] == p.line {
+		p.windowYTriggered = true
 	}
+}
 
-	p.writeBufferToImage()
+func (p *PPU) stepVisibleLine() {
+	if p.dot == OAM_DOTS {
+		p.lcdJustOn = false
+		p.setControllerMode(PixelTransfer)
+		p.startPixelTransfer()
+		p.pixelTransfer = true
+	}
 
-	p.writeLY(144)
-	p.dispatchVBlankInterrupt()
-	p.setControllerMode(VBlank)
-	p.RunCPU(114)
+	if p.pixelTransfer && p.stepPixelTransfer() {
+		p.pixelTransfer = false
+		if p.fifo.windowRendered {
+			p.windowCounter++
+		}
+		p.windowWrap = p.fifo.windowWrap
 
-	for lineNumber := byte(145); lineNumber < 154; lineNumber++ {
-		p.writeLY(lineNumber)
-		p.RunCPU(114)
+		p.setControllerMode(HBlank)
+		if p.cgb {
+			p.mmu.HBlank()
+		}
 	}
 }
 
@@ -460,6 +458,11 @@ func mean(a, b byte) byte {
 }
 
 func (p *PPU) writeBufferToImage() {
+	if p.cgb {
+		p.writeCGBBufferToImage()
+		return
+	}
+
 	for i := 0; i < 144; i++ {
 		for j := 0; j < 160; j++ {
 			currentColor := p.rawLastImage[i*COLS+j]
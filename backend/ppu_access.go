@@ -0,0 +1,77 @@
+package backend
+
+// the PPU locks VRAM during mode 3 and OAM during modes 2 and 3
+// the CPU reads 0xFF and its writes are ignored
+func (p *PPU) cpuCanAccess(address uint16) bool {
+	mode := ControllerMode(p.ram[STAT] & 0x3)
+	if isVRAMBus(address) {
+		return mode != PixelTransfer
+	}
+	if 0xFE00 <= address && address < 0xFF00 {
+		return mode != OAM && mode != PixelTransfer
+	}
+	return true
+}
+
+// OAM corruption bug
+// on DMG, when the CPU puts an address between 0xFE00 and 0xFEFF on the bus during the OAM scan,
+// the row of 8 bytes the PPU is reading gets corrupted with the values of the previous rows
+// this also happens when a 16 bit register is incremented or decremented, e.g. INC rr or PUSH
+type oamBugAccess int
+
+const (
+	oamBugWrite oamBugAccess = iota // also for increments and decrements
+	oamBugRead
+	oamBugReadIncDec // read in the same M-cycle as an increment or decrement, e.g. LD A, (HL+) or POP
+
+	oamRowLength = 8
+	oamRows      = oamDMALength / oamRowLength
+)
+
+// oamBug is called on every CPU access and 16 bit increment or decrement
+func (m *MMU) oamBug(address uint16, access oamBugAccess) {
+	if address>>8 != 0xFE || m.ppu == nil || !m.model.isDMGFamily() {
+		return
+	}
+	m.ppu.corruptOAM(access)
+}
+
+func (p *PPU) corruptOAM(access oamBugAccess) {
+	if p.ram[STAT]&0x3 != byte(OAM) {
+		return
+	}
+
+	// the scan reads one row per M-cycle, the first row is never corrupted
+	row := p.dot / 4
+	if row == 0 || row >= oamRows {
+		return
+	}
+
+	oam := p.ram[0xFE00 : 0xFE00+oamDMALength]
+	current := oam[row*oamRowLength : (row+1)*oamRowLength]
+	previous := oam[(row-1)*oamRowLength : row*oamRowLength]
+
+	if access == oamBugReadIncDec {
+		if 4 <= row && row < oamRows-1 {
+			beforePrevious := oam[(row-2)*oamRowLength : (row-1)*oamRowLength]
+			for i := 0; i < 2; i++ {
+				a, b, c, d := beforePrevious[i], previous[i], current[i], previous[4+i]
+				previous[i] = b&(a|c|d) | a&c&d
+			}
+			copy(current, previous)
+			copy(beforePrevious, previous)
+		}
+		access = oamBugRead
+	}
+
+	// the operations are done on the first 16 bit word of the row, one byte at a time
+	for i := 0; i < 2; i++ {
+		a, b, c := current[i], previous[i], previous[4+i]
+		if access == oamBugWrite {
+			current[i] = ((a ^ c) & (b ^ c)) ^ c
+		} else {
+			current[i] = b | a&c
+		}
+	}
+	copy(current[2:], previous[2:])
+}
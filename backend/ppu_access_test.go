@@ -0,0 +1,143 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVRAMAndOAMLockedByPPU(t *testing.T) {
+	c := NewTestCPU()
+	c.mmu.writeMemory(0x8000, 0x12)
+	c.mmu.writeMemory(0xFE00, 0x34)
+
+	// OAM scan
+	stepPPUTo(c.ppu, 1, 40)
+	assert.Equal(t, byte(0x12), c.mmu.cpuReadMemory(0x8000))
+	assert.Equal(t, byte(0xFF), c.mmu.cpuReadMemory(0xFE00))
+
+	// pixel transfer
+	stepPPUTo(c.ppu, 1, 100)
+	assert.Equal(t, byte(0xFF), c.mmu.cpuReadMemory(0x8000))
+	assert.Equal(t, byte(0xFF), c.mmu.cpuReadMemory(0xFE00))
+
+	c.mmu.cpuWriteMemory(0x8000, 0x56)
+	c.mmu.cpuWriteMemory(0xFE00, 0x78)
+	assert.Equal(t, byte(0x12), c.mmu.readMemory(0x8000))
+	assert.Equal(t, byte(0x34), c.mmu.readMemory(0xFE00))
+
+	// HBlank
+	stepPPUTo(c.ppu, 1, 300)
+	assert.Equal(t, byte(0x12), c.mmu.cpuReadMemory(0x8000))
+	assert.Equal(t, byte(0x34), c.mmu.cpuReadMemory(0xFE00))
+
+	// everything is accessible when the LCD is off
+	c.mmu.writeMemory(LCDC, 0)
+	stepPPUTo(c.ppu, 2, 100)
+	assert.Equal(t, byte(0x12), c.mmu.cpuReadMemory(0x8000))
+	assert.Equal(t, byte(0x34), c.mmu.cpuReadMemory(0xFE00))
+}
+
+func fillOAM(c *CPU) {
+	for i := uint16(0); i < oamDMALength; i++ {
+		c.mmu.ram[0xFE00+i] = byte(i * 37)
+	}
+}
+
+// the bug is triggered on the M-cycle ending at dot 40 of the OAM scan, while the PPU reads row 10
+func triggerOAMBug(c *CPU, f func()) {
+	fillOAM(c)
+	stepPPUTo(c.ppu, 1, 36)
+	f()
+}
+
+func TestOAMBugIncDec(t *testing.T) {
+	c := NewTestCPU()
+	triggerOAMBug(c, func() {
+		c.incDec(0xFE10)
+	})
+
+	assert.Equal(t, []byte{0xF8, 0xA5, 0xB2, 0xD7, 0xFC, 0x21, 0x46, 0x6B}, c.mmu.ram[0xFE50:0xFE58])
+	// the other rows are untouched
+	assert.Equal(t, byte(9*8*37%256), c.mmu.ram[0xFE48])
+	assert.Equal(t, byte(11*8*37%256), c.mmu.ram[0xFE58])
+}
+
+func TestOAMBugRead(t *testing.T) {
+	c := NewTestCPU()
+	triggerOAMBug(c, func() {
+		assert.Equal(t, byte(0xFF), c.readMemory(0xFE10))
+	})
+
+	assert.Equal(t, []byte{0xF8, 0xAD, 0xB2, 0xD7, 0xFC, 0x21, 0x46, 0x6B}, c.mmu.ram[0xFE50:0xFE58])
+}
+
+func TestOAMBugReadIncDec(t *testing.T) {
+	c := NewTestCPU()
+	triggerOAMBug(c, func() {
+		c.readMemoryIncDec(0xFE10)
+	})
+
+	// the corrupted row before is copied over the two rows around it
+	row := []byte{0x68, 0xA5, 0xB2, 0xD7, 0xFC, 0x21, 0x46, 0x6B}
+	assert.Equal(t, row, c.mmu.ram[0xFE40:0xFE48])
+	assert.Equal(t, row, c.mmu.ram[0xFE48:0xFE50])
+	assert.Equal(t, row, c.mmu.ram[0xFE50:0xFE58])
+}
+
+func TestNoOAMBug(t *testing.T) {
+	expected := make([]byte, oamDMALength)
+	for i := range expected {
+		expected[i] = byte(i * 37)
+	}
+
+	// outside of OAM
+	c := NewTestCPU()
+	triggerOAMBug(c, func() {
+		c.incDec(0xFF10)
+	})
+	assert.Equal(t, expected, c.mmu.ram[0xFE00:0xFEA0])
+
+	// outside of the OAM scan
+	c = NewTestCPU()
+	fillOAM(c)
+	stepPPUTo(c.ppu, 1, 200)
+	c.incDec(0xFE10)
+	assert.Equal(t, expected, c.mmu.ram[0xFE00:0xFEA0])
+
+	// fixed on CGB
+	c = NewTestCGBCPU()
+	triggerOAMBug(c, func() {
+		c.incDec(0xFE10)
+	})
+	assert.Equal(t, expected, c.mmu.ram[0xFE00:0xFEA0])
+}
+
+func TestOAMBugFromInstructions(t *testing.T) {
+	for _, instruction := range []struct {
+		name     string
+		opcode   byte
+		register func(c *CPU) uint16
+		set      func(c *CPU, value uint16)
+		expected uint16
+	}{
+		{"INC BC", 0x03, (*CPU).ReadBC, func(c *CPU, v uint16) { c.Writedouble(B, C, v) }, 0xFE11},
+		{"DEC DE", 0x1B, (*CPU).ReadDE, func(c *CPU, v uint16) { c.Writedouble(D, E, v) }, 0xFE0F},
+		{"INC HL", 0x23, (*CPU).ReadHL, func(c *CPU, v uint16) { c.Writedouble(H, L, v) }, 0xFE11},
+		{"DEC SP", 0x3B, func(c *CPU) uint16 { return c.SP }, func(c *CPU, v uint16) { c.SP = v }, 0xFE0F},
+	} {
+		c := NewTestCPU()
+		c.mmu.ram[0xC000] = instruction.opcode
+		c.PC = 0xC000
+		instruction.set(c, 0xFE10)
+
+		// the opcode is fetched on the M-cycle ending at dot 36, the register is changed on the next one
+		fillOAM(c)
+		stepPPUTo(c.ppu, 1, 32)
+		c.Step()
+
+		assert.Equal(t, instruction.expected, instruction.register(c), instruction.name)
+		assert.Equal(t, uint16(0xC001), c.PC, instruction.name)
+		assert.Equal(t, []byte{0xF8, 0xA5, 0xB2, 0xD7, 0xFC, 0x21, 0x46, 0x6B}, c.mmu.ram[0xFE50:0xFE58], instruction.name)
+	}
+}
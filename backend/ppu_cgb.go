@@ -0,0 +1,57 @@
+package backend
+
+import (
+	"image/color"
+)
+
+// CGB background map attributes, stored in VRAM bank 1 at the same offset as the tile index
+const (
+	attrPalette  = 0x07 // background palette number (0-7)
+	attrBank     = 0x08 // tile data VRAM bank
+	attrXFlip    = 0x20
+	attrYFlip    = 0x40
+	attrPriority = 0x80 // background has priority over sprites
+)
+
+// getCGBTileData returns the tile data block for the given VRAM bank
+// as well as whether the tile index should be interpreted as signed (see fetchTileData)
+func (p *PPU) getCGBTileData(bank byte) ([]byte, bool) {
+	vram := p.mmu.vram[bank]
+	if p.LCDCBitSet(bgWindowTileDataSelect) {
+		return vram[0x0000:0x1000], false
+	}
+	return vram[0x0800:0x1800], true
+}
+
+// getCGBTileMapAttributes returns the attribute map matching the given tile map
+// tileMapDisplaySelect is either bgTileMapDisplaySelect or windowTileMapDisplaySelect
+func (p *PPU) getCGBTileMapAttributes(tileMapDisplaySelect uint) []byte {
+	if p.LCDCBitSet(tileMapDisplaySelect) {
+		return p.mmu.vram[1][0x1C00:0x2000]
+	}
+	return p.mmu.vram[1][0x1800:0x1C00]
+}
+
+// getCGBColor looks up a RGB555 color in palette RAM (little endian, 8 bytes per palette)
+func getCGBColor(paletteRam *[64]byte, palette, colorCode byte) uint16 {
+	index := palette*8 + colorCode*2
+	return (uint16(paletteRam[index]) | uint16(paletteRam[index+1])<<8) & 0x7FFF
+}
+
+// expand a 5 bit color channel to 8 bits
+func expandColorChannel(c uint16) byte {
+	c &= 0x1F
+	return byte(c<<3 | c>>2)
+}
+
+func rgb555ToRGBA(c uint16) color.RGBA {
+	return color.RGBA{expandColorChannel(c), expandColorChannel(c >> 5), expandColorChannel(c >> 10), 0xFF}
+}
+
+func (p *PPU) writeCGBBufferToImage() {
+	for i := 0; i < 144; i++ {
+		for j := 0; j < 160; j++ {
+			p.Image.SetRGBA(j, i, rgb555ToRGBA(p.colorBuffer[i*COLS+j]))
+		}
+	}
+}
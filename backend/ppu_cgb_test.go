@@ -0,0 +1,149 @@
+package backend
+
+import (
+	"image/color"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const cgbAcidRomPath = "../rom/cgb-acid2.gbc"
+const outCgbAcid = "out/cgb-acid.png"
+const refCgbAcid = "ref/cgb-acid.png"
+
+func TestRunCgbAcid2(t *testing.T) {
+
+	// the cgb-acid2 rom and its reference image are not checked in, the test is skipped if they are missing
+	for _, path := range []string{cgbAcidRomPath, refCgbAcid} {
+		if _, err := os.Stat(path); err != nil {
+			t.Skipf("%s not available", path)
+		}
+	}
+
+	emulator := NewEmulator(WithRom(cgbAcidRomPath), WithDisableApu())
+
+	AssertNoAllocations(t, func() {
+		for i := 0; i < 100; i++ {
+			emulator.RunForAFrame()
+		}
+	})
+
+	ref := getImage(refCgbAcid)
+	if !assert.Equal(t, ref, emulator.GetImage()) {
+		emulator.dumpScreenToPng(outCgbAcid)
+	}
+}
+
+func writePaletteColor(c *CPU, spec, data uint16, palette, colorCode byte, rgb555 uint16) {
+	c.writeMemory(spec, palette*8+colorCode*2)
+	c.writeMemory(data, byte(rgb555))
+	c.writeMemory(spec, palette*8+colorCode*2+1)
+	c.writeMemory(data, byte(rgb555>>8))
+}
+
+var (
+	red   = color.RGBA{0xFF, 0, 0, 0xFF}
+	green = color.RGBA{0, 0xFF, 0, 0xFF}
+	blue  = color.RGBA{0, 0, 0xFF, 0xFF}
+)
+
+func setupCGBScene() *Emulator {
+	emulator := NewEmulator(withCGBTestRom(), WithDisableApu())
+	c := emulator.cpu
+
+	// tile 0 in bank 0 is filled with color 1, in bank 1 with color 2
+	for i := uint16(0); i < 16; i += 2 {
+		c.mmu.writeMemory(0x8000+i, 0xFF)
+	}
+	c.writeMemory(VBK, 1)
+	for i := uint16(0); i < 16; i += 2 {
+		c.mmu.writeMemory(0x8000+i+1, 0xFF)
+	}
+
+	// attributes: first tile uses palette 2 and tile bank 1, third tile has priority over sprites
+	c.mmu.writeMemory(0x9800, 0x02|attrBank)
+	c.mmu.writeMemory(0x9802, attrPriority)
+	c.writeMemory(VBK, 0)
+
+	writePaletteColor(c, BCPS, BCPD, 2, 2, 0x001F)
+	writePaletteColor(c, BCPS, BCPD, 0, 1, 0x03E0)
+	writePaletteColor(c, OCPS, OCPD, 3, 1, 0x7C00)
+
+	// sprite covering the third tile, using object palette 3
+	c.mmu.writeMemory(0xFE00, 16)
+	c.mmu.writeMemory(0xFE01, 8+16)
+	c.mmu.writeMemory(0xFE02, 0)
+	c.mmu.writeMemory(0xFE03, 3)
+
+	c.writeMemory(LCDC, 0x93)
+
+	return emulator
+}
+
+func TestCGBBackgroundAttributesAndPalettes(t *testing.T) {
+	emulator := setupCGBScene()
+
+	emulator.RunForAFrame()
+	emulator.RunForAFrame()
+
+	image := emulator.GetImage()
+	assert.Equal(t, red, image.RGBAAt(0, 0))
+	assert.Equal(t, red, image.RGBAAt(7, 7))
+	assert.Equal(t, green, image.RGBAAt(8, 0))
+
+	// background priority attribute wins over the sprite
+	assert.Equal(t, green, image.RGBAAt(16, 0))
+}
+
+func TestCGBMasterPriority(t *testing.T) {
+	emulator := setupCGBScene()
+
+	// clearing LCDC bit 0 puts sprites on top of everything
+	emulator.cpu.writeMemory(LCDC, 0x92)
+
+	emulator.RunForAFrame()
+	emulator.RunForAFrame()
+
+	image := emulator.GetImage()
+	assert.Equal(t, blue, image.RGBAAt(16, 0))
+
+	// the background is still displayed
+	assert.Equal(t, green, image.RGBAAt(8, 0))
+}
+
+func TestCGBSpriteAttributes(t *testing.T) {
+	emulator := setupCGBScene()
+	c := emulator.cpu
+
+	// move the sprite over the second tile and use the tile from bank 1 (color 2)
+	c.mmu.writeMemory(0xFE01, 8+8)
+	c.mmu.writeMemory(0xFE03, 3|attrBank)
+	writePaletteColor(c, OCPS, OCPD, 3, 2, 0x001F)
+
+	emulator.RunForAFrame()
+	emulator.RunForAFrame()
+
+	assert.Equal(t, red, emulator.GetImage().RGBAAt(8, 0))
+}
+
+func TestCGBPaletteAutoIncrement(t *testing.T) {
+	c := NewTestCGBCPU()
+
+	c.writeMemory(BCPS, 0x80|0x3E)
+	c.writeMemory(BCPD, 0x12)
+	c.writeMemory(BCPD, 0x34)
+	c.writeMemory(BCPD, 0x56)
+
+	assert.Equal(t, byte(0x12), c.mmu.bgPalette[0x3E])
+	assert.Equal(t, byte(0x34), c.mmu.bgPalette[0x3F])
+	assert.Equal(t, byte(0x56), c.mmu.bgPalette[0x00])
+	assert.Equal(t, byte(0xC1), c.readMemory(BCPS))
+
+	// no auto-increment
+	c.writeMemory(OCPS, 0x05)
+	c.writeMemory(OCPD, 0x12)
+	c.writeMemory(OCPD, 0x34)
+	assert.Equal(t, byte(0x34), c.readMemory(OCPD))
+	assert.Equal(t, byte(0x45), c.readMemory(OCPS))
+}
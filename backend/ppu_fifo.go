@@ -0,0 +1,397 @@
+package backend
+
+// pixel FIFO
+// during mode 3, the background fetcher fills the background FIFO 8 pixels at a time,
+// and one pixel is shifted out to the LCD per dot
+// the length of mode 3 depends on SCX, the window and the sprites on the line
+
+// background fetcher steps, each takes 2 dots except for the push which is retried every dot
+const (
+	fetchTileNumber = iota
+	fetchTileDataLow
+	fetchTileDataHigh
+	fetchPush
+
+	spriteFetchDots = 6
+)
+
+type bgPixel struct {
+	color      byte
+	attributes byte // CGB map attributes
+}
+
+type objPixel struct {
+	color    byte
+	flags    byte // OAM attributes
+	oamIndex byte
+}
+
+type bgFetcher struct {
+	step int
+	dots int
+
+	tileX      byte // next tile to fetch, relative to the start of the background or window
+	rowInTile  byte
+	tileNumber byte
+	attributes byte
+	dataLow    byte
+	dataHigh   byte
+
+	// the first fetch of each line is thrown away
+	discardFetch bool
+}
+
+type pixelFIFO struct {
+	bg    [8]bgPixel
+	bgLen int
+	bgPos int
+
+	// obj[i] is mixed with the i-th next pixel shifted out
+	obj [8]objPixel
+
+	fetcher bgFetcher
+
+	lx      int  // next pixel on the line
+	discard byte // pixels left to discard at the start of the line (SCX % 8)
+
+	window         bool // the fetcher is fetching the window
+	windowRendered bool // the window was displayed on this line
+	windowWrap     bool // the window started on the last pixel, it covers the whole next line
+
+	fetchingSprite  bool
+	spriteFetchDots int    // dots left until the sprite is fetched
+	sprite          int    // index in p.sprites of the sprite being fetched
+	spritesFetched  uint16 // bit i is set once p.sprites[i] was fetched
+}
+
+func (p *PPU) startPixelTransfer() {
+	p.searchOAM(p.line)
+
+	f := &p.fifo
+	*f = pixelFIFO{}
+	f.fetcher.discardFetch = true
+
+	_, scrollX := p.getScroll()
+	f.discard = scrollX % 8
+}
+
+// stepPixelTransfer advances mode 3 by one dot, it returns true once the whole line was drawn
+func (p *PPU) stepPixelTransfer() bool {
+	f := &p.fifo
+
+	p.checkWindowStart()
+
+	// the background fetcher keeps going while a sprite is fetched,
+	// but can't push pixels since no pixels are shifted out
+	p.stepFetcher()
+
+	if f.fetchingSprite || f.bgLen > 0 && f.discard == 0 && p.startSpriteFetch() {
+		f.spriteFetchDots--
+		if f.spriteFetchDots == 0 {
+			p.fetchSprite(f.sprite)
+			f.fetchingSprite = false
+		}
+		return false
+	}
+
+	if f.bgLen == 0 {
+		return false
+	}
+
+	p.shiftOutPixel()
+
+	return f.lx == COLS
+}
+
+func (p *PPU) checkWindowStart() {
+	f := &p.fifo
+	if !p.LCDCBitSet(windowDisplayEnable) {
+		if f.window {
+			p.stopWindow()
+		}
+		return
+	}
+
+	// the window isn't restarted if it was disabled then enabled again on the same line
+	if f.windowRendered || !p.windowYTriggered {
+		return
+	}
+
+	_, wx := p.getWindowPosition()
+	start := int(wx) - 7
+	if start > f.lx && !p.windowWrap {
+		return
+	}
+
+	// the window restarts the fetcher and replaces the rest of the line
+	f.window = true
+	f.windowRendered = true
+	f.bgLen = 0
+	f.discard = 0
+	f.fetcher = bgFetcher{}
+
+	if start < 0 && !p.windowWrap {
+		// WX < 7: the window starts at the beginning of the line, shifted to the left
+		f.discard = byte(-start)
+	}
+	f.windowWrap = start == COLS-1
+}
+
+// stopWindow switches back to the background when the window is disabled in the middle of a line
+func (p *PPU) stopWindow() {
+	f := &p.fifo
+	f.window = false
+
+	// the background tile covering the next pixel pushed into the FIFO
+	_, scrollX := p.getScroll()
+	next := f.lx + f.bgLen + int(scrollX%8)
+	f.fetcher = bgFetcher{tileX: byte(next / 8)}
+}
+
+func (p *PPU) stepFetcher() {
+	f := &p.fifo
+	fetcher := &f.fetcher
+
+	if fetcher.step == fetchPush {
+		if f.bgLen > 0 {
+			return
+		}
+
+		fetcher.step = fetchTileNumber
+		if !fetcher.discardFetch {
+			p.pushBackgroundPixels()
+			fetcher.tileX++
+			return
+		}
+
+		// nothing is pushed, the next fetch starts right away
+		fetcher.discardFetch = false
+	}
+
+	fetcher.dots++
+	if fetcher.dots < 2 {
+		return
+	}
+	fetcher.dots = 0
+
+	switch fetcher.step {
+	case fetchTileNumber:
+		p.fetchTileNumber()
+	case fetchTileDataLow:
+		fetcher.dataLow = p.fetchTileData(0)
+	case fetchTileDataHigh:
+		fetcher.dataHigh = p.fetchTileData(1)
+	}
+	fetcher.step++
+}
+
+func (p *PPU) fetchTileNumber() {
+	f := &p.fifo
+	fetcher := &f.fetcher
+
+	var tileMapDisplaySelect uint
+	var tileMap []byte
+	var x, y byte
+	if f.window {
+		tileMapDisplaySelect = windowTileMapDisplaySelect
+		tileMap = p.getWindowTileMap()
+		x = fetcher.tileX
+		y = byte(p.windowCounter)
+	} else {
+		tileMapDisplaySelect = bgTileMapDisplaySelect
+		tileMap = p.getBackgroundTileMap()
+		scrollY, scrollX := p.getScroll()
+		x = scrollX/8 + fetcher.tileX
+		y = scrollY + p.line
+	}
+
+	// the tile maps are 32 x 32 tiles
+	tileIndex := uint(y/8)*32 + uint(x%32)
+
+	fetcher.tileNumber = tileMap[tileIndex]
+	fetcher.rowInTile = y % 8
+	fetcher.attributes = 0
+	if p.cgb {
+		fetcher.attributes = p.getCGBTileMapAttributes(tileMapDisplaySelect)[tileIndex]
+	}
+}
+
+// fetchTileData reads the low (offset 0) or high (offset 1) byte of the current tile row
+func (p *PPU) fetchTileData(offset uint) byte {
+	fetcher := &p.fifo.fetcher
+
+	var tileData []byte
+	var interpretIndexAsSigned bool
+	if p.cgb {
+		tileData, interpretIndexAsSigned = p.getCGBTileData((fetcher.attributes & attrBank) >> 3)
+	} else {
+		tileData, interpretIndexAsSigned = p.getBackgroundTileData()
+	}
+
+	// if we are using 0x8000 to 0x8FFF
+	// then 0-127 maps to 8000-87FF and 128-255 maps to 8800-8FFF
+	//
+	// if we are using the 0x8800 to 0x97FF
+	// then 0-127 maps to 9000-97FF whereas 128-255 maps to 8800-8FFF
+	//
+	// we can just flip the MSB of the data index in the 0x8800 to 0x97FF case
+	tileNumber := fetcher.tileNumber
+	if interpretIndexAsSigned {
+		tileNumber ^= 0x80
+	}
+
+	rowInTile := fetcher.rowInTile
+	if fetcher.attributes&attrYFlip > 0 {
+		rowInTile = 7 - rowInTile
+	}
+
+	// 16 bytes per tile, 8 lines of 8 pixels per tiles
+	// meaning 2 bytes per line
+	return tileData[uint(tileNumber)*16+2*uint(rowInTile)+offset]
+}
+
+func (p *PPU) pushBackgroundPixels() {
+	f := &p.fifo
+	fetcher := &f.fetcher
+
+	low, high := fetcher.dataLow, fetcher.dataHigh
+	if fetcher.attributes&attrXFlip > 0 {
+		low, high = reverse(low), reverse(high)
+	}
+
+	for i := 0; i < 8; i++ {
+		msb := (high >> (7 - i)) & 1
+		lsb := (low >> (7 - i)) & 1
+		f.bg[i] = bgPixel{msb<<1 | lsb, fetcher.attributes}
+	}
+	f.bgLen = 8
+	f.bgPos = 0
+}
+
+// startSpriteFetch checks whether a sprite starts at the current pixel
+func (p *PPU) startSpriteFetch() bool {
+	f := &p.fifo
+	if !p.LCDCBitSet(objDisplayEnable) {
+		return false
+	}
+
+	for i := range p.sprites {
+		if f.spritesFetched&(1<<i) > 0 || int(p.sprites[i].xPos)-8 > f.lx {
+			continue
+		}
+
+		// the background fetcher has to finish fetching its current tile before the sprite is fetched
+		// the last dot of the background fetch overlaps with the sprite fetch
+		wait := (fetchPush-f.fetcher.step)*2 - f.fetcher.dots - 1
+		if wait < 0 {
+			wait = 0
+		}
+
+		f.spritesFetched |= 1 << i
+		f.fetchingSprite = true
+		f.spriteFetchDots = spriteFetchDots + wait
+		f.sprite = i
+		return true
+	}
+
+	return false
+}
+
+func (p *PPU) fetchSprite(index int) {
+	f := &p.fifo
+
+	s := p.sprites[index]
+	rowInTile := p.spriteRowInTile(&s, p.line, p.getSpriteHeight())
+
+	tileData := p.getSpriteData()
+	if p.cgb {
+		tileData = p.mmu.vram[(s.flags&attrBank)>>3]
+	}
+
+	lineDataIndex := uint(s.tileIndex)*16 + 2*uint(rowInTile)
+	lsbs := tileData[lineDataIndex]
+	msbs := tileData[lineDataIndex+1]
+	if s.xFlipped {
+		lsbs = reverse(lsbs)
+		msbs = reverse(msbs)
+	}
+
+	// in CGB mode, the sprite earliest in OAM wins unless the game asks for DMG style priority
+	// otherwise, the sprite fetched first (i.e. the leftmost one) wins
+	oamPriority := p.cgb && p.ram[OPRI]&1 == 0
+
+	for l := 0; l < 8; l++ {
+		slot := int(s.xPos) - 8 + l - f.lx
+		if slot < 0 {
+			continue
+		}
+
+		msb := (msbs >> (7 - l)) & 1
+		lsb := (lsbs >> (7 - l)) & 1
+		colorCode := (msb << 1) | lsb
+		if colorCode == 0 {
+			continue
+		}
+
+		current := f.obj[slot]
+		if current.color == 0 || oamPriority && byte(s.position) < current.oamIndex {
+			f.obj[slot] = objPixel{colorCode, s.flags, byte(s.position)}
+		}
+	}
+}
+
+func (p *PPU) shiftOutPixel() {
+	f := &p.fifo
+
+	bg := f.bg[f.bgPos]
+	f.bgPos++
+	f.bgLen--
+
+	if f.discard > 0 {
+		f.discard--
+		return
+	}
+
+	obj := f.obj[0]
+	copy(f.obj[:], f.obj[1:])
+	f.obj[7] = objPixel{}
+
+	if p.cgb {
+		p.colorBuffer[int(p.line)*COLS+f.lx] = p.mixCGBPixel(bg, obj)
+	} else {
+		p.screenBuffer[int(p.line)*COLS+f.lx] = p.mixPixel(bg, obj)
+	}
+	f.lx++
+}
+
+// mixPixel returns the shade of a DMG pixel
+func (p *PPU) mixPixel(bg bgPixel, obj objPixel) byte {
+	// the background and window are white when disabled
+	if !p.LCDCBitSet(bgDisplay) {
+		bg.color = 0
+	}
+
+	if obj.color > 0 && p.LCDCBitSet(objDisplayEnable) {
+		// sprites with priority set are behind background colors 1-3
+		if obj.flags&0x80 == 0 || bg.color == 0 {
+			return mapColorToPalette(p.getSpritePalette(obj.flags), obj.color)
+		}
+	}
+
+	return mapColorToPalette(p.getBGPalette(), bg.color)
+}
+
+// mixCGBPixel returns the RGB555 color of a CGB pixel
+func (p *PPU) mixCGBPixel(bg bgPixel, obj objPixel) uint16 {
+	if obj.color > 0 && p.LCDCBitSet(objDisplayEnable) {
+		// in CGB mode, LCDC bit 0 is the master priority: when cleared, sprites are always on top
+		backgroundWins := p.LCDCBitSet(bgDisplay) && bg.color > 0 &&
+			(bg.attributes&attrPriority > 0 || obj.flags&0x80 > 0)
+
+		if !backgroundWins {
+			return getCGBColor(&p.mmu.objPalette, obj.flags&attrPalette, obj.color)
+		}
+	}
+
+	return getCGBColor(&p.mmu.bgPalette, bg.attributes&attrPalette, bg.color)
+}
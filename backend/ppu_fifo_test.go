@@ -0,0 +1,93 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFIFOTestPPU() *PPU {
+	emulator := NewEmulator(WithNoRom(), WithDisableApu(), WithModel(ModelDMG))
+	p := emulator.ppu
+	p.ram[LCDC] = 1<<lcdDisplayEnable | 1<<bgWindowTileDataSelect | 1<<bgDisplay
+	// start from the first line, the emulator starts in VBlank
+	stepPPUTo(p, 0, 0)
+	return p
+}
+
+// mode3Length runs the first line of the frame and returns the length of mode 3 in dots
+func mode3Length(p *PPU) int {
+	p.Step(OAM_DOTS)
+
+	dots := 0
+	for {
+		p.Step(1)
+		dots++
+		if !p.pixelTransfer {
+			return dots
+		}
+	}
+}
+
+func TestMode3Length(t *testing.T) {
+	p := newFIFOTestPPU()
+	assert.Equal(t, 172, mode3Length(p))
+}
+
+func TestMode3LengthWithScrollX(t *testing.T) {
+	for scrollX := byte(0); scrollX < 16; scrollX++ {
+		p := newFIFOTestPPU()
+		p.ram[0xFF43] = scrollX
+		assert.Equal(t, 172+int(scrollX%8), mode3Length(p), "SCX=%d", scrollX)
+	}
+}
+
+func TestMode3LengthWithSprites(t *testing.T) {
+	addSprite := func(p *PPU, index int, x byte) {
+		p.ram[0xFE00+4*index] = 16
+		p.ram[0xFE00+4*index+1] = x
+	}
+
+	p := newFIFOTestPPU()
+	p.ram[LCDC] |= 1 << objDisplayEnable
+	addSprite(p, 0, 8)
+	assert.Equal(t, 172+11, mode3Length(p))
+
+	// the background fetcher is already done when the second sprite is fetched
+	p = newFIFOTestPPU()
+	p.ram[LCDC] |= 1 << objDisplayEnable
+	addSprite(p, 0, 8)
+	addSprite(p, 1, 8)
+	assert.Equal(t, 172+11+6, mode3Length(p))
+
+	// the penalty depends on where the sprite is relative to the background tiles
+	p = newFIFOTestPPU()
+	p.ram[LCDC] |= 1 << objDisplayEnable
+	addSprite(p, 0, 8+5)
+	assert.Equal(t, 172+6, mode3Length(p))
+
+	// sprites are not fetched when disabled
+	p = newFIFOTestPPU()
+	addSprite(p, 0, 8)
+	assert.Equal(t, 172, mode3Length(p))
+}
+
+func TestMode3LengthWithWindow(t *testing.T) {
+	p := newFIFOTestPPU()
+	p.ram[LCDC] |= 1 << windowDisplayEnable
+	p.ram[0xFF4B] = 7 + 80
+	assert.Equal(t, 172+6, mode3Length(p))
+}
+
+func TestMidScanlinePaletteChange(t *testing.T) {
+	p := newFIFOTestPPU()
+	p.ram[0xFF47] = 0x00
+
+	// change the palette halfway through the line
+	p.Step(OAM_DOTS + 12 + COLS/2)
+	p.ram[0xFF47] = 0x03
+	p.Step(DOTS_PER_LINE)
+
+	assert.Equal(t, byte(0), p.screenBuffer[0])
+	assert.Equal(t, byte(3), p.screenBuffer[COLS-1])
+}
@@ -1,89 +1,96 @@
 package backend
 
-import "fmt"
-
-func (p *PPU) interruptHBlankEnabled() bool {
-	return p.ram[0xFF41]&(1<<3) > 0
-}
+const (
+	STAT = 0xFF41
+	LY   = 0xFF44
+	LYC  = 0xFF45
+
+	statCoincidence      = 1 << 2
+	statHBlankInterrupt  = 1 << 3
+	statVBlankInterrupt  = 1 << 4
+	statOAMInterrupt     = 1 << 5
+	statLYCInterrupt     = 1 << 6
+	statInterruptSources = statHBlankInterrupt | statVBlankInterrupt | statOAMInterrupt | statLYCInterrupt
+)
 
-func (p *PPU) interruptVBlankEnabled() bool {
-	return p.ram[0xFF41]&(1<<4) > 0
+func (p *PPU) dispatchVBlankInterrupt() {
+	p.ram[0xFF0F] |= 1
 }
 
-func (p *PPU) interruptOAMEnabled() bool {
-	return p.ram[0xFF41]&(1<<5) > 0
+func (p *PPU) dispatchLCDStatInterrupt() {
+	p.ram[0xFF0F] |= 2
 }
 
-func (p *PPU) interruptLYCEnabled() bool {
-	return p.ram[0xFF41]&(1<<6) > 0
-}
+// statLine returns the state of the STAT interrupt line for the given value of STAT
+// all the enabled sources are ORed together
+func (p *PPU) statLine(stat byte) bool {
+	if !p.lcdOn {
+		return false
+	}
 
-func (p *PPU) writeLY(lineNumber byte) {
-	p.ram[0xFF44] = lineNumber
+	mode := stat & 0x3
+	// the OAM source also fires at the start of VBlank
+	oam := mode == 2 || p.line == ROWS && p.dot < 4
 
-	if p.coincidence() {
-		p.ram[0xFF41] |= 1 << 2
-		if p.interruptLYCEnabled() {
-			p.dispatchLCDStatInterrupt()
-		}
-	} else {
-		p.ram[0xFF41] &^= 1 << 2
-	}
+	return stat&statHBlankInterrupt > 0 && mode == 0 ||
+		stat&statVBlankInterrupt > 0 && mode == 1 ||
+		stat&statOAMInterrupt > 0 && oam ||
+		stat&statLYCInterrupt > 0 && stat&statCoincidence > 0
 }
 
-func (p *PPU) dispatchVBlankInterrupt() {
-	p.ram[0xFF0F] |= 1
+// setSTATLine requests the interrupt on the rising edge of the STAT line only
+// e.g. no HBlank interrupt is requested if the line is already high because of LY=LYC
+func (p *PPU) setSTATLine(line bool) {
+	if line && !p.irq {
+		p.dispatchLCDStatInterrupt()
+	}
+	p.irq = line
 }
 
-func (p *PPU) dispatchLCDStatInterrupt() {
-	p.ram[0xFF0F] |= 2
+func (p *PPU) updateSTATLine() {
+	p.setSTATLine(p.statLine(p.ram[STAT]))
 }
 
-func (p *PPU) coincidence() bool {
-	return p.ram[0xFF45] == p.ram[0xFF44]
+// compareLY sets the LY=LYC flag by comparing LYC with the given line
+// a negative line means that the comparator is not ready yet on this line, which clears the flag
+func (p *PPU) compareLY(line int) {
+	p.lyCompare = line
+	if line >= 0 && byte(line) == p.ram[LYC] {
+		p.ram[STAT] |= statCoincidence
+	} else {
+		p.ram[STAT] &^= statCoincidence
+	}
 }
 
-func (p *PPU) shouldRaiseSTATInterrupt(mode byte) bool {
-	return p.interruptHBlankEnabled() && mode == 0 ||
-		p.interruptVBlankEnabled() && mode == 1 ||
-		p.interruptOAMEnabled() && mode == 2 ||
-		p.interruptLYCEnabled() && p.coincidence()
+// writeRegister handles CPU writes to the LCD registers with an effect on the STAT line
+func (p *PPU) writeRegister(address uint16, value byte) {
+	switch address {
+	case STAT:
+		if p.mmu.model.isDMGFamily() {
+			// DMG bug: during the write, all the sources are briefly enabled
+			p.setSTATLine(p.statLine(statInterruptSources | p.ram[STAT]&0x7))
+		}
+		p.ram[STAT] = 0x80 | value&statInterruptSources | p.ram[STAT]&0x7
+		p.updateSTATLine()
+	case LYC:
+		p.ram[LYC] = value
+		if p.lcdOn {
+			p.compareLY(p.lyCompare)
+			p.updateSTATLine()
+		}
+	}
 }
 
-type ControllerMode int
+type ControllerMode byte
 
+// the values are the ones reported in the lower bits of STAT
 const (
-	HBlank = iota
+	HBlank ControllerMode = iota
 	VBlank
 	OAM
 	PixelTransfer
 )
 
-var modeStringToNumber = map[ControllerMode]byte{
-	HBlank: 0,
-	VBlank: 1,
-	OAM:    2,
-}
-
 func (p *PPU) setControllerMode(controllerMode ControllerMode) {
-
-	if mode, ok := modeStringToNumber[controllerMode]; ok {
-
-		irq := p.irq
-		p.irq = p.shouldRaiseSTATInterrupt(mode)
-
-		if !irq && p.irq {
-			p.dispatchLCDStatInterrupt()
-		}
-
-		p.ram[0xFF41] = 0x80 | p.ram[0xFF41]&0x7C | mode
-
-	} else {
-
-		if controllerMode != PixelTransfer {
-			panic(fmt.Sprintln("Got unexpected LCD controller mode: ", controllerMode))
-		} else {
-			p.ram[0xFF41] = 0x80 | p.ram[0xFF41]&0x7C | 3
-		}
-	}
+	p.ram[STAT] = 0x80 | p.ram[STAT]&0x7C | byte(controllerMode)
 }
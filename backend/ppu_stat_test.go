@@ -0,0 +1,159 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stepPPUTo runs the PPU until the given position in the frame, in the next frame if it is already past it
+func stepPPUTo(p *PPU, line, dot int) {
+	dots := line*DOTS_PER_LINE + dot - ppuPosition(p)
+	if dots < 0 {
+		dots += DOTS_PER_FRAME
+	}
+	p.Step(dots)
+}
+
+func TestLY153(t *testing.T) {
+	p := newFIFOTestPPU()
+	p.mmu.writeMemory(LYC, 153)
+
+	stepPPUTo(p, 153, 1)
+	assert.Equal(t, byte(153), p.mmu.readMemory(LY))
+	assert.Equal(t, byte(0), p.mmu.readMemory(STAT)&statCoincidence)
+
+	stepPPUTo(p, 153, 5)
+	assert.Equal(t, byte(0), p.mmu.readMemory(LY))
+	assert.Equal(t, byte(statCoincidence), p.mmu.readMemory(STAT)&statCoincidence)
+
+	// LYC=0 matches during line 153
+	p.mmu.writeMemory(LYC, 0)
+	stepPPUTo(p, 153, 13)
+	assert.Equal(t, byte(statCoincidence), p.mmu.readMemory(STAT)&statCoincidence)
+}
+
+func TestSTATInterruptBlocking(t *testing.T) {
+	p := newFIFOTestPPU()
+	p.mmu.writeMemory(LYC, 1)
+	p.mmu.writeMemory(STAT, statHBlankInterrupt|statLYCInterrupt)
+
+	stepPPUTo(p, 1, 5)
+	assert.Equal(t, byte(2), p.ram[0xFF0F]&2, "LY=LYC raises the interrupt")
+
+	// the line is still high because of LY=LYC when HBlank starts
+	p.ram[0xFF0F] = 0
+	stepPPUTo(p, 1, 400)
+	assert.Equal(t, byte(0), p.ram[0xFF0F]&2)
+
+	// but not on the next line
+	stepPPUTo(p, 2, 400)
+	assert.Equal(t, byte(2), p.ram[0xFF0F]&2)
+}
+
+func TestLYCWriteRaisesInterrupt(t *testing.T) {
+	p := newFIFOTestPPU()
+	p.mmu.writeMemory(STAT, statLYCInterrupt)
+	p.mmu.writeMemory(LYC, 10)
+
+	stepPPUTo(p, 5, 100)
+	p.ram[0xFF0F] = 0
+
+	p.mmu.writeMemory(LYC, 5)
+	assert.Equal(t, byte(2), p.ram[0xFF0F]&2)
+}
+
+func TestSTATWriteBug(t *testing.T) {
+	p := newFIFOTestPPU()
+	stepPPUTo(p, 5, 400)
+	p.ram[0xFF0F] = 0
+
+	// only on DMG, writing STAT during HBlank raises the interrupt
+	p.mmu.writeMemory(STAT, 0)
+	assert.Equal(t, byte(2), p.ram[0xFF0F]&2)
+	assert.Equal(t, byte(0x80), p.mmu.readMemory(STAT)&0xF8)
+
+	emulator := NewEmulator(withCGBTestRom(), WithDisableApu())
+	p = emulator.ppu
+	stepPPUTo(p, 5, 400)
+	p.ram[0xFF0F] = 0
+
+	p.mmu.writeMemory(STAT, 0)
+	assert.Equal(t, byte(0), p.ram[0xFF0F]&2)
+}
+
+func TestLCDOff(t *testing.T) {
+	p := newFIFOTestPPU()
+	stepPPUTo(p, 50, 100)
+
+	p.mmu.writeMemory(LCDC, p.ram[LCDC]&^(1<<lcdDisplayEnable))
+	p.Step(1)
+	assert.Equal(t, byte(0), p.mmu.readMemory(LY))
+	assert.Equal(t, byte(0), p.mmu.readMemory(STAT)&0x3)
+
+	// nothing happens while the LCD is off
+	p.Step(10 * DOTS_PER_LINE)
+	assert.Equal(t, byte(0), p.mmu.readMemory(LY))
+	assert.Equal(t, byte(0), p.mmu.readMemory(STAT)&0x3)
+
+	// the LCD starts from line 0, without an OAM scan on the first line
+	p.mmu.writeMemory(LCDC, p.ram[LCDC]|1<<lcdDisplayEnable)
+	p.Step(1)
+	assert.Equal(t, 1, ppuPosition(p))
+	assert.Equal(t, byte(0), p.mmu.readMemory(STAT)&0x3)
+
+	stepPPUTo(p, 0, OAM_DOTS+1)
+	assert.Equal(t, byte(3), p.mmu.readMemory(STAT)&0x3)
+
+	stepPPUTo(p, 1, 1)
+	assert.Equal(t, byte(2), p.mmu.readMemory(STAT)&0x3)
+}
+
+func TestBlankFrameAfterLCDOn(t *testing.T) {
+	p := newFIFOTestPPU()
+	// black background
+	p.ram[0xFF47] = 0xFF
+
+	p.ram[LCDC] &^= 1 << lcdDisplayEnable
+	p.Step(1)
+	p.ram[LCDC] |= 1 << lcdDisplayEnable
+	p.Step(1)
+
+	stepPPUTo(p, ROWS, 1)
+	assert.Equal(t, byte(0xFF), p.rawLastImage[0])
+
+	stepPPUTo(p, LINES_PER_FRAME, 0)
+	stepPPUTo(p, ROWS, 1)
+	assert.Equal(t, byte(0), p.rawLastImage[0])
+}
+
+func TestFrameEndsWhenLCDIsToggled(t *testing.T) {
+	// turns the LCD off and on in a loop, LY never reaches 153
+	rom := make([]byte, 1<<15)
+	copy(rom[0x100:], []byte{
+		0x3E, 0x11, // LD A, 0x11
+		0xE0, 0x40, // LDH (LCDC), A
+		0x3E, 0x91, // LD A, 0x91
+		0xE0, 0x40, // LDH (LCDC), A
+		0x18, 0xF6, // JR -10
+	})
+	emulator := NewEmulator(withMBC(NewMBC(rom)), WithDisableApu())
+	c := emulator.cpu
+	// the first frame only ends the VBlank the emulator starts in
+	emulator.RunForAFrame()
+
+	done := make(chan uint64)
+	go func() {
+		start := c.cycleCounter
+		emulator.RunForAFrame()
+		done <- c.cycleCounter - start
+	}()
+
+	select {
+	case cycles := <-done:
+		assert.InDelta(t, DOTS_PER_FRAME, cycles, 4)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the frame never ended")
+	}
+}
@@ -0,0 +1,186 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newWindowScene sets up a white background and a window made of 2 tiles
+// the tile rows alternate so that the window line counter is visible,
+// and each tile is split in 2 halves so that horizontal shifts are visible
+func newWindowScene() *PPU {
+	p := newFIFOTestPPU()
+	p.ram[LCDC] |= 1<<windowDisplayEnable | 1<<windowTileMapDisplaySelect
+	p.ram[0xFF47] = 0xE4
+
+	// tile 1: black | dark gray, tile 2: light gray | black
+	for i := 0; i < 16; i += 2 {
+		p.ram[0x8010+i], p.ram[0x8010+i+1] = 0xF0, 0xFF
+		p.ram[0x8020+i], p.ram[0x8020+i+1] = 0xFF, 0x0F
+	}
+
+	for i := 0; i < 32*32; i++ {
+		p.ram[0x9C00+i] = byte(1 + (i/32)%2)
+	}
+
+	return p
+}
+
+// windowScenePixel returns the shade of the window scene at the given window coordinates
+func windowScenePixel(x, y int) byte {
+	left := x%8 < 4
+	if (y/8)%2 == 0 {
+		// tile 1
+		if left {
+			return 3
+		}
+		return 2
+	}
+	// tile 2
+	if left {
+		return 1
+	}
+	return 3
+}
+
+// renderWindowScene renders a frame, calling update at the start of each line
+func renderWindowScene(p *PPU, update func(line int)) {
+	for line := 0; line < ROWS; line++ {
+		update(line)
+		stepPPUTo(p, line+1, 0)
+	}
+}
+
+// assertWindowLine checks the pixels of a screen line in [from, to)
+// the window line windowLine starts at the pixel start (negative when shifted to the left),
+// the pixels before it show the white background. A negative windowLine means the window isn't displayed
+func assertWindowLine(t *testing.T, p *PPU, line, from, to, windowLine, start int) {
+	for x := from; x < to; x++ {
+		expected := byte(0)
+		if windowLine >= 0 && x >= start {
+			expected = windowScenePixel(x-start, windowLine)
+		}
+		if !assert.Equal(t, expected, p.screenBuffer[line*COLS+x], "line %d, pixel %d", line, x) {
+			return
+		}
+	}
+}
+
+func TestWindowYLatch(t *testing.T) {
+	p := newWindowScene()
+	p.ram[WY] = 200
+	p.ram[WX] = 7 + 40
+
+	renderWindowScene(p, func(line int) {
+		switch line {
+		case 30:
+			// LY already went past WY, the window doesn't start
+			p.ram[WY] = 10
+		case 40:
+			p.ram[WY] = 50
+		case 70:
+			// the window stays visible after WY changes
+			p.ram[WY] = 0
+		}
+	})
+
+	for line := 0; line < ROWS; line++ {
+		windowLine := -1
+		if line >= 50 {
+			windowLine = line - 50
+		}
+		assertWindowLine(t, p, line, 0, COLS, windowLine, 40)
+	}
+	assert.Equal(t, ROWS-50, p.windowCounter)
+}
+
+func TestWindowToggle(t *testing.T) {
+	p := newWindowScene()
+	p.ram[WY] = 0
+	p.ram[WX] = 7
+
+	renderWindowScene(p, func(line int) {
+		switch line {
+		case 40:
+			// the window line counter doesn't advance while the window is disabled
+			p.ram[LCDC] &^= 1 << windowDisplayEnable
+		case 60:
+			p.ram[LCDC] |= 1 << windowDisplayEnable
+		case 100:
+			// the background is displayed again after disabling the window in the middle of a line
+			stepPPUTo(p, line, OAM_DOTS+12+80)
+			p.ram[LCDC] &^= 1 << windowDisplayEnable
+		case 101:
+			p.ram[LCDC] |= 1 << windowDisplayEnable
+		}
+	})
+
+	for line := 0; line < ROWS; line++ {
+		switch {
+		case line < 40:
+			assertWindowLine(t, p, line, 0, COLS, line, 0)
+		case line < 60:
+			assertWindowLine(t, p, line, 0, COLS, -1, 0)
+		case line == 100:
+			// the pixels around the write depend on the FIFO timing
+			assertWindowLine(t, p, line, 0, 64, line-20, 0)
+			assertWindowLine(t, p, line, 96, COLS, -1, 0)
+		default:
+			// the line where the window was disabled mid line still counts
+			assertWindowLine(t, p, line, 0, COLS, line-20, 0)
+		}
+	}
+	assert.Equal(t, ROWS-20, p.windowCounter)
+}
+
+func TestWindowXEdgeCases(t *testing.T) {
+	p := newWindowScene()
+	p.ram[WY] = 0
+
+	renderWindowScene(p, func(line int) {
+		switch line {
+		case 0:
+			p.ram[WX] = 0
+		case 24:
+			// the window is shifted to the left
+			p.ram[WX] = 3
+		case 48:
+			p.ram[WX] = 6
+		case 72:
+			p.ram[WX] = 7 + 152
+		case 96:
+			// the window starts on the last pixel and covers the next line
+			p.ram[WX] = 166
+		case 97:
+			p.ram[WX] = 7 + 152
+		case 120:
+			// off screen
+			p.ram[WX] = 167
+		}
+	})
+
+	for line := 0; line < ROWS; line++ {
+		switch {
+		case line < 24:
+			assertWindowLine(t, p, line, 0, COLS, line, -7)
+		case line < 48:
+			assertWindowLine(t, p, line, 0, COLS, line, -4)
+		case line < 72:
+			assertWindowLine(t, p, line, 0, COLS, line, -1)
+		case line < 96:
+			assertWindowLine(t, p, line, 0, COLS, line, 152)
+		case line == 96:
+			assertWindowLine(t, p, line, 0, COLS, line, COLS-1)
+		case line == 97:
+			assertWindowLine(t, p, line, 0, COLS, line, 0)
+		case line < 120:
+			assertWindowLine(t, p, line, 0, COLS, line, 152)
+		default:
+			assertWindowLine(t, p, line, 0, COLS, -1, 0)
+		}
+	}
+
+	// the window was displayed on every line but the last 24
+	assert.Equal(t, ROWS-24, p.windowCounter)
+}
@@ -0,0 +1,64 @@
+package backend
+
+import "fmt"
+
+// ROMRAM is a cartridge without MBC, with up to 8KB of RAM which is always enabled
+type ROMRAM struct {
+	Rom []byte
+	Ram []byte
+
+	HasBattery bool
+}
+
+func NewROMRAM(rom []byte, header CartridgeHeader, useBattery bool) *ROMRAM {
+	m := new(ROMRAM)
+
+	// without MBC only 32KB can be mapped, an overdumped rom is truncated
+	m.Rom = fitROM(rom, header)[:1<<15]
+
+	ramSize := header.RAMSize()
+	if ramSize > 0x2000 {
+		panic(fmt.Sprintf("Cartridge has no MBC but header says it has %d bytes of RAM, more than 8KB can't be mapped", ramSize))
+	}
+	m.Ram = make([]byte, ramSize)
+
+	m.HasBattery = useBattery
+
+	return m
+}
+
+func (m *ROMRAM) ReadMemory(address uint16) byte {
+	if address < 0x8000 {
+		return m.Rom[address]
+	} else if 0xA000 <= address && address < 0xC000 {
+		if len(m.Ram) > 0 {
+			return m.Ram[int(address-0xA000)%len(m.Ram)]
+		}
+		return 0xFF
+	}
+	panic(fmt.Sprintf("Got unexpected read address not handled by MBC %d", address))
+}
+
+func (m *ROMRAM) WriteMemory(address uint16, value byte) {
+	if address < 0x8000 {
+
+		// no registers
+
+	} else if 0xA000 <= address && address < 0xC000 {
+
+		if len(m.Ram) > 0 {
+			m.Ram[int(address-0xA000)%len(m.Ram)] = value
+		}
+
+	} else {
+		panic(fmt.Sprintf("Got unexpected write address not handled by MBC %d", address))
+	}
+}
+
+func (m *ROMRAM) batteryRAM() []byte {
+	// nothing to save without RAM
+	if !m.HasBattery || len(m.Ram) == 0 {
+		return nil
+	}
+	return m.Ram
+}
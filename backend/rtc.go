@@ -0,0 +1,207 @@
+package backend
+
+import "time"
+
+// MBC3 real time clock registers, selected by writing 0x08-0x0C to the RAM bank register
+const (
+	rtcSeconds = iota
+	rtcMinutes
+	rtcHours
+	rtcDaysLow
+	rtcDaysHigh // bit 0: bit 8 of the day counter, bit 6: halt, bit 7: day counter carry
+
+	rtcHalt  = 1 << 6
+	rtcCarry = 1 << 7
+
+	// the clock runs off its own 32768 Hz crystal, it is not affected by the CPU speed
+	rtcDotsPerSecond = 1 << 22
+)
+
+// bits of each register which are actually stored
+var rtcMasks = [5]byte{0x3F, 0x3F, 0x1F, 0xFF, 0xC1}
+
+// timeNow is replaced in tests
+var timeNow = time.Now
+
+// cartridgeClock is a real time clock inside the cartridge
+type cartridgeClock interface {
+	// tick advances the clock by the given number of dots, at 4194304 Hz whatever the CPU speed
+	tick(dots int)
+	setHostClock(hostClock bool)
+	// save records the time at which the clock state is saved
+	save(now time.Time)
+	// load applies the time elapsed since the clock state was saved
+	load(now time.Time)
+}
+
+// clockedMBC is implemented by the MBCs which can have a real time clock
+type clockedMBC interface {
+	getClock() cartridgeClock // nil if the cartridge has no clock
+}
+
+func getCartridgeClock(mbc MBC) cartridgeClock {
+	if c, ok := mbc.(clockedMBC); ok {
+		return c.getClock()
+	}
+	return nil
+}
+
+// RTC is the clock of the MBC3
+// it either counts emulated cycles, or follows the host clock so that it keeps time
+// when the emulator doesn't run at full speed
+type RTC struct {
+	Registers [5]byte
+	Latched   [5]byte // what the game reads, updated when 0 then 1 is written to 0x6000-0x7FFF
+
+	LatchRegister byte // last value written to 0x6000-0x7FFF
+
+	Dots int // dots since the last second when counting emulated cycles
+
+	HostClock bool
+	Timestamp int64 // unix time at which Registers were last brought up to date
+}
+
+func NewRTC() *RTC {
+	r := new(RTC)
+	r.Timestamp = timeNow().Unix()
+	return r
+}
+
+func (r *RTC) halted() bool {
+	return r.Registers[rtcDaysHigh]&rtcHalt > 0
+}
+
+func (r *RTC) days() int {
+	return int(r.Registers[rtcDaysHigh]&1)<<8 | int(r.Registers[rtcDaysLow])
+}
+
+func (r *RTC) setDays(days int) {
+	r.Registers[rtcDaysLow] = byte(days)
+	r.Registers[rtcDaysHigh] = r.Registers[rtcDaysHigh]&^1 | byte(days>>8)&1
+}
+
+func (r *RTC) tick(dots int) {
+	if r.HostClock || r.halted() {
+		return
+	}
+
+	r.Dots += dots
+	for r.Dots >= rtcDotsPerSecond {
+		r.Dots -= rtcDotsPerSecond
+		r.advanceSecond()
+	}
+}
+
+func (r *RTC) setHostClock(hostClock bool) {
+	// the registers are up to date, the host clock takes over from now
+	r.Timestamp = timeNow().Unix()
+	r.HostClock = hostClock
+}
+
+func (r *RTC) save(now time.Time) {
+	if r.HostClock {
+		r.sync(now)
+	} else {
+		r.Timestamp = now.Unix()
+	}
+}
+
+func (r *RTC) load(now time.Time) {
+	r.sync(now)
+}
+
+// sync applies the whole seconds elapsed since Timestamp
+func (r *RTC) sync(now time.Time) {
+	elapsed := now.Unix() - r.Timestamp
+	if r.halted() || elapsed < 0 {
+		r.Timestamp = now.Unix()
+		return
+	}
+
+	r.Timestamp += elapsed
+	r.advance(elapsed)
+}
+
+// advanceSecond increments the registers like the hardware does
+// out of range values keep counting until the register overflows, without carrying into the next one
+func (r *RTC) advanceSecond() {
+	r.Registers[rtcSeconds] = (r.Registers[rtcSeconds] + 1) & rtcMasks[rtcSeconds]
+	if r.Registers[rtcSeconds] != 60 {
+		return
+	}
+	r.Registers[rtcSeconds] = 0
+
+	r.Registers[rtcMinutes] = (r.Registers[rtcMinutes] + 1) & rtcMasks[rtcMinutes]
+	if r.Registers[rtcMinutes] != 60 {
+		return
+	}
+	r.Registers[rtcMinutes] = 0
+
+	r.Registers[rtcHours] = (r.Registers[rtcHours] + 1) & rtcMasks[rtcHours]
+	if r.Registers[rtcHours] != 24 {
+		return
+	}
+	r.Registers[rtcHours] = 0
+
+	days := r.days() + 1
+	if days == 512 {
+		days = 0
+		r.Registers[rtcDaysHigh] |= rtcCarry
+	}
+	r.setDays(days)
+}
+
+func (r *RTC) inRange() bool {
+	return r.Registers[rtcSeconds] < 60 && r.Registers[rtcMinutes] < 60 && r.Registers[rtcHours] < 24
+}
+
+// advance adds a number of seconds, which may be large after loading a save
+func (r *RTC) advance(seconds int64) {
+	for ; seconds > 0 && !r.inRange(); seconds-- {
+		r.advanceSecond()
+	}
+	if seconds == 0 {
+		return
+	}
+
+	total := seconds + int64(r.Registers[rtcSeconds]) + 60*int64(r.Registers[rtcMinutes]) +
+		3600*int64(r.Registers[rtcHours]) + 86400*int64(r.days())
+
+	days := total / 86400
+	if days >= 512 {
+		r.Registers[rtcDaysHigh] |= rtcCarry
+		days %= 512
+	}
+	r.setDays(int(days))
+	r.Registers[rtcHours] = byte(total / 3600 % 24)
+	r.Registers[rtcMinutes] = byte(total / 60 % 60)
+	r.Registers[rtcSeconds] = byte(total % 60)
+}
+
+func (r *RTC) latch(value byte) {
+	if r.LatchRegister == 0 && value == 1 {
+		if r.HostClock {
+			r.sync(timeNow())
+		}
+		r.Latched = r.Registers
+	}
+	r.LatchRegister = value
+}
+
+func (r *RTC) read(register byte) byte {
+	return r.Latched[register]
+}
+
+func (r *RTC) write(register byte, value byte) {
+	if r.HostClock {
+		r.sync(timeNow())
+	}
+
+	// writing the seconds resets the sub-second counter
+	if register == rtcSeconds {
+		r.Dots = 0
+		r.Timestamp = timeNow().Unix()
+	}
+
+	r.Registers[register] = value & rtcMasks[register]
+}
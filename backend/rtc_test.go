@@ -0,0 +1,183 @@
+package backend
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRTCMBC() *MBC3 {
+	rom := makeRom()
+	rom[0x147] = 0x10
+	mbc := NewMBC(rom).(*MBC3)
+	mbc.WriteMemory(0x0000, 0x0A)
+	return mbc
+}
+
+func latchRTC(mbc *MBC3) {
+	mbc.WriteMemory(0x6000, 0)
+	mbc.WriteMemory(0x6000, 1)
+}
+
+func readRTC(mbc *MBC3, register byte) byte {
+	mbc.WriteMemory(0x4000, 0x08+register)
+	return mbc.ReadMemory(0xA000)
+}
+
+func writeRTC(mbc *MBC3, register byte, value byte) {
+	mbc.WriteMemory(0x4000, 0x08+register)
+	mbc.WriteMemory(0xA000, value)
+}
+
+// setTestTime makes timeNow return the returned pointer's value until the test ends
+func setTestTime(t *testing.T) *time.Time {
+	now := time.Unix(1_000_000, 0)
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = time.Now })
+	return &now
+}
+
+func TestRTCLatch(t *testing.T) {
+	mbc := newTestRTCMBC()
+	writeRTC(mbc, rtcMinutes, 5)
+
+	// the registers read the latched values
+	assert.Equal(t, byte(0), readRTC(mbc, rtcMinutes))
+	latchRTC(mbc)
+	assert.Equal(t, byte(5), readRTC(mbc, rtcMinutes))
+
+	mbc.Rtc.tick(rtcDotsPerSecond * 3)
+	assert.Equal(t, byte(0), readRTC(mbc, rtcSeconds))
+
+	// only a 0 then 1 write sequence latches the clock
+	mbc.WriteMemory(0x6000, 1)
+	assert.Equal(t, byte(0), readRTC(mbc, rtcSeconds))
+	latchRTC(mbc)
+	assert.Equal(t, byte(3), readRTC(mbc, rtcSeconds))
+
+	// RAM is still accessible
+	mbc.WriteMemory(0x4000, 0)
+	mbc.WriteMemory(0xA000, 0x42)
+	assert.Equal(t, byte(0x42), mbc.ReadMemory(0xA000))
+}
+
+func TestRTCCounting(t *testing.T) {
+	mbc := newTestRTCMBC()
+	writeRTC(mbc, rtcSeconds, 59)
+	writeRTC(mbc, rtcMinutes, 59)
+	writeRTC(mbc, rtcHours, 23)
+	writeRTC(mbc, rtcDaysLow, 0xFF)
+	writeRTC(mbc, rtcDaysHigh, 0)
+
+	mbc.Rtc.tick(rtcDotsPerSecond)
+	latchRTC(mbc)
+	assert.Equal(t, []byte{0, 0, 0, 0, 1}, []byte{
+		readRTC(mbc, rtcSeconds), readRTC(mbc, rtcMinutes), readRTC(mbc, rtcHours),
+		readRTC(mbc, rtcDaysLow), readRTC(mbc, rtcDaysHigh),
+	})
+
+	// the day counter overflows into the carry bit, which stays set
+	writeRTC(mbc, rtcDaysLow, 0xFF)
+	writeRTC(mbc, rtcHours, 23)
+	writeRTC(mbc, rtcMinutes, 59)
+	writeRTC(mbc, rtcSeconds, 59)
+	mbc.Rtc.tick(rtcDotsPerSecond)
+	latchRTC(mbc)
+	assert.Equal(t, byte(0), readRTC(mbc, rtcDaysLow))
+	assert.Equal(t, byte(rtcCarry), readRTC(mbc, rtcDaysHigh))
+
+	// out of range values overflow without incrementing the next register
+	writeRTC(mbc, rtcSeconds, 63)
+	mbc.Rtc.tick(rtcDotsPerSecond)
+	latchRTC(mbc)
+	assert.Equal(t, byte(0), readRTC(mbc, rtcSeconds))
+	assert.Equal(t, byte(0), readRTC(mbc, rtcMinutes))
+
+	// the unused bits aren't stored
+	writeRTC(mbc, rtcHours, 0xFF)
+	latchRTC(mbc)
+	assert.Equal(t, byte(0x1F), readRTC(mbc, rtcHours))
+}
+
+func TestRTCHalt(t *testing.T) {
+	mbc := newTestRTCMBC()
+	writeRTC(mbc, rtcDaysHigh, rtcHalt)
+
+	mbc.Rtc.tick(rtcDotsPerSecond * 10)
+	latchRTC(mbc)
+	assert.Equal(t, byte(0), readRTC(mbc, rtcSeconds))
+
+	writeRTC(mbc, rtcDaysHigh, 0)
+	mbc.Rtc.tick(rtcDotsPerSecond * 10)
+	latchRTC(mbc)
+	assert.Equal(t, byte(10), readRTC(mbc, rtcSeconds))
+}
+
+func TestRTCTicksFromCPU(t *testing.T) {
+	emulator := NewEmulator(withMBC(NewMBC(makeBankedRom(0x0F, 1, 0))), WithDisableApu())
+	rtc := emulator.mbc.(*MBC3).Rtc
+
+	// the first frame only ends the VBlank the emulator starts in
+	emulator.RunForAFrame()
+	for i := 0; i < 60; i++ {
+		emulator.RunForAFrame()
+	}
+	assert.Equal(t, byte(1), rtc.Registers[rtcSeconds])
+}
+
+func TestRTCHostClock(t *testing.T) {
+	now := setTestTime(t)
+
+	mbc := newTestRTCMBC()
+	mbc.Rtc.setHostClock(true)
+
+	// emulated cycles are ignored
+	mbc.Rtc.tick(rtcDotsPerSecond * 10)
+	*now = now.Add(90 * time.Second)
+	latchRTC(mbc)
+	assert.Equal(t, byte(30), readRTC(mbc, rtcSeconds))
+	assert.Equal(t, byte(1), readRTC(mbc, rtcMinutes))
+
+	// the clock doesn't run while halted
+	writeRTC(mbc, rtcDaysHigh, rtcHalt)
+	*now = now.Add(time.Hour)
+	writeRTC(mbc, rtcDaysHigh, 0)
+	*now = now.Add(time.Second)
+	latchRTC(mbc)
+	assert.Equal(t, byte(31), readRTC(mbc, rtcSeconds))
+	assert.Equal(t, byte(1), readRTC(mbc, rtcMinutes))
+}
+
+func TestRTCElapsedTimeOnLoad(t *testing.T) {
+	now := setTestTime(t)
+
+	mbc := newTestRTCMBC()
+	mbc.Rtc.tick(rtcDotsPerSecond * 5)
+	mbc.Rtc.save(*now)
+
+	d, err := json.Marshal(MbcWrapper{mbc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out MbcWrapper
+	if err := json.Unmarshal(d, &out); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, mbc, out.mbc)
+
+	// the game is loaded again 2 days, 3 hours and 4 minutes later
+	loaded := out.mbc.(*MBC3)
+	loaded.Rtc.load(now.Add(((2*24+3)*60 + 4) * time.Minute))
+	latchRTC(loaded)
+	assert.Equal(t, byte(5), readRTC(loaded, rtcSeconds))
+	assert.Equal(t, byte(4), readRTC(loaded, rtcMinutes))
+	assert.Equal(t, byte(3), readRTC(loaded, rtcHours))
+	assert.Equal(t, byte(2), readRTC(loaded, rtcDaysLow))
+
+	// more than 511 days
+	loaded.Rtc.load(now.Add(600 * 24 * time.Hour))
+	latchRTC(loaded)
+	assert.Equal(t, byte(rtcCarry), readRTC(loaded, rtcDaysHigh)&rtcCarry)
+}
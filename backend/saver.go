@@ -68,7 +68,19 @@ func LoadSave(romPath string) *Emulator {
 	cpuState := state.Cpu
 
 	apu := NewAPU(cpuState.Ram)
-	mmu := NewMMU(cpuState.Ram, cpuState.Mbc.mbc, logger, apu.AudioRegisterWriteCallback)
+	mmu := NewMMU(cpuState.Ram, cpuState.Model, cpuState.Cgb, cpuState.Mbc.mbc, logger, apu.AudioRegisterWriteCallback)
+	if mmu.clock != nil {
+		// the clock keeps running while the emulator is closed
+		mmu.clock.load(timeNow())
+	}
+	if cpuState.Cgb {
+		copy(mmu.vram[1], cpuState.Vram)
+		for i, bank := range cpuState.Wram {
+			copy(mmu.wram[i+2], bank)
+		}
+		mmu.bgPalette = cpuState.BgPalette
+		mmu.objPalette = cpuState.ObjPalette
+	}
 
 	cpu := new(CPU)
 	cpu.reg = cpuState.Reg
@@ -77,12 +89,26 @@ func LoadSave(romPath string) *Emulator {
 	cpu.IME = cpuState.IME
 	cpu.haltMode = cpuState.HaltMode
 	cpu.cycleCounter = cpuState.CycleCounter
+	mmu.timer.counter = cpuState.TimerCounter
 	cpu.apu = apu
 	cpu.mmu = mmu
 
-	ppu := NewPPU(cpuState.Ram, cpu.RunSync)
-
-	return &Emulator{ppu, cpu, cpuState.Mbc.mbc, mmu, apu, true, logger, false}
+	ppu := NewPPU(mmu, cpu.Step)
+	cpu.ppu = ppu
+
+	mmu.bootRom = cpuState.BootRom
+
+	return &Emulator{
+		ppu:       ppu,
+		cpu:       cpu,
+		mbc:       cpuState.Mbc.mbc,
+		mmu:       mmu,
+		apu:       apu,
+		enableApu: true,
+		logger:    logger,
+		bootRom:   cpuState.BootRom,
+		model:     cpuState.Model,
+	}
 }
 
 type CPUState struct {
@@ -94,8 +120,20 @@ type CPUState struct {
 
 	Mbc MbcWrapper // memory bank controller
 
+	Model Model // hardware model being emulated
+
+	Cgb  bool     // whether the CGB hardware mode is used
+	Vram []byte   // CGB VRAM bank 1
+	Wram [][]byte // CGB WRAM banks 2-7
+
+	BgPalette  [64]byte // CGB palette RAM
+	ObjPalette [64]byte
+
+	BootRom []byte // only set if the boot rom is still mapped
+
 	HaltMode     byte
 	CycleCounter uint64
+	TimerCounter uint16 // system counter, DIV is its upper byte
 }
 
 type EmulatorState struct {
@@ -111,6 +149,10 @@ func DumpEmulatorState(romPath string, emu *Emulator) {
 	c := emu.cpu
 	m := emu.mmu
 
+	if m.clock != nil {
+		m.clock.save(timeNow())
+	}
+
 	cpuState := CPUState{}
 	cpuState.Reg = c.reg
 	cpuState.SP = c.SP
@@ -118,8 +160,18 @@ func DumpEmulatorState(romPath string, emu *Emulator) {
 	cpuState.Ram = m.ram
 	cpuState.IME = c.IME
 	cpuState.Mbc = MbcWrapper{m.mbc}
+	cpuState.Model = m.model
+	if m.cgb {
+		cpuState.Cgb = true
+		cpuState.Vram = m.vram[1]
+		cpuState.Wram = m.wram[2:]
+		cpuState.BgPalette = m.bgPalette
+		cpuState.ObjPalette = m.objPalette
+	}
+	cpuState.BootRom = m.bootRom
 	cpuState.HaltMode = c.haltMode
 	cpuState.CycleCounter = c.cycleCounter
+	cpuState.TimerCounter = c.mmu.timer.counter
 
 	state := EmulatorState{cpuState}
 
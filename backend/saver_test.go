@@ -32,3 +32,26 @@ func TestSaveEmulatorState(t *testing.T) {
 		emulator.dumpScreenToPng("out/blargg.png")
 	}
 }
+
+func TestSaveEmulatorStateRecordsModel(t *testing.T) {
+	emulator := NewEmulator(WithRom(blargg), WithModel(ModelMGB), WithDisableApu())
+
+	DumpEmulatorState(blargg, emulator)
+
+	emulator = LoadSave(blargg)
+	assert.Equal(t, ModelMGB, emulator.GetModel())
+	assert.Equal(t, ModelMGB, emulator.mmu.model)
+	assert.False(t, emulator.mmu.cgb)
+}
+
+func TestLoadSaveKeepsLY(t *testing.T) {
+	emulator := NewEmulator(WithRom(blargg), WithDisableApu())
+	stepPPUTo(emulator.ppu, 10, 0)
+	ly := emulator.mmu.ram[LY]
+
+	DumpEmulatorState(blargg, emulator)
+
+	// the power up PPU position only applies to a new emulator
+	emulator = LoadSave(blargg)
+	assert.Equal(t, ly, emulator.mmu.ram[LY])
+}
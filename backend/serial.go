@@ -0,0 +1,162 @@
+package backend
+
+const (
+	SB = 0xFF01 // serial transfer data
+	SC = 0xFF02 // serial transfer control
+
+	scTransfer      = 0x80 // transfer requested or in progress
+	scFastClock     = 0x02 // CGB only: use the fast internal clock
+	scInternalClock = 0x01
+
+	serialInterrupt = 0x8
+)
+
+// SerialPeer is the device at the other end of the link cable
+type SerialPeer interface {
+	// Transfer is called by the side driving the clock once a byte has been shifted out
+	// it returns the byte shifted in from the peer, 0xFF if nothing is connected
+	Transfer(out byte) byte
+}
+
+// SerialClockSource is implemented by peers which can drive the clock of this side of the link
+// e.g. an emulator in another process, see TCPLink
+type SerialClockSource interface {
+	// ReceiveTransfer returns the byte sent by the peer, if it started a transfer
+	// if wait is set, it can pause the emulator for a while until the peer starts one
+	ReceiveTransfer(wait bool) (byte, bool)
+	// CompleteTransfer sends the byte shifted out in exchange to the peer
+	CompleteTransfer(out byte)
+}
+
+// Serial implements the link port
+// the register values are kept in ram
+type Serial struct {
+	ram []byte
+	cgb bool
+
+	peer        SerialPeer
+	clockSource SerialClockSource // set if the peer implements it
+
+	bits   int  // number of bits shifted so far in the current transfer
+	clock  bool // last value of the system counter bit driving the internal clock
+	waited bool // whether the emulator already paused for the peer to start the current transfer
+}
+
+func NewSerial(ram []byte, cgb bool, peer SerialPeer) *Serial {
+	s := new(Serial)
+	s.ram = ram
+	s.cgb = cgb
+	s.setPeer(peer)
+	return s
+}
+
+func (s *Serial) setPeer(peer SerialPeer) {
+	s.peer = peer
+	s.clockSource, _ = peer.(SerialClockSource)
+}
+
+func (s *Serial) unusedControlBits() byte {
+	if s.cgb {
+		return 0x7C
+	}
+	return 0x7E
+}
+
+func (s *Serial) writeRegister(address uint16, value byte) {
+	switch address {
+	case SB:
+		s.ram[SB] = value
+	case SC:
+		s.ram[SC] = value | s.unusedControlBits()
+		s.bits = 0
+		s.waited = false
+	}
+}
+
+func (s *Serial) isTransferring() bool {
+	return s.ram[SC]&scTransfer > 0
+}
+
+// internal clock: 8192Hz, or 262144Hz in CGB fast mode (both twice as fast in double speed mode)
+// a bit is shifted on each falling edge of the corresponding system counter bit
+func (s *Serial) clockSignal(counter uint16) bool {
+	if s.cgb && s.ram[SC]&scFastClock > 0 {
+		return counter&(1<<3) > 0
+	}
+	return counter&(1<<8) > 0
+}
+
+// Tick is called every M-cycle with the system counter (see Timer)
+func (s *Serial) Tick(counter uint16) {
+	if s.clockSource != nil {
+		s.receiveTransfer()
+	}
+
+	clock := s.clockSignal(counter)
+	fallingEdge := s.clock && !clock
+	s.clock = clock
+
+	if !fallingEdge || !s.isTransferring() || s.ram[SC]&scInternalClock == 0 {
+		return
+	}
+
+	s.bits++
+	if s.bits < 8 {
+		return
+	}
+
+	s.completeTransfer(s.peer.Transfer(s.ram[SB]))
+}
+
+func (s *Serial) completeTransfer(in byte) {
+	s.ram[SB] = in
+	s.ram[SC] &^= scTransfer
+	s.bits = 0
+	s.ram[0xFF0F] |= serialInterrupt
+}
+
+// receiveTransfer exchanges a byte with a peer driving the clock
+// while this side waits for a transfer using the external clock, the emulator can be paused to absorb latency
+func (s *Serial) receiveTransfer() {
+	ready := s.isTransferring() && s.ram[SC]&scInternalClock == 0
+
+	in, ok := s.clockSource.ReceiveTransfer(ready && !s.waited)
+	if ready {
+		s.waited = true
+	}
+	if !ok {
+		return
+	}
+
+	if !ready {
+		// not listening, the peer reads the line as high
+		s.clockSource.CompleteTransfer(0xFF)
+		return
+	}
+
+	out := s.ram[SB]
+	s.completeTransfer(in)
+	s.clockSource.CompleteTransfer(out)
+}
+
+// Transfer implements SerialPeer, for a peer driving the clock
+// the byte is only exchanged if a transfer using the external clock was requested
+func (s *Serial) Transfer(in byte) byte {
+	if !s.isTransferring() || s.ram[SC]&scInternalClock > 0 {
+		return 0xFF
+	}
+
+	out := s.ram[SB]
+	s.completeTransfer(in)
+	return out
+}
+
+// loggerSerialPeer logs the bytes sent over the link cable, used by test roms to print their results
+type loggerSerialPeer struct {
+	logger Logger
+}
+
+func (p loggerSerialPeer) Transfer(out byte) byte {
+	p.logger.Log(string(out))
+	return 0xFF
+}
@@ -0,0 +1,126 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingSerialPeer struct {
+	sent []byte
+	in   byte
+}
+
+func (p *recordingSerialPeer) Transfer(out byte) byte {
+	p.sent = append(p.sent, out)
+	return p.in
+}
+
+func runSerialMCycles(s *Serial, counter *uint16, cycles int) {
+	for i := 0; i < cycles; i++ {
+		*counter += 4
+		s.Tick(*counter)
+	}
+}
+
+func TestSerialInternalClockTransfer(t *testing.T) {
+	ram := make([]byte, 1<<16)
+	peer := &recordingSerialPeer{in: 0x5A}
+	s := NewSerial(ram, false, peer)
+
+	counter := uint16(0)
+	s.writeRegister(SB, 0x42)
+	s.writeRegister(SC, 0x81)
+	assert.Equal(t, byte(0xFF), ram[SC])
+
+	// 8 bits at 8192Hz take 4096 cycles
+	runSerialMCycles(s, &counter, 1023)
+	assert.Empty(t, peer.sent)
+	assert.Equal(t, byte(0), ram[0xFF0F])
+
+	runSerialMCycles(s, &counter, 1)
+	assert.Equal(t, []byte{0x42}, peer.sent)
+	assert.Equal(t, byte(0x5A), ram[SB])
+	assert.Equal(t, byte(0x7F), ram[SC])
+	assert.Equal(t, byte(serialInterrupt), ram[0xFF0F])
+
+	// nothing happens once the transfer is done
+	runSerialMCycles(s, &counter, 2048)
+	assert.Len(t, peer.sent, 1)
+}
+
+func TestSerialCGBFastClock(t *testing.T) {
+	ram := make([]byte, 1<<16)
+	peer := &recordingSerialPeer{in: 0xFF}
+	s := NewSerial(ram, true, peer)
+
+	counter := uint16(0)
+	s.writeRegister(SC, 0x83)
+	assert.Equal(t, byte(0xFF), ram[SC])
+
+	// 8 bits at 262144Hz take 128 cycles
+	runSerialMCycles(s, &counter, 32)
+	assert.Len(t, peer.sent, 1)
+	assert.Equal(t, byte(0x7F), ram[SC])
+}
+
+func TestSerialExternalClockWaitsForPeer(t *testing.T) {
+	ram := make([]byte, 1<<16)
+	peer := &recordingSerialPeer{}
+	s := NewSerial(ram, false, peer)
+
+	counter := uint16(0)
+	s.writeRegister(SB, 0x42)
+	s.writeRegister(SC, 0x80)
+	runSerialMCycles(s, &counter, 4096)
+	assert.Empty(t, peer.sent)
+
+	assert.Equal(t, byte(0x42), s.Transfer(0x24))
+	assert.Equal(t, byte(0x24), ram[SB])
+	assert.Equal(t, byte(0x7E), ram[SC])
+	assert.Equal(t, byte(serialInterrupt), ram[0xFF0F])
+
+	// no transfer was requested
+	assert.Equal(t, byte(0xFF), s.Transfer(0x11))
+	assert.Equal(t, byte(0x24), ram[SB])
+}
+
+func TestSerialOutputIsLogged(t *testing.T) {
+	logger := NewRecordingLogger()
+	c := NewEmulator(WithNoRom(), WithLogger(logger), WithDisableApu()).cpu
+
+	c.writeMemory(SB, 'o')
+	c.writeMemory(SC, 0x81)
+	for i := 0; i < 1024; i++ {
+		c.tick()
+	}
+	c.writeMemory(SB, 'k')
+	c.writeMemory(SC, 0x81)
+	for i := 0; i < 1024; i++ {
+		c.tick()
+	}
+
+	assert.Equal(t, "ok", logger.contents)
+}
+
+func TestLinkedEmulators(t *testing.T) {
+	master := NewEmulator(WithNoRom(), WithDisableApu())
+	slave := NewEmulator(WithNoRom(), WithDisableApu())
+	master.Link(slave)
+
+	slave.cpu.writeMemory(SB, 0x24)
+	slave.cpu.writeMemory(SC, 0x80)
+
+	master.cpu.writeMemory(SB, 0x42)
+	master.cpu.writeMemory(SC, 0x81)
+	master.cpu.writeMemory(0xFF0F, 0)
+	for i := 0; i < 1024; i++ {
+		master.cpu.tick()
+	}
+
+	assert.Equal(t, byte(0x24), master.mmu.readMemory(SB))
+	assert.Equal(t, byte(0x42), slave.mmu.readMemory(SB))
+	assert.Equal(t, byte(serialInterrupt), master.mmu.readMemory(0xFF0F)&serialInterrupt)
+	assert.Equal(t, byte(serialInterrupt), slave.mmu.readMemory(0xFF0F)&serialInterrupt)
+	assert.Equal(t, byte(0), slave.mmu.readMemory(SC)&scTransfer)
+}
@@ -0,0 +1,168 @@
+package backend
+
+import "fmt"
+
+// TAMA5 registers, the register is selected by writing to 0xA001, then read or written through 0xA000
+// only the lower nibble of the values is used
+const (
+	tama5ROMBankLow   = 0x0
+	tama5ROMBankHigh  = 0x1 // bit 0: bit 4 of the bank
+	tama5ValueLow     = 0x4
+	tama5ValueHigh    = 0x5
+	tama5Command      = 0x6 // bits 1-3: command, bit 0: bit 4 of the address
+	tama5AddressLow   = 0x7 // writing it runs the command
+	tama5Ready        = 0xA // reads 1
+	tama5ResultLow    = 0xC
+	tama5ResultHigh   = 0xD
+	tama5RegisterMask = 0xF
+
+	// commands
+	tama5WriteRAM = 0x0 // writes the value at the address
+	tama5ReadRAM  = 0x1 // returns the byte at the address
+	tama5Clock    = 0x2 // runs the clock command given by the address
+
+	// clock commands, the time is in BCD
+	tama5StopClock    = 0x0
+	tama5StartClock   = 0x1
+	tama5WriteMinutes = 0x4
+	tama5WriteHours   = 0x5
+	tama5ReadMinutes  = 0x6
+	tama5ReadHours    = 0x7
+
+	tama5RAMSize = 0x20
+)
+
+// TAMA5 is the Bandai cartridge of the Tamagotchi games, with 32 bytes of battery backed RAM and a clock
+// everything goes through registers accessed at 0xA000-0xA001
+type TAMA5 struct {
+	SelectedROMBank  byte
+	SelectedRegister byte
+	Registers        [16]byte
+	Result           byte // returned through tama5ResultLow and tama5ResultHigh
+
+	Rom []byte
+	Ram []byte
+
+	NumRomBanks uint16
+
+	Clock *HuC3Clock
+}
+
+func NewTAMA5(rom []byte, header CartridgeHeader) *TAMA5 {
+	m := new(TAMA5)
+
+	m.SelectedROMBank = 1
+
+	m.Rom = fitROM(rom, header)
+
+	m.NumRomBanks = uint16(len(m.Rom) / 0x4000)
+
+	// the RAM is inside the mapper, the header says there is none
+	m.Ram = make([]byte, tama5RAMSize)
+
+	m.Clock = NewHuC3Clock()
+
+	return m
+}
+
+func (m *TAMA5) ReadMemory(address uint16) byte {
+
+	if address < 0x4000 {
+		return m.Rom[address]
+	}
+	if 0x4000 <= address && address < 0x8000 {
+
+		offset := uint32(address) - 0x4000
+		bankAddress := (uint32(m.SelectedROMBank) * 0x4000) + offset
+		return m.Rom[bankAddress]
+
+	} else if 0xA000 <= address && address < 0xC000 {
+
+		if address&1 == 0 {
+			switch m.SelectedRegister {
+			case tama5Ready:
+				return 0xF1
+			case tama5ResultLow:
+				return 0xF0 | m.Result&0xF
+			case tama5ResultHigh:
+				return 0xF0 | m.Result>>4
+			}
+		}
+		return 0xFF
+	}
+
+	panic(fmt.Sprintf("Got unexpected read address not handled by MBC %d", address))
+}
+
+func (m *TAMA5) WriteMemory(address uint16, value byte) {
+
+	if address < 0x8000 {
+
+		// no registers there
+
+	} else if 0xA000 <= address && address < 0xC000 {
+
+		if address&1 == 1 {
+			m.SelectedRegister = value & tama5RegisterMask
+			return
+		}
+
+		m.Registers[m.SelectedRegister] = value & 0xF
+		switch m.SelectedRegister {
+		case tama5ROMBankLow, tama5ROMBankHigh:
+			bank := m.Registers[tama5ROMBankHigh]&1<<4 | m.Registers[tama5ROMBankLow]
+			m.SelectedROMBank = byte(uint16(bank) % m.NumRomBanks)
+		case tama5AddressLow:
+			m.runCommand()
+		}
+
+	} else {
+		panic(fmt.Sprintf("Got unexpected write address not handled by MBC %d", address))
+	}
+}
+
+func (m *TAMA5) runCommand() {
+	address := m.Registers[tama5Command]&1<<4 | m.Registers[tama5AddressLow]
+	value := m.Registers[tama5ValueHigh]<<4 | m.Registers[tama5ValueLow]
+
+	switch m.Registers[tama5Command] >> 1 {
+	case tama5WriteRAM:
+		m.Ram[address] = value
+	case tama5ReadRAM:
+		m.Result = m.Ram[address]
+	case tama5Clock:
+		m.Clock.sync(timeNow())
+		hours, minutes := m.Clock.Minutes/60, m.Clock.Minutes%60
+
+		switch address {
+		case tama5StopClock:
+			m.Clock.stop()
+		case tama5StartClock:
+			m.Clock.start()
+		case tama5WriteMinutes:
+			m.Clock.set(hours*60+fromBCD(value)%60, m.Clock.Days)
+		case tama5WriteHours:
+			m.Clock.set(fromBCD(value)%24*60+minutes, m.Clock.Days)
+		case tama5ReadMinutes:
+			m.Result = toBCD(minutes)
+		case tama5ReadHours:
+			m.Result = toBCD(hours)
+		}
+	}
+}
+
+func toBCD(value int) byte {
+	return byte(value/10<<4 | value%10)
+}
+
+func fromBCD(value byte) int {
+	return int(value>>4)*10 + int(value&0xF)
+}
+
+func (m *TAMA5) batteryRAM() []byte {
+	return m.Ram
+}
+
+func (m *TAMA5) getClock() cartridgeClock {
+	return m.Clock
+}
@@ -0,0 +1,106 @@
+package backend
+
+const (
+	DIV  = 0xFF04
+	TIMA = 0xFF05
+	TMA  = 0xFF06
+	TAC  = 0xFF07
+)
+
+// bit of the system counter driving TIMA, for each TAC clock select
+// TIMA increments on the falling edge of (bit && timer enabled)
+var timerCounterBits = [4]uint16{1 << 9, 1 << 3, 1 << 5, 1 << 7}
+
+// Timer implements DIV, TIMA, TMA and TAC
+// the register values are kept in ram, DIV is the upper byte of the 16 bit system counter
+type Timer struct {
+	ram []byte
+
+	counter uint16
+
+	// TIMA overflowed during the last M-cycle, it reads 0 until it is reloaded from TMA on the next one
+	overflow bool
+	// TIMA was reloaded from TMA during the current M-cycle, writes to TIMA are ignored
+	reloading bool
+}
+
+func NewTimer(ram []byte) *Timer {
+	t := new(Timer)
+	t.ram = ram
+
+	// the unused TAC bits read as 1
+	t.ram[TAC] |= 0xF8
+
+	return t
+}
+
+// signal is the input of the falling edge detector which increments TIMA
+func (t *Timer) signal() bool {
+	tac := t.ram[TAC]
+	return tac&0x4 > 0 && t.counter&timerCounterBits[tac&0x3] > 0
+}
+
+func (t *Timer) setCounter(counter uint16) {
+	before := t.signal()
+
+	t.counter = counter
+	t.ram[DIV] = byte(counter >> 8)
+
+	if before && !t.signal() {
+		t.incrementTIMA()
+	}
+}
+
+func (t *Timer) incrementTIMA() {
+	t.ram[TIMA]++
+	if t.ram[TIMA] == 0 {
+		t.overflow = true
+	}
+}
+
+// Tick advances the timer by one M-cycle
+func (t *Timer) Tick() {
+	t.reloading = false
+	if t.overflow {
+		t.overflow = false
+		t.reloading = true
+
+		t.ram[TIMA] = t.ram[TMA]
+		t.ram[0xFF0F] |= 0x4
+	}
+
+	t.setCounter(t.counter + 4)
+}
+
+// ResetDIV resets the system counter, e.g. when DIV is written or STOP is executed
+// this can increment TIMA if the selected counter bit was set
+func (t *Timer) ResetDIV() {
+	t.setCounter(0)
+}
+
+func (t *Timer) writeRegister(address uint16, value byte) {
+	switch address {
+	case DIV:
+		t.ResetDIV()
+	case TIMA:
+		if t.reloading {
+			// TMA is being loaded into TIMA this cycle, it wins
+			return
+		}
+		// writing TIMA in the cycle after an overflow cancels the reload and interrupt
+		t.overflow = false
+		t.ram[TIMA] = value
+	case TMA:
+		t.ram[TMA] = value
+		if t.reloading {
+			t.ram[TIMA] = value
+		}
+	case TAC:
+		// disabling the timer or changing the clock select can cause a falling edge
+		before := t.signal()
+		t.ram[TAC] = 0xF8 | value&0x7
+		if before && !t.signal() {
+			t.incrementTIMA()
+		}
+	}
+}
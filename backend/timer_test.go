@@ -0,0 +1,139 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func NewTestTimer(tac byte) *Timer {
+	ram := make([]byte, 1<<16)
+	timer := NewTimer(ram)
+	timer.writeRegister(TAC, tac)
+	return timer
+}
+
+func TestTimerIncrementsOnFallingEdge(t *testing.T) {
+	// increments every 16 cycles, on the falling edge of bit 3
+	timer := NewTestTimer(0b101)
+
+	for i := 0; i < 3; i++ {
+		timer.Tick()
+	}
+	assert.Equal(t, byte(0), timer.ram[TIMA])
+
+	timer.Tick()
+	assert.Equal(t, byte(1), timer.ram[TIMA])
+
+	for i := 0; i < 4*10; i++ {
+		timer.Tick()
+	}
+	assert.Equal(t, byte(11), timer.ram[TIMA])
+}
+
+func TestTimerDoesNotIncrementWhenDisabled(t *testing.T) {
+	timer := NewTestTimer(0b001)
+
+	for i := 0; i < 1000; i++ {
+		timer.Tick()
+	}
+	assert.Equal(t, byte(0), timer.ram[TIMA])
+	assert.Equal(t, byte(1000*4>>8), timer.ram[DIV])
+}
+
+func TestDIVWriteCanIncrementTIMA(t *testing.T) {
+	timer := NewTestTimer(0b101)
+	timer.Tick()
+	timer.Tick()
+
+	// bit 3 is set, resetting the counter is a falling edge
+	timer.writeRegister(DIV, 0x12)
+	assert.Equal(t, byte(1), timer.ram[TIMA])
+	assert.Equal(t, byte(0), timer.ram[DIV])
+	assert.Equal(t, uint16(0), timer.counter)
+
+	// bit 3 is not set
+	timer.Tick()
+	timer.writeRegister(DIV, 0)
+	assert.Equal(t, byte(1), timer.ram[TIMA])
+}
+
+func TestTACWriteCanIncrementTIMA(t *testing.T) {
+	timer := NewTestTimer(0b101)
+	timer.Tick()
+	timer.Tick()
+
+	// disabling the timer while bit 3 is set
+	timer.writeRegister(TAC, 0b001)
+	assert.Equal(t, byte(1), timer.ram[TIMA])
+	assert.Equal(t, byte(0xF9), timer.ram[TAC])
+
+	// switching to a clock select whose bit is not set
+	timer.writeRegister(TAC, 0b101)
+	timer.writeRegister(TAC, 0b100)
+	assert.Equal(t, byte(2), timer.ram[TIMA])
+}
+
+func overflowTimer(timer *Timer) {
+	timer.ram[TMA] = 0x42
+	timer.ram[TIMA] = 0xFF
+	for i := 0; i < 4; i++ {
+		timer.Tick()
+	}
+}
+
+func TestTIMAOverflowIsDelayed(t *testing.T) {
+	timer := NewTestTimer(0b101)
+	overflowTimer(timer)
+
+	// TIMA reads 0 for one M-cycle
+	assert.Equal(t, byte(0), timer.ram[TIMA])
+	assert.Equal(t, byte(0), timer.ram[0xFF0F])
+
+	timer.Tick()
+	assert.Equal(t, byte(0x42), timer.ram[TIMA])
+	assert.Equal(t, byte(0x4), timer.ram[0xFF0F])
+}
+
+func TestTIMAWriteCancelsOverflow(t *testing.T) {
+	timer := NewTestTimer(0b101)
+	overflowTimer(timer)
+
+	timer.writeRegister(TIMA, 0x10)
+	timer.Tick()
+	assert.Equal(t, byte(0x10), timer.ram[TIMA])
+	assert.Equal(t, byte(0), timer.ram[0xFF0F])
+}
+
+func TestWritesWhileReloading(t *testing.T) {
+	timer := NewTestTimer(0b101)
+	overflowTimer(timer)
+	timer.Tick()
+
+	// TIMA writes are ignored during the reload
+	timer.writeRegister(TIMA, 0x10)
+	assert.Equal(t, byte(0x42), timer.ram[TIMA])
+
+	// TMA writes go through to TIMA
+	timer.writeRegister(TMA, 0x20)
+	assert.Equal(t, byte(0x20), timer.ram[TIMA])
+
+	// back to normal on the next cycle
+	timer.Tick()
+	timer.writeRegister(TIMA, 0x10)
+	assert.Equal(t, byte(0x10), timer.ram[TIMA])
+}
+
+func TestDIVReadsUpperByteOfCounter(t *testing.T) {
+	c := NewEmulator(WithNoRom(), WithModel(ModelDMG), WithDisableApu()).cpu
+	assert.Equal(t, byte(0xAB), c.readMemory(DIV))
+
+	// DIV increments every 64 M-cycles
+	for i := 0; i < 64; i++ {
+		c.mmu.timer.Tick()
+	}
+	assert.Equal(t, byte(0xAC), c.mmu.readMemory(DIV))
+
+	c.writeMemory(DIV, 0xFF)
+	assert.Equal(t, byte(0), c.mmu.readMemory(DIV))
+}
@@ -17,6 +17,12 @@ func main() {
 	profile := flag.Bool("profile", false, "profile the emulator")
 	loadSave := flag.Bool("load-save", false, "try to load a save")
 	audio := flag.Bool("audio", true, "whether to enable audio")
+	bootRom := flag.String("boot-rom", "", "path to a boot rom to run before the game")
+	modelName := flag.String("model", "auto", "hardware model to emulate: auto, dmg0, dmg, mgb, sgb, sgb2 or cgb")
+	hostClock := flag.Bool("host-clock", false, "run the cartridge clock from the host clock rather than the emulated cycles")
+	linkListen := flag.String("link-listen", "", "wait for another emulator to connect its link cable on this address (e.g. :8765)")
+	linkConnect := flag.String("link-connect", "", "connect the link cable to another emulator listening on this address")
+	camera := flag.String("camera", "", "PNG file or directory of PNG files seen by the Game Boy Camera, a test pattern by default")
 	flag.Parse()
 
 	if *profile {
@@ -35,20 +41,65 @@ func main() {
 
 	romPath := flag.Arg(0)
 
+	model, err := backend.ParseModel(*modelName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cameraSource, err := backend.CameraImageSourceFromPath(*camera)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	var emu *backend.Emulator
 
 	if *loadSave && backend.SaveExistsForRom(romPath) {
 		emu = backend.LoadSave(romPath)
+		emu.SetBatterySave(backend.BatterySavePath(romPath))
+		emu.SetCameraImageSource(cameraSource)
 	} else {
-		emu = backend.NewEmulator(
+		options := []func(*backend.Emulator){
 			backend.WithRom(romPath),
 			backend.WithDebug(*debug),
-			backend.WithAudio(*audio))
+			backend.WithAudio(*audio),
+			backend.WithModel(model),
+			backend.WithHostClock(*hostClock),
+			backend.WithBatterySave(backend.BatterySavePath(romPath)),
+			backend.WithCameraImageSource(cameraSource),
+		}
+		if *bootRom != "" {
+			options = append(options, backend.WithBootRom(*bootRom))
+		}
+		emu = backend.NewEmulator(options...)
 	}
 
 	if *loadSave {
 		defer backend.DumpEmulatorState(romPath, emu)
 	}
+	defer func() {
+		if err := emu.FlushBatterySave(); err != nil {
+			log.Println("Can't write the battery save:", err)
+		}
+	}()
+
+	if *linkListen != "" && *linkConnect != "" {
+		log.Fatal("-link-listen and -link-connect can't be used together")
+	}
+
+	var link *backend.TCPLink
+	if *linkListen != "" {
+		fmt.Println("Waiting for link cable connection on", *linkListen)
+		link, err = backend.ListenLink(*linkListen)
+	} else if *linkConnect != "" {
+		link, err = backend.DialLink(*linkConnect)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if link != nil {
+		defer link.Close()
+		emu.SetSerialPeer(link)
+	}
 
 	RunGame(emu)
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/guigzzz/GoGB/backend"
 	"github.com/hajimehoshi/ebiten/v2"
@@ -14,6 +15,10 @@ type Game struct {
 	e               *backend.Emulator
 	speedMultiplier float32
 	counter         int
+
+	// the rumble motor was turned on during the current frame
+	rumble     bool
+	gamepadIDs []ebiten.GamepadID
 }
 
 const (
@@ -42,6 +47,8 @@ func (g *Game) Update() error {
 		g.UpdateMaxTps(-SPEED_INCREMENT)
 	}
 
+	emu.SetTilt(g.tilt())
+
 	g.counter++
 	if g.counter%(int(g.speedMultiplier*60)) == 0 {
 		ebiten.SetWindowTitle(fmt.Sprintf("GoGB | TPS: %.1f | FPS: %.1f",
@@ -50,9 +57,75 @@ func (g *Game) Update() error {
 
 	emu.RunForAFrame()
 
+	if g.rumble || emu.IsRumbling() {
+		g.vibrate()
+	}
+	g.rumble = false
+
 	return nil
 }
 
+// tilt returns the tilt of the cartridge for games with an accelerometer
+// it is controlled with the arrow keys, the left stick of a gamepad, or by dragging the mouse away from the center of the window
+func (g *Game) tilt() (x, y float64) {
+	if ebiten.IsKeyPressed(ebiten.KeyArrowLeft) {
+		x--
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyArrowRight) {
+		x++
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyArrowUp) {
+		y--
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyArrowDown) {
+		y++
+	}
+
+	g.gamepadIDs = ebiten.AppendGamepadIDs(g.gamepadIDs[:0])
+	for _, id := range g.gamepadIDs {
+		if ebiten.IsStandardGamepadLayoutAvailable(id) {
+			x += ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickHorizontal)
+			y += ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickVertical)
+		} else if ebiten.GamepadAxisCount(id) >= 2 {
+			x += ebiten.GamepadAxisValue(id, 0)
+			y += ebiten.GamepadAxisValue(id, 1)
+		}
+	}
+
+	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		// the cursor position is in screen pixels
+		cx, cy := ebiten.CursorPosition()
+		x += float64(cx-width/2) / (width / 2)
+		y += float64(cy-height/2) / (height / 2)
+	}
+
+	return clamp(x, -1, 1), clamp(y, -1, 1)
+}
+
+func clamp(v, low, high float64) float64 {
+	if v < low {
+		return low
+	}
+	if v > high {
+		return high
+	}
+	return v
+}
+
+// vibrate makes the gamepads vibrate for a frame
+func (g *Game) vibrate() {
+	options := &ebiten.VibrateGamepadOptions{
+		Duration:        time.Second / time.Duration(ebiten.TPS()),
+		StrongMagnitude: 1,
+		WeakMagnitude:   1,
+	}
+
+	g.gamepadIDs = ebiten.AppendGamepadIDs(g.gamepadIDs[:0])
+	for _, id := range g.gamepadIDs {
+		ebiten.VibrateGamepad(id, options)
+	}
+}
+
 func max(a, b float32) float32 {
 	if a > b {
 		return a
@@ -82,6 +155,11 @@ func (g *Game) Layout(outsideWidth, outsideHeight int) (screenWidth, screenHeigh
 
 func RunGame(emu *backend.Emulator) {
 	game := &Game{e: emu, speedMultiplier: 1}
+	emu.SetRumbleCallback(func(on bool) {
+		if on {
+			game.rumble = true
+		}
+	})
 
 	audioContext := audio.NewContext(48000)
 	player, err := audioContext.NewPlayer(emu.GetAudioStream())